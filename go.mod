@@ -5,9 +5,15 @@ module github.com/corelight/go-zeek-broker-ws
 go 1.20
 
 require (
-	github.com/gorilla/websocket v1.5.0 // indirect
-	github.com/libp2p/go-openssl v0.1.0 // indirect
+	github.com/gorilla/websocket v1.5.0
+	github.com/libp2p/go-openssl v0.1.0
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78
+	golang.org/x/net v0.35.0
+)
+
+require (
 	github.com/mattn/go-pointer v0.0.1 // indirect
 	github.com/spacemonkeygo/spacelog v0.0.0-20180420211403-2296661a0572 // indirect
-	golang.org/x/sys v0.0.0-20190626221950-04f50cda93cb // indirect
+	golang.org/x/crypto v0.33.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 )
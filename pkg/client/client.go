@@ -3,22 +3,72 @@
 package client
 
 import (
+	"bytes"
+	"compress/flate"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/corelight/go-zeek-broker-ws/pkg/encoding"
 	"github.com/gorilla/websocket"
 )
 
 // Client is a basic websocket client for publishing/subscribing to events via the Zeek broker websocket API.
+//
+// A Client is safe for concurrent use by multiple publishers and readers: gorilla/websocket supports only one
+// concurrent writer and one concurrent reader, so writes are serialised, as are reads (each message is returned to
+// only one of any concurrent readers). Typically, any number of goroutines publish, and one reads.
 type Client struct {
 	conn            *websocket.Conn
-	topics          []string
 	ctx             context.Context
 	endpointUUID    string
 	endpointVersion string
+	writeTimeout    time.Duration
+	readTimeout     time.Duration
+	idleTimeout     time.Duration
+	readLimit       int64 // the maximum size of a message, or negative if unlimited
+
+	writeMu sync.Mutex // serialises writes, since the websocket supports only one concurrent writer
+	readMu  sync.Mutex // serialises reads, since the websocket supports only one concurrent reader
+
+	closed    chan struct{} // closed by Close, to stop watching ctx
+	closeOnce sync.Once
+
+	readDeadlineMu sync.Mutex // orders setting the read deadline for a read against interrupting it in watchContext
+	readTimeoutDue time.Time  // when the read timeout of the current read expires, or zero if there is none
+	idleTimeoutDue time.Time  // when the idle timeout expires unless a frame is received, or zero if there is none
+
+	keepaliveFailed atomic.Bool // set when the keepalive closes the connection
+	broken          atomic.Bool // set once the connection has failed, which gorilla/websocket can't recover from
+
+	pingSeq     atomic.Uint64
+	pongMu      sync.Mutex
+	pongWaiters map[string]chan struct{} // keyed by the payload of the ping awaiting a pong
+
+	topicsMu     sync.RWMutex
+	topics       []string
+	unsubscribed bool // whether Unsubscribe has removed any topics, so that events must be filtered
+
+	lastEventsMu sync.RWMutex
+	lastEvents   map[string]encoding.Event // nil unless WithLastEventCache is used
+
+	lastErrMu          sync.RWMutex
+	lastErr            error
+	clearLastErrOnRead bool
+
+	logger  Logger
+	metrics Metrics
+
+	onDisconnect   func(err error)
+	disconnectOnce sync.Once
 }
 
 const websocketNormalEOFCode = 1000
@@ -44,6 +94,10 @@ type TLSDialFunc func(ctx context.Context, network, addr string) (net.Conn, erro
 // ErrTLSDailFuncNotProvided is returned by NewClient if secure is True but no TLSDailFunc is provided.
 var ErrTLSDialFuncNotProvided = errors.New("a TLSDialFunc must be provided in secure mode")
 
+// messagesPath is the path of broker's websocket endpoint. JSON is the only encoding broker offers over WebSockets
+// (its binary format is only spoken between peers).
+const messagesPath = "/v1/messages/json"
+
 // NewClient constructs a new websocket client to connect to the endpoint specified,
 // subscribing to topics (which may be an empty list). If secure is False, then TLS must be turned off
 // for the broker websocket server in zeek (using "redef Broker::disable_ssl = T;"). If secure is True,
@@ -51,61 +105,670 @@ var ErrTLSDialFuncNotProvided = errors.New("a TLSDialFunc must be provided in se
 // (which disables TLS verification), use weirdtls.BrokerDefaultTLSDialer. When broker is configured with certificates,
 // the securetls.MakeSecureDialer() function returns a dialer function that uses a provided CA and client
 // certificate/key that is loaded from PEM files. The dial function may be nil if secure is False (if not nil,
-// it will be ignored).
+// it will be ignored). Optional behaviour is configured with opts.
+//
+// NewClient is equivalent to NewClientWithOptions with WithTLS(tlsDialFunc) (if secure is True) and
+// WithTopics(topics...) preceding opts.
 func NewClient(ctx context.Context, hostPort string, secure bool,
-	tlsDialFunc TLSDialFunc, topics []string) (*Client, error) {
-	scheme := "ws"
-	dialer := websocket.DefaultDialer
+	tlsDialFunc TLSDialFunc, topics []string, opts ...Option) (*Client, error) {
+	if secure && tlsDialFunc == nil {
+		return nil, ErrTLSDialFuncNotProvided
+	}
 
+	base := []Option{WithTopics(topics...)}
 	if secure {
-		if tlsDialFunc == nil {
+		base = append(base, WithTLS(tlsDialFunc))
+	}
+
+	return NewClientWithOptions(ctx, hostPort, append(base, opts...)...)
+}
+
+// NewClientWithOptions constructs a new websocket client to connect to the endpoint specified, configured by opts
+// (see Option for the defaults). Without WithTLS, the connection is made in plain text, so TLS must be turned off
+// for the broker websocket server in zeek (using "redef Broker::disable_ssl = T;"). Without WithTopics, the client
+// doesn't subscribe to any topics, and can only publish.
+//
+// ctx bounds the lifetime of the client: once it is done, any pending or subsequent read, and any publish that
+// isn't given a context of its own (see PublishEventContext), returns ctx.Err(). The connection isn't closed
+// automatically, so Close must still be called.
+func NewClientWithOptions(ctx context.Context, hostPort string, opts ...Option) (*Client, error) {
+	o := makeOptions(opts)
+
+	// The dialer is copied, so that setting the TLS dial function affects neither websocket.DefaultDialer (shared by
+	// every user of gorilla/websocket in the process) nor a dialer given by WithDialer.
+	scheme := "ws"
+	dialer := *websocket.DefaultDialer
+	if o.dialer != nil {
+		dialer = *o.dialer
+	}
+
+	if o.secure {
+		if o.tlsDialFunc == nil {
 			return nil, ErrTLSDialFuncNotProvided
 		}
-		dialer.NetDialTLSContext = tlsDialFunc
 		scheme = "wss"
 	}
 
-	url := fmt.Sprintf("%s://%s/v1/messages/json", scheme, hostPort)
+	if err := configureDialer(&dialer, hostPort, o); err != nil {
+		return nil, err
+	}
+
+	var minBrokerVersion brokerVersion
+	if o.minBrokerVersion != "" {
+		var err error
+		if minBrokerVersion, err = parseBrokerVersion(o.minBrokerVersion); err != nil {
+			return nil, fmt.Errorf("invalid minimum broker version: %w", err)
+		}
+	}
+
+	if o.compression {
+		if o.compressionLevel < flate.HuffmanOnly || o.compressionLevel > flate.BestCompression {
+			return nil, fmt.Errorf("invalid compression level %d", o.compressionLevel)
+		}
+		dialer.EnableCompression = true
+	}
 
-	c, _, err := dialer.DialContext(ctx, url, nil)
+	url := fmt.Sprintf("%s://%s%s", scheme, hostPort, messagesPath)
+
+	c, _, err := dialer.DialContext(ctx, url, o.headers)
 	if err != nil {
 		return nil, err
 	}
 
-	err = c.WriteJSON(topics)
+	client := &Client{
+		conn:         c,
+		topics:       o.topics,
+		ctx:          ctx,
+		writeTimeout: o.writeTimeout,
+		readTimeout:  o.readTimeout,
+		idleTimeout:  o.idleTimeout,
+		closed:       make(chan struct{}),
+		pongWaiters:  make(map[string]chan struct{}),
+
+		clearLastErrOnRead: o.clearLastErrorOnRead,
+		logger:             o.logger,
+		metrics:            o.metrics,
+	}
+
+	if o.compression {
+		// Both are no-ops if broker didn't agree to compression.
+		c.EnableWriteCompression(true)
+		_ = c.SetCompressionLevel(o.compressionLevel) // the level was validated above
+	}
+
+	c.SetPongHandler(client.handlePong)
+	if client.readLimit = o.maxMessageSize; client.readLimit == 0 {
+		client.readLimit = encoding.DefaultMaxBytes
+	}
+	if client.readLimit > 0 {
+		c.SetReadLimit(client.readLimit)
+	}
+	client.watchContext()
+
+	err = client.writeJSON(ctx, o.topics)
 	if err != nil {
+		_ = client.Close()
 		return nil, err
 	}
 
 	var ack encoding.AckMessage
-	err = c.ReadJSON(&ack)
+	if err = client.setReadDeadline(); err == nil {
+		err = c.ReadJSON(&ack)
+	}
 	if err != nil {
-		return nil, err
+		_ = client.Close()
+		return nil, client.readError(err)
+	}
+
+	client.endpointUUID = ack.EndpointUUID
+	client.endpointVersion = ack.Version
+
+	if o.minBrokerVersion != "" {
+		if err = checkBrokerVersion(ack.Version, minBrokerVersion, o.minBrokerVersion); err != nil {
+			_ = client.Close()
+			return nil, err
+		}
+	}
+
+	client.logger.Info("connected to broker", "address", hostPort, "endpoint", ack.EndpointUUID,
+		"version", ack.Version, "topics", o.topics)
+
+	// The disconnect callback is only set once connected, so that it isn't called for a failed handshake.
+	client.onDisconnect = o.onDisconnect
+	if o.onConnect != nil {
+		o.onConnect(ack.EndpointUUID, ack.Version)
+	}
+
+	if o.lastEventCache {
+		client.lastEvents = make(map[string]encoding.Event)
+	}
+
+	if o.keepaliveInterval > 0 {
+		client.startKeepalive(o.keepaliveInterval, o.keepaliveTimeout)
+	}
+
+	return client, nil
+}
+
+// watchContext interrupts any pending read once the client's context is done, by moving the read deadline into
+// the past. gorilla/websocket reads can't otherwise be cancelled.
+func (c *Client) watchContext() {
+	if c.ctx.Done() == nil {
+		return // the context can never be done
+	}
+
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			c.readDeadlineMu.Lock()
+			_ = c.conn.SetReadDeadline(time.Now())
+			c.readDeadlineMu.Unlock()
+		case <-c.closed:
+		}
+	}()
+}
+
+// setReadDeadline applies the read and idle timeouts (if any) to the next read. It returns the client's context
+// error rather than extending the deadline if the context is done, so that a read can't outlive an interruption by
+// watchContext.
+func (c *Client) setReadDeadline() error {
+	c.readDeadlineMu.Lock()
+	defer c.readDeadlineMu.Unlock()
+
+	if err := c.ctx.Err(); err != nil {
+		return err
 	}
 
-	return &Client{
-		conn:            c,
-		topics:          topics,
-		ctx:             ctx,
-		endpointUUID:    ack.EndpointUUID,
-		endpointVersion: ack.Version,
-	}, nil
+	now := time.Now()
+	c.readTimeoutDue, c.idleTimeoutDue = time.Time{}, time.Time{}
+	if c.readTimeout > 0 {
+		c.readTimeoutDue = now.Add(c.readTimeout)
+	}
+	if c.idleTimeout > 0 {
+		c.idleTimeoutDue = now.Add(c.idleTimeout)
+	}
+
+	if c.readTimeout > 0 || c.idleTimeout > 0 {
+		return c.conn.SetReadDeadline(c.readDeadlineLocked())
+	}
+
+	return nil
+}
+
+// readDeadlineLocked returns the earlier of the read and idle timeouts' deadlines, or zero if there are neither.
+// c.readDeadlineMu must be held.
+func (c *Client) readDeadlineLocked() time.Time {
+	if c.idleTimeoutDue.IsZero() || (!c.readTimeoutDue.IsZero() && c.readTimeoutDue.Before(c.idleTimeoutDue)) {
+		return c.readTimeoutDue
+	}
+	return c.idleTimeoutDue
+}
+
+// readError returns the client's context error in place of err if the context is done, since the read was then
+// (most likely) interrupted by watchContext, and ErrKeepaliveTimeout if the keepalive closed the connection. An idle
+// timeout is wrapped with ErrIdleTimeout, and a read limit error is annotated with the limit.
+func (c *Client) readError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctxErr := c.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	if c.keepaliveFailed.Load() {
+		return ErrKeepaliveTimeout
+	}
+
+	if c.isIdleTimeout(err) {
+		return fmt.Errorf("%w: %w", ErrIdleTimeout, err)
+	}
+
+	if errors.Is(err, websocket.ErrReadLimit) {
+		return fmt.Errorf("message from broker exceeds the maximum size of %d bytes: %w", c.readLimit, err)
+	}
+
+	return err
+}
+
+// UnexpectedMessageTypeError is returned by ReadMessage (and ReadEvent) when the websocket frame received is not
+// a text frame, which is what the broker JSON endpoint always sends.
+type UnexpectedMessageTypeError struct {
+	MessageType int
+}
+
+// Error implements the Error interface for UnexpectedMessageTypeError.
+func (e UnexpectedMessageTypeError) Error() string {
+	return fmt.Sprintf("expected a text websocket message from the broker JSON endpoint but got a %s message",
+		messageTypeName(e.MessageType))
+}
+
+func messageTypeName(messageType int) string {
+	switch messageType {
+	case websocket.TextMessage:
+		return "text"
+	case websocket.BinaryMessage:
+		return "binary"
+	default:
+		return fmt.Sprintf("type %d", messageType)
+	}
+}
+
+// ReadRawMessage reads a single websocket message from broker, returning the message type (websocket.TextMessage
+// or websocket.BinaryMessage) and the undecoded payload.
+func (c *Client) ReadRawMessage() (messageType int, payload []byte, err error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	if err = c.setReadDeadline(); err != nil {
+		return 0, nil, err
+	}
+
+	messageType, payload, err = c.conn.ReadMessage()
+	if err != nil {
+		err = c.readError(err)
+		c.markBroken(err)
+	}
+	return messageType, payload, err
+}
+
+// ReadMessage reads a single data message from broker, or returns an error (including errors received from
+// broker itself). An error message from broker (e.g. for a message that it failed to deserialise) is returned as
+// an encoding.ErrorMessage, which can be distinguished from other errors with errors.As, and after which the client
+// remains usable. An UnexpectedMessageTypeError is returned if a binary websocket message is received, and the
+// client's context error if the context is done.
+func (c *Client) ReadMessage() (encoding.DataMessage, error) {
+	msg, err := c.readMessage()
+	c.setLastError(err)
+
+	return msg, err
+}
+
+func (c *Client) readMessage() (encoding.DataMessage, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	if err := c.setReadDeadline(); err != nil {
+		return encoding.DataMessage{}, err
+	}
+
+	messageType, r, err := c.conn.NextReader()
+	if err != nil {
+		err = c.readError(err)
+		c.markBroken(err)
+		return encoding.DataMessage{}, err
+	}
+
+	if messageType != websocket.TextMessage {
+		return encoding.DataMessage{}, UnexpectedMessageTypeError{MessageType: messageType}
+	}
+
+	var msg encoding.DataMessage
+	if err = json.NewDecoder(r).Decode(&msg); err != nil {
+		var brokerErr encoding.ErrorMessage
+		if errors.As(err, &brokerErr) {
+			c.logger.Warn("broker reported an error", "code", brokerErr.Code, "context", brokerErr.Context)
+			return encoding.DataMessage{}, brokerErr
+		}
+		err = c.readError(err)
+		if errors.Is(err, websocket.ErrReadLimit) {
+			c.markBroken(err) // gorilla/websocket closes the connection
+		} else {
+			c.metrics.DecodeError(err)
+		}
+		return encoding.DataMessage{}, err
+	}
+
+	return msg, nil
 }
 
 // ReadEvent reads a single event from broker, and returns the topic and event, or an error (including
 // errors received from broker itself). The Client instance must be created with the list topic subscriptions.
+// Once the context the client was created with is done, ReadEvent returns its error (even if a read is pending).
+// Events on topics removed by Unsubscribe are skipped. As for ReadMessage, an error message from broker is returned
+// as an encoding.ErrorMessage.
 func (c *Client) ReadEvent() (topic string, evt encoding.Event, retErr error) {
-	var msg encoding.DataMessage
-	if err := c.conn.ReadJSON(&msg); err != nil {
-		return "", encoding.Event{}, err
+	for {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			return "", encoding.Event{}, err
+		}
+
+		topic, evt, err = msg.GetEvent()
+		if err != nil {
+			c.metrics.DecodeError(err)
+			return "", encoding.Event{}, err
+		}
+
+		if c.isSubscribed(topic) {
+			break
+		}
+	}
+
+	c.metrics.EventRead(topic)
+
+	if c.lastEvents != nil {
+		c.lastEventsMu.Lock()
+		c.lastEvents[topic] = evt
+		c.lastEventsMu.Unlock()
 	}
 
-	return msg.GetEvent()
+	return topic, evt, nil
 }
 
-// PublishEvent publishes an event to the topic provided.
+// LastEvent returns the most recent event received on topic (by ReadEvent, and therefore also via
+// AsyncSubscription). The cache must be enabled with WithLastEventCache, otherwise ok is always false.
+// One event is kept per distinct topic received: since broker subscriptions are prefix matches, that
+// is one per subscribed topic only when subscribing to exact topics. LastEvent is safe to call
+// concurrently with reads.
+func (c *Client) LastEvent(topic string) (evt encoding.Event, ok bool) {
+	if c.lastEvents == nil {
+		return encoding.Event{}, false
+	}
+
+	c.lastEventsMu.RLock()
+	defer c.lastEventsMu.RUnlock()
+
+	evt, ok = c.lastEvents[topic]
+	return evt, ok
+}
+
+// Topics returns the topics that the client is subscribed to: those given when it was created, less any removed by
+// Unsubscribe.
+func (c *Client) Topics() []string {
+	c.topicsMu.RLock()
+	defer c.topicsMu.RUnlock()
+
+	return append([]string{}, c.topics...)
+}
+
+// Unsubscribe removes topics from those that the client is subscribed to (ignoring any that aren't), so that
+// ReadEvent (and therefore AsyncSubscription) skips events that are no longer covered by any remaining topic.
+//
+// Broker's WebSocket API only accepts subscriptions in the handshake, so broker carries on sending events on the
+// removed topics, and they are filtered out as they are read. To stop broker from sending them at all, use
+// ReconnectingClient.Unsubscribe, which reconnects with the remaining topics. Unsubscribe is safe to call
+// concurrently with reads.
+func (c *Client) Unsubscribe(topics ...string) {
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+
+	c.topics = removeTopics(c.topics, topics)
+	c.unsubscribed = true
+}
+
+// isSubscribed reports whether an event on topic should be delivered, i.e. that it hasn't been unsubscribed from.
+// As in broker, a topic is covered by any subscribed topic that is a prefix of it.
+func (c *Client) isSubscribed(topic string) bool {
+	c.topicsMu.RLock()
+	defer c.topicsMu.RUnlock()
+
+	if !c.unsubscribed {
+		return true // broker only sends events on subscribed topics
+	}
+
+	for _, t := range c.topics {
+		if strings.HasPrefix(topic, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeTopics returns a copy of topics without any of removed.
+func removeTopics(topics, removed []string) []string {
+	remaining := make([]string, 0, len(topics))
+	for _, t := range topics {
+		if !containsTopic(removed, t) {
+			remaining = append(remaining, t)
+		}
+	}
+	return remaining
+}
+
+// LastError returns the most recent error observed by ReadMessage (and therefore ReadEvent and
+// AsyncSubscription): either an encoding.ErrorMessage received from broker, or a transport or decoding error.
+// It returns nil if no error has been observed, or if WithLastErrorClearedOnRead is used and the most recent read
+// succeeded. LastError is safe to call concurrently with reads.
+func (c *Client) LastError() error {
+	c.lastErrMu.RLock()
+	defer c.lastErrMu.RUnlock()
+
+	return c.lastErr
+}
+
+func (c *Client) setLastError(err error) {
+	if err == nil && !c.clearLastErrOnRead {
+		return
+	}
+
+	c.lastErrMu.Lock()
+	c.lastErr = err
+	c.lastErrMu.Unlock()
+}
+
+// PublishEvent publishes an event to the topic provided. It is safe to call concurrently with other publishes. It is
+// equivalent to PublishEventContext with the client's context.
 func (c *Client) PublishEvent(topic string, evt encoding.Event) error {
-	return c.conn.WriteJSON(evt.Encode(topic))
+	return c.PublishEventContext(c.ctx, topic, evt)
+}
+
+// PublishEventContext publishes an event to the topic provided, returning ctx.Err() if ctx is done before the event
+// is written. The write is bounded by ctx's deadline (or the write timeout, if sooner), and a write in progress when
+// ctx is done is aborted. As for a write timeout, an aborted write leaves the connection unusable, since part of the
+// event may have been sent. Waiting for concurrent publishes to finish isn't bounded by ctx, but their writes are
+// bounded by their own contexts. It is safe to call concurrently with other publishes.
+func (c *Client) PublishEventContext(ctx context.Context, topic string, evt encoding.Event) error {
+	err := c.writeJSON(ctx, evt.Encode(topic))
+	c.metrics.Published(topic, err)
+	return err
+}
+
+// PublishData publishes d to the topic provided, as a data message rather than an event, e.g. for zeek scripts that
+// handle the data received on a topic generically. It is safe to call concurrently with other publishes.
+func (c *Client) PublishData(topic string, d encoding.Data) error {
+	err := c.writeJSON(c.ctx, encoding.NewDataMessage(topic, d))
+	c.metrics.Published(topic, err)
+	return err
+}
+
+// PublishError is returned by PublishEvents when an event in the batch could not be published.
+type PublishError struct {
+	Index int   // the index of the event that failed, all of whose predecessors were published
+	Err   error // the underlying error
+}
+
+// Error implements the Error interface for PublishError.
+func (e PublishError) Error() string {
+	return fmt.Sprintf("publishing event %d: %s", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e PublishError) Unwrap() error {
+	return e.Err
+}
+
+// PublishEvents publishes events to the topic provided, in order, as a batch: no other publish is interleaved with
+// them, and the buffer that they are encoded into is reused. Broker expects each message in a websocket message of
+// its own, so there is still one write per event.
+//
+// If an event can't be published, PublishEvents stops and returns a PublishError with its index: the events before
+// it were published, and those after it weren't. If the event couldn't be encoded, it wasn't sent either, and the
+// client remains usable. Otherwise the connection failed, and the event may or may not have reached broker.
+func (c *Client) PublishEvents(topic string, evts []encoding.Event) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	for i, evt := range evts {
+		buf.Reset()
+		err := enc.Encode(evt.Encode(topic))
+		if err == nil {
+			err = c.writeMessageLocked(c.ctx, buf.Bytes())
+		}
+
+		c.metrics.Published(topic, err)
+		if err != nil {
+			return PublishError{Index: i, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// TopicError is an error publishing to a topic, see PublishTopicsError.
+type TopicError struct {
+	Topic string
+	Err   error
+}
+
+// Error implements the Error interface for TopicError.
+func (e TopicError) Error() string {
+	return fmt.Sprintf("publishing to %s: %s", e.Topic, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e TopicError) Unwrap() error {
+	return e.Err
+}
+
+// PublishTopicsError is returned by PublishToTopics when the event could not be published to some of the topics.
+type PublishTopicsError struct {
+	Failed []TopicError // the topics that the event wasn't published to, in the order given
+}
+
+// Error implements the Error interface for PublishTopicsError.
+func (e PublishTopicsError) Error() string {
+	msgs := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		msgs[i] = f.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors for each topic (as TopicErrors), so that errors.Is and errors.As look at all of them.
+func (e PublishTopicsError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, f := range e.Failed {
+		errs[i] = f
+	}
+	return errs
+}
+
+// PublishToTopics publishes evt to each of topics, in order, encoding it only once: only the message's topic varies.
+// As for PublishEvents, no other publish is interleaved with them, but there is one write per topic.
+//
+// Publishing is best-effort per topic: a failure to publish to one topic doesn't stop PublishToTopics from trying
+// the rest, and it returns a PublishTopicsError listing those that failed. If the connection fails, the event may or
+// may not have reached broker on the topic being written at the time, and the remaining topics fail too. If the
+// event can't be encoded, nothing is published and the encoding error is returned.
+func (c *Client) PublishToTopics(topics []string, evt encoding.Event) error {
+	msgs, err := encoding.MarshalDataMessages(*evt.Encode("").Data, topics)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	var failed []TopicError
+	for i, topic := range topics {
+		err = c.writeMessageLocked(c.ctx, msgs[i])
+		c.metrics.Published(topic, err)
+		if err != nil {
+			failed = append(failed, TopicError{Topic: topic, Err: err})
+		}
+	}
+
+	if len(failed) > 0 {
+		return PublishTopicsError{Failed: failed}
+	}
+
+	return nil
+}
+
+// writeJSON writes v as JSON to the websocket within ctx, applying the write timeout (if any).
+func (c *Client) writeJSON(ctx context.Context, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.writeMessageLocked(ctx, b)
+}
+
+// writeMessageLocked writes b as a text message to the websocket, with a deadline of ctx's deadline or the write
+// timeout (whichever is sooner), aborting the write if ctx is done before it finishes. c.writeMu must be held.
+func (c *Client) writeMessageLocked(ctx context.Context, b []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline()
+	if timeout := time.Now().Add(c.writeTimeout); c.writeTimeout > 0 && (deadline.IsZero() || timeout.Before(deadline)) {
+		deadline = timeout
+	}
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		c.markBroken(err)
+		return err
+	}
+
+	var err error
+	if ctx.Done() == nil {
+		err = c.conn.WriteMessage(websocket.TextMessage, b)
+	} else {
+		err = c.writeMessageInterruptibly(ctx, b)
+	}
+	if err != nil {
+		c.markBroken(err)
+		return err
+	}
+
+	return nil
+}
+
+// writeMessageInterruptibly writes b as a text message to the websocket, moving the write deadline of the underlying
+// connection into the past to abort the write if ctx is done first. The deadline set with c.conn.SetWriteDeadline is
+// only applied to the underlying connection as each frame is written, so it is moved repeatedly until the write
+// returns, in case a frame was about to be started.
+func (c *Client) writeMessageInterruptibly(ctx context.Context, b []byte) error {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-ctx.Done():
+		case <-stop:
+			return
+		}
+
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			_ = c.conn.UnderlyingConn().SetWriteDeadline(time.Now())
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	err := c.conn.WriteMessage(websocket.TextMessage, b)
+	close(stop)
+	<-stopped // so that the deadline isn't moved during a later write
+
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err() // the write was aborted, or hit the context's deadline
+	}
+
+	return err
 }
 
 // RemoteEndpointInfo returns the broker remote endpoint UUID and version received in the initial
@@ -114,6 +777,18 @@ func (c *Client) RemoteEndpointInfo() (uuid string, version string) {
 	return c.endpointUUID, c.endpointVersion
 }
 
+// PeerCertificates returns the certificate chain that broker presented in the TLS handshake, starting with broker's
+// own certificate, e.g. to log its subject or expiry. It is nil for a plain-text connection, or if the connection
+// wasn't made with crypto/tls (as by the securetls package): the weirdtls package uses OpenSSL, and broker's default
+// configuration has no certificates anyway.
+func (c *Client) PeerCertificates() []*x509.Certificate {
+	if conn, ok := c.conn.UnderlyingConn().(interface{ ConnectionState() tls.ConnectionState }); ok {
+		return conn.ConnectionState().PeerCertificates
+	}
+
+	return nil
+}
+
 // Close closes the underlying websocket connection.
 func (c *Client) Close() error {
 	if c == nil {
@@ -122,5 +797,12 @@ func (c *Client) Close() error {
 	if c.conn == nil {
 		return errors.New("connection not open")
 	}
+	if c.closed != nil {
+		c.closeOnce.Do(func() {
+			c.logger.Debug("closing the connection to broker")
+			close(c.closed)
+			c.disconnected(nil)
+		})
+	}
 	return c.conn.Close()
 }
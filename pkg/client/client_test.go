@@ -0,0 +1,1260 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"compress/flate"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/corelight/go-zeek-broker-ws/pkg/encoding"
+	"github.com/gorilla/websocket"
+)
+
+// stubBroker is a minimal broker websocket endpoint: it reads the subscription, sends the handshake
+// ack and then hands the connection to the test's handler.
+func stubBroker(t *testing.T, handler func(conn *websocket.Conn)) string {
+	t.Helper()
+
+	return stubBrokerWithTopics(t, func(_ []string, conn *websocket.Conn) {
+		handler(conn)
+	})
+}
+
+// stubBrokerWithTopics is stubBroker, but also passes the subscribed topics to the test's handler.
+func stubBrokerWithTopics(t *testing.T, handler func(topics []string, conn *websocket.Conn)) string {
+	t.Helper()
+
+	return startStubBroker(t, httptest.NewServer, func(_ *http.Request, topics []string, conn *websocket.Conn) {
+		handler(topics, conn)
+	})
+}
+
+// startStubBroker is stubBroker, but served by newServer (e.g. httptest.NewTLSServer), and also passes the
+// handshake request and subscribed topics to the test's handler.
+func startStubBroker(t *testing.T, newServer func(http.Handler) *httptest.Server,
+	handler func(r *http.Request, topics []string, conn *websocket.Conn)) string {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{EnableCompression: true} // as broker, compression is used if the client asks
+
+	srv := newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		var topics []string
+		if err = conn.ReadJSON(&topics); err != nil {
+			t.Errorf("reading subscription failed: %v", err)
+			return
+		}
+
+		if err = conn.WriteJSON(encoding.AckMessage{
+			ConstType:    "ack",
+			EndpointUUID: "00000000-0000-0000-0000-000000000000",
+			Version:      "2.5.0",
+		}); err != nil {
+			t.Errorf("writing ack failed: %v", err)
+			return
+		}
+
+		handler(r, topics, conn)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.Listener.Addr().String()
+}
+
+func writeEvent(t *testing.T, conn *websocket.Conn, topic string, evt encoding.Event) {
+	t.Helper()
+
+	if err := conn.WriteJSON(evt.Encode(topic)); err != nil {
+		t.Errorf("writing event failed: %v", err)
+	}
+}
+
+func TestClient_ReadEvent(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		writeEvent(t, conn, "/topic/test", encoding.NewEvent("ping", encoding.Count(1)))
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	topic, evt, err := c.ReadEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if topic != "/topic/test" || evt.Name != "ping" {
+		t.Errorf("unexpected event %s on topic %s", evt, topic)
+	}
+}
+
+func TestNewClientWithOptions(t *testing.T) {
+	subscribed := make(chan []string, 1)
+	hostPort := stubBrokerWithTopics(t, func(topics []string, conn *websocket.Conn) {
+		subscribed <- topics
+		writeEvent(t, conn, "/topic/a", encoding.NewEvent("ping", encoding.Count(1)))
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClientWithOptions(context.Background(), hostPort, WithTopics("/topic/a", "/topic/b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if got, want := <-subscribed, []string{"/topic/a", "/topic/b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("subscribed to %v, want %v", got, want)
+	}
+
+	if _, evt, err := c.ReadEvent(); err != nil || evt.Name != "ping" {
+		t.Errorf("ReadEvent() = %s, %v", evt, err)
+	}
+}
+
+func TestNewClientWithOptions_defaults(t *testing.T) {
+	subscribed := make(chan []string, 1)
+	hostPort := stubBrokerWithTopics(t, func(topics []string, conn *websocket.Conn) {
+		subscribed <- topics
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClientWithOptions(context.Background(), hostPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if got := <-subscribed; got == nil || len(got) != 0 {
+		t.Errorf("subscribed to %#v, want an empty list", got)
+	}
+
+	_, err = NewClientWithOptions(context.Background(), hostPort, WithTLS(nil))
+	if !errors.Is(err, ErrTLSDialFuncNotProvided) {
+		t.Errorf("expected ErrTLSDialFuncNotProvided but got %v", err)
+	}
+}
+
+func TestClient_ReadEvent_contextCancelled(t *testing.T) {
+	release := make(chan struct{})
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		<-release // never send anything, so reads block
+	})
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, err := NewClient(ctx, hostPort, false, nil, []string{"/topic/test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, _, err = c.ReadEvent(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled but got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancellation took too long to interrupt the read (%s)", elapsed)
+	}
+
+	// subsequent reads fail the same way
+	if _, _, err = c.ReadEvent(); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled but got %v", err)
+	}
+}
+
+func TestClient_Unsubscribe(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		writeEvent(t, conn, "/topic/b", encoding.NewEvent("ping", encoding.Count(1)))
+		writeEvent(t, conn, "/topic/a/sub", encoding.NewEvent("ping", encoding.Count(2)))
+		writeEvent(t, conn, "/topic/b/sub", encoding.NewEvent("ping", encoding.Count(3)))
+		writeEvent(t, conn, "/topic/a", encoding.NewEvent("ping", encoding.Count(4)))
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/a", "/topic/b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.Unsubscribe("/topic/b", "/topic/c")
+	if got, want := c.Topics(), []string{"/topic/a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Topics() = %v, want %v", got, want)
+	}
+
+	for _, want := range []string{"/topic/a/sub", "/topic/a"} {
+		if topic, _, err := c.ReadEvent(); err != nil || topic != want {
+			t.Errorf("ReadEvent() = %s, %v, want an event on %s", topic, err, want)
+		}
+	}
+
+	c.Unsubscribe("/topic/a")
+	if got := c.Topics(); len(got) != 0 {
+		t.Errorf("Topics() = %v, want none", got)
+	}
+}
+
+func TestClient_ReadEvent_brokerError(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "error", `+
+			`"code": "deserialization_failed", "context": "input #1 contained malformed JSON"}`)); err != nil {
+			t.Errorf("writing error failed: %v", err)
+		}
+		writeEvent(t, conn, "/topic/test", encoding.NewEvent("ping", encoding.Count(1)))
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, _, err = c.ReadEvent()
+
+	var brokerErr encoding.ErrorMessage
+	if !errors.As(err, &brokerErr) {
+		t.Fatalf("expected an encoding.ErrorMessage but got %v", err)
+	}
+	if brokerErr.Code != "deserialization_failed" || brokerErr.Context != "input #1 contained malformed JSON" {
+		t.Errorf("unexpected error message %#v", brokerErr)
+	}
+
+	// the connection is still usable
+	if _, evt, err := c.ReadEvent(); err != nil || evt.Name != "ping" {
+		t.Errorf("ReadEvent() = %s, %v", evt, err)
+	}
+}
+
+func TestClient_WithHeaders(t *testing.T) {
+	// the stub broker's TLS certificate is self-signed
+	insecureDial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		d := tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}} //nolint:gosec // test server
+		return d.DialContext(ctx, network, addr)
+	}
+
+	tests := []struct {
+		name      string
+		newServer func(http.Handler) *httptest.Server
+		opts      []Option
+	}{
+		{name: "ws", newServer: httptest.NewServer},
+		{name: "wss", newServer: httptest.NewTLSServer, opts: []Option{WithTLS(insecureDial)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := make(chan http.Header, 1)
+			hostPort := startStubBroker(t, tt.newServer, func(r *http.Request, _ []string, conn *websocket.Conn) {
+				headers <- r.Header
+				_, _, _ = conn.ReadMessage()
+			})
+
+			opts := []Option{WithHeaders(http.Header{"X-Sensor": []string{"s1"}}), WithBearerToken("secret")}
+			c, err := NewClientWithOptions(context.Background(), hostPort, append(opts, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			h := <-headers
+			if got := h.Get("X-Sensor"); got != "s1" {
+				t.Errorf("X-Sensor header = %q, want %q", got, "s1")
+			}
+			if got, want := h.Get("Authorization"), "Bearer secret"; got != want {
+				t.Errorf("Authorization header = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestClient_PeerCertificates(t *testing.T) {
+	// the stub broker's TLS certificate is self-signed
+	insecureDial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		d := tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}} //nolint:gosec // test server
+		return d.DialContext(ctx, network, addr)
+	}
+
+	var srv *httptest.Server
+	newServer := func(h http.Handler) *httptest.Server {
+		srv = httptest.NewTLSServer(h)
+		return srv
+	}
+	hostPort := startStubBroker(t, newServer, func(_ *http.Request, _ []string, conn *websocket.Conn) {
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClientWithOptions(context.Background(), hostPort, WithTLS(insecureDial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	certs := c.PeerCertificates()
+	if len(certs) != 1 || !certs[0].Equal(srv.Certificate()) {
+		t.Errorf("PeerCertificates() = %v, want the server's certificate", certs)
+	}
+
+	plain, err := NewClient(context.Background(), stubBroker(t, func(conn *websocket.Conn) {
+		_, _, _ = conn.ReadMessage()
+	}), false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+
+	if certs = plain.PeerCertificates(); certs != nil {
+		t.Errorf("PeerCertificates() = %v for a plain-text connection, want nil", certs)
+	}
+}
+
+func TestClient_WithDialer(t *testing.T) {
+	// the stub broker's TLS certificate is self-signed
+	insecureDial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		d := tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}} //nolint:gosec // test server
+		return d.DialContext(ctx, network, addr)
+	}
+
+	// each client dials through its own dialer, and with its own TLS dial function, counting the connections made
+	type client struct {
+		dials, tlsDials int
+		dialer          *websocket.Dialer
+		opts            []Option
+	}
+	clients := make([]*client, 2)
+	for i := range clients {
+		cl := &client{}
+		cl.dialer = &websocket.Dialer{
+			HandshakeTimeout: 5 * time.Second,
+			NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				cl.dials++
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}
+		tlsDial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+			cl.tlsDials++
+			return insecureDial(ctx, network, addr)
+		}
+		cl.opts = []Option{WithDialer(cl.dialer), WithTLS(tlsDial)}
+		clients[i] = cl
+	}
+	// a client without WithDialer or WithTLS uses neither
+	clients = append(clients, &client{})
+
+	hostPort := startStubBroker(t, httptest.NewTLSServer, func(_ *http.Request, _ []string, conn *websocket.Conn) {
+		_, _, _ = conn.ReadMessage()
+	})
+	plainHostPort := stubBroker(t, func(conn *websocket.Conn) {
+		_, _, _ = conn.ReadMessage()
+	})
+
+	var wg sync.WaitGroup
+	for _, cl := range clients {
+		wg.Add(1)
+		go func(cl *client) {
+			defer wg.Done()
+
+			addr := hostPort
+			if cl.opts == nil {
+				addr = plainHostPort
+			}
+			c, err := NewClientWithOptions(context.Background(), addr, cl.opts...)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = c.Close()
+		}(cl)
+	}
+	wg.Wait()
+
+	for i, cl := range clients[:2] {
+		if cl.dials != 0 || cl.tlsDials != 1 {
+			t.Errorf("client %d made %d plain and %d TLS dials, want 0 and 1", i, cl.dials, cl.tlsDials)
+		}
+		if cl.dialer.NetDialTLSContext != nil {
+			t.Errorf("client %d's dialer was modified", i)
+		}
+	}
+	if websocket.DefaultDialer.NetDialTLSContext != nil {
+		t.Error("websocket.DefaultDialer was modified")
+	}
+}
+
+func TestClient_WithCompression(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want bool
+	}{
+		{name: "enabled", opts: []Option{WithCompression(flate.BestSpeed)}, want: true},
+		{name: "disabled", want: false},
+	}
+
+	evt := encoding.NewEvent("big", encoding.String(strings.Repeat("compressible ", 1000)))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostPort := startStubBroker(t, httptest.NewServer, func(r *http.Request, _ []string, conn *websocket.Conn) {
+				extensions := r.Header.Get("Sec-WebSocket-Extensions")
+				if got := strings.Contains(extensions, "permessage-deflate"); got != tt.want {
+					t.Errorf("Sec-WebSocket-Extensions = %q, want permessage-deflate: %v", extensions, tt.want)
+				}
+
+				// echo the published event back
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					t.Errorf("reading event failed: %v", err)
+					return
+				}
+				if err = conn.WriteMessage(websocket.TextMessage, data); err != nil {
+					t.Errorf("writing event failed: %v", err)
+				}
+				_, _, _ = conn.ReadMessage()
+			})
+
+			c, err := NewClientWithOptions(context.Background(), hostPort,
+				append(tt.opts, WithTopics("/topic/test"))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			if err = c.PublishEvent("/topic/test", evt); err != nil {
+				t.Fatal(err)
+			}
+			if _, got, err := c.ReadEvent(); err != nil || !reflect.DeepEqual(got, evt) {
+				t.Errorf("ReadEvent() = %s, %v, want %s", got, err, evt)
+			}
+		})
+	}
+}
+
+func TestClient_WithCompression_invalidLevel(t *testing.T) {
+	_, err := NewClientWithOptions(context.Background(), "localhost:1", WithCompression(flate.BestCompression+1))
+	if err == nil || !strings.Contains(err.Error(), "invalid compression level") {
+		t.Errorf("expected an invalid compression level error but got %v", err)
+	}
+}
+
+func TestClient_ReadMessage(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		if err := conn.WriteJSON(encoding.NewDataMessage("/topic/test", encoding.String("plain"))); err != nil {
+			t.Errorf("writing data failed: %v", err)
+		}
+		writeEvent(t, conn, "/topic/test", encoding.NewEvent("ping", encoding.Count(1)))
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	msg, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.IsEvent() || msg.Topic != "/topic/test" || !msg.Data.Equal(encoding.String("plain")) {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	if msg, err = c.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	if _, evt, err := msg.GetEvent(); !msg.IsEvent() || err != nil || evt.Name != "ping" {
+		t.Errorf("GetEvent() = %s, %v", evt, err)
+	}
+}
+
+func TestClient_ReadMessage_binary(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		if err := conn.WriteMessage(websocket.BinaryMessage, []byte{0x01, 0x02}); err != nil {
+			t.Errorf("writing binary message failed: %v", err)
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.ReadMessage()
+
+	var typeErr UnexpectedMessageTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("expected an UnexpectedMessageTypeError but got %v", err)
+	}
+
+	if typeErr.MessageType != websocket.BinaryMessage {
+		t.Errorf("expected message type %d but got %d", websocket.BinaryMessage, typeErr.MessageType)
+	}
+
+	if !strings.Contains(err.Error(), "binary") {
+		t.Errorf("error message is not descriptive: %s", err)
+	}
+}
+
+func TestClient_ReadRawMessage(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		if err := conn.WriteMessage(websocket.BinaryMessage, []byte{0x01, 0x02}); err != nil {
+			t.Errorf("writing binary message failed: %v", err)
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	messageType, payload, err := c.ReadRawMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if messageType != websocket.BinaryMessage || len(payload) != 2 {
+		t.Errorf("unexpected message type %d with payload %v", messageType, payload)
+	}
+}
+
+func TestClient_LastEvent(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		writeEvent(t, conn, "/topic/a", encoding.NewEvent("ping", encoding.Count(1)))
+		writeEvent(t, conn, "/topic/b", encoding.NewEvent("ping", encoding.Count(2)))
+		writeEvent(t, conn, "/topic/a", encoding.NewEvent("ping", encoding.Count(3)))
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/a", "/topic/b"},
+		WithLastEventCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, ok := c.LastEvent("/topic/a"); ok {
+		t.Fatal("cache should be empty before any events are received")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan struct{}, 3)
+	AsyncSubscription(ctx, c, func(topic string, event encoding.Event) {
+		received <- struct{}{}
+	}, func(err error) {
+		t.Error(err)
+	})
+
+	for i := 0; i < 3; i++ {
+		<-received
+	}
+
+	for topic, want := range map[string]uint64{"/topic/a": 3, "/topic/b": 2} {
+		evt, ok := c.LastEvent(topic)
+		if !ok {
+			t.Fatalf("no cached event for %s", topic)
+		}
+
+		if got := evt.Arguments[0].DataValue; got != want {
+			t.Errorf("cached event for %s has argument %v, want %d", topic, got, want)
+		}
+	}
+
+	if _, ok := c.LastEvent("/topic/c"); ok {
+		t.Error("unexpected cached event for /topic/c")
+	}
+}
+
+func TestClient_LastEvent_disabled(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		writeEvent(t, conn, "/topic/a", encoding.NewEvent("ping", encoding.Count(1)))
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, _, err = c.ReadEvent(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.LastEvent("/topic/a"); ok {
+		t.Error("cache should be disabled by default")
+	}
+}
+
+func TestAsyncSubscription_WithEventFilter(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		writeEvent(t, conn, "/topic/a", encoding.NewEvent("keep", encoding.Count(1)))
+		writeEvent(t, conn, "/topic/a", encoding.NewEvent("drop", encoding.Count(2)))
+		writeEvent(t, conn, "/topic/b", encoding.NewEvent("keep", encoding.Count(3)))
+		writeEvent(t, conn, "/topic/a", encoding.NewEvent("keep", encoding.Count(4)))
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/a", "/topic/b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan uint64, 4)
+	AsyncSubscription(ctx, c, func(topic string, event encoding.Event) {
+		n, _ := event.Arguments[0].DataValue.(uint64)
+		received <- n
+	}, func(err error) {
+		t.Error(err)
+	}, WithEventFilter(func(topic string, event encoding.Event) bool {
+		return topic == "/topic/a" && event.Name == "keep"
+	}))
+
+	for _, want := range []uint64{1, 4} {
+		if got := <-received; got != want {
+			t.Errorf("received event with argument %d, want %d", got, want)
+		}
+	}
+}
+
+func TestAsyncSubscription_WithQueue(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		policy     OverflowPolicy
+		want       []uint64
+		wantErrors int
+	}{
+		{name: "block", size: 10, policy: OverflowBlock, want: []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{name: "drop oldest", size: 2, policy: OverflowDropOldest, want: []uint64{0, 8, 9}},
+		{name: "error", size: 2, policy: OverflowError, want: []uint64{0, 1, 2}, wantErrors: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sendRest := make(chan struct{})
+			hostPort := stubBroker(t, func(conn *websocket.Conn) {
+				writeEvent(t, conn, "/topic/test", encoding.NewEvent("seq", encoding.Count(0)))
+				<-sendRest
+				for i := uint64(1); i < 10; i++ {
+					writeEvent(t, conn, "/topic/test", encoding.NewEvent("seq", encoding.Count(i)))
+				}
+				_ = conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocketNormalEOFCode, ""))
+				_, _, _ = conn.ReadMessage()
+			})
+
+			c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"},
+				WithLastEventCache())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			// the handler is held up by the first event until the rest have been read
+			started, release := make(chan struct{}), make(chan struct{})
+			var received []uint64
+			var queueFull atomic.Int32
+			sub := AsyncSubscription(context.Background(), c, func(topic string, event encoding.Event) {
+				n, _ := event.Arguments[0].DataValue.(uint64)
+				if n == 0 {
+					close(started)
+					<-release
+				}
+				received = append(received, n)
+			}, func(err error) {
+				if errors.Is(err, ErrQueueFull) {
+					queueFull.Add(1)
+				}
+			}, WithQueue(tt.size, tt.policy))
+
+			<-started
+			close(sendRest)
+			for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+				if evt, ok := c.LastEvent("/topic/test"); ok && evt.Arguments[0].Equal(encoding.Count(9)) {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("the events weren't read while the handler was busy")
+				}
+			}
+			close(release)
+
+			waitDone(t, sub)
+			if err = sub.Err(); err != nil {
+				t.Errorf("subscription ended with %v", err)
+			}
+			if !reflect.DeepEqual(received, tt.want) {
+				t.Errorf("received %v, want %v", received, tt.want)
+			}
+			if got := int(queueFull.Load()); got != tt.wantErrors {
+				t.Errorf("got %d ErrQueueFull errors, want %d", got, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestAsyncSubscription_Done(t *testing.T) {
+	t.Run("normal close", func(t *testing.T) {
+		hostPort := stubBroker(t, func(conn *websocket.Conn) {
+			_ = conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			_, _, _ = conn.ReadMessage()
+		})
+
+		c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		sub := AsyncSubscription(context.Background(), c, func(string, encoding.Event) {}, nil)
+		waitDone(t, sub)
+		if err = sub.Err(); err != nil {
+			t.Errorf("Err() = %v, want nil", err)
+		}
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		release := make(chan struct{})
+		hostPort := stubBroker(t, func(conn *websocket.Conn) {
+			<-release
+		})
+		defer close(release)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		c, err := NewClient(ctx, hostPort, false, nil, []string{"/topic/test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		sub := AsyncSubscription(context.Background(), c, func(string, encoding.Event) {}, nil)
+		if err = sub.Err(); err != nil {
+			t.Errorf("Err() = %v before the loop exited", err)
+		}
+
+		cancel()
+		waitDone(t, sub)
+		if err = sub.Err(); !errors.Is(err, context.Canceled) {
+			t.Errorf("Err() = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		release := make(chan struct{})
+		hostPort := stubBroker(t, func(conn *websocket.Conn) {
+			<-release
+		})
+		defer close(release)
+
+		c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sub := AsyncSubscription(context.Background(), c, func(string, encoding.Event) {}, func(err error) {
+			t.Errorf("unexpected error %v", err)
+		})
+
+		_ = c.Close()
+		waitDone(t, sub)
+		if err = sub.Err(); err != nil {
+			t.Errorf("Err() = %v, want nil", err)
+		}
+	})
+}
+
+func waitDone(t *testing.T, sub *Subscription) {
+	t.Helper()
+
+	select {
+	case <-sub.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("subscription didn't exit")
+	}
+}
+
+func TestClient_Events(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		writeEvent(t, conn, "/topic/a", encoding.NewEvent("keep", encoding.Count(1)))
+		writeEvent(t, conn, "/topic/a", encoding.NewEvent("drop", encoding.Count(2)))
+		if err := conn.WriteJSON(encoding.ErrorMessage{
+			ConstType: "error",
+			Code:      "deserialization_failed",
+			Context:   "input #1 contained malformed JSON",
+		}); err != nil {
+			t.Errorf("writing error failed: %v", err)
+		}
+		writeEvent(t, conn, "/topic/a", encoding.NewEvent("keep", encoding.Count(3)))
+		_ = conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	events := c.Events(context.Background(), WithBufferSize(1),
+		WithEventFilter(func(topic string, event encoding.Event) bool {
+			return event.Name == "keep"
+		}))
+
+	var got []string
+	for e := range events {
+		if e.Err != nil {
+			got = append(got, e.Err.Error())
+		} else {
+			got = append(got, e.Event.String())
+		}
+	}
+
+	want := []string{
+		"event keep(count(1))",
+		`broker error code="deserialization_failed" context="input #1 contained malformed JSON"`,
+		"event keep(count(3))",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("received %q, want %q", got, want)
+	}
+}
+
+func TestClient_WithWriteTimeout(t *testing.T) {
+	release := make(chan struct{})
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		// Never read, so the client's writes eventually block once the socket buffers are full.
+		<-release
+	})
+	defer close(release)
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"},
+		WithWriteTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	evt := encoding.NewEvent("big", encoding.String(strings.Repeat("x", 1<<20)))
+
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		if err = c.PublishEvent("/topic/test", evt); err != nil {
+			break
+		}
+	}
+
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected a timeout error but got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("write deadline took too long to fire (%s)", elapsed)
+	}
+}
+
+func TestClient_PublishEventContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		makeCtx func() (context.Context, context.CancelFunc)
+		want    error
+	}{
+		{
+			name: "cancelled",
+			makeCtx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(100*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			want: context.Canceled,
+		},
+		{
+			name: "deadline",
+			makeCtx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 100*time.Millisecond)
+			},
+			want: context.DeadlineExceeded,
+		},
+	}
+
+	evt := encoding.NewEvent("big", encoding.String(strings.Repeat("x", 1<<20)))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			hostPort := stubBroker(t, func(conn *websocket.Conn) {
+				// Never read, so the client's writes eventually block once the socket buffers are full.
+				<-release
+			})
+			defer close(release)
+
+			c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			ctx, cancel := tt.makeCtx()
+			defer cancel()
+
+			start := time.Now()
+			for i := 0; i < 1000; i++ {
+				if err = c.PublishEventContext(ctx, "/topic/test", evt); err != nil {
+					break
+				}
+			}
+
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v but got %v", tt.want, err)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("write took too long to be aborted (%s)", elapsed)
+			}
+		})
+	}
+}
+
+func TestClient_PublishEventContext_alreadyDone(t *testing.T) {
+	received := make(chan string, 1)
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Errorf("reading event failed: %v", err)
+		}
+		received <- string(data)
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = c.PublishEventContext(ctx, "/topic/test", encoding.NewEvent("dropped")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled but got %v", err)
+	}
+
+	// nothing was sent, so the connection is still usable
+	if err = c.PublishEvent("/topic/test", encoding.NewEvent("sent")); err != nil {
+		t.Fatal(err)
+	}
+	if data := <-received; !strings.Contains(data, "sent") {
+		t.Errorf("unexpected message %s", data)
+	}
+}
+
+func TestClient_WithReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		<-release // never send anything, as if the peer had vanished
+	})
+	defer close(release)
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"},
+		WithReadTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	_, _, err = c.ReadEvent()
+
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected a timeout error but got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("read deadline took too long to fire (%s)", elapsed)
+	}
+}
+
+func TestClient_PublishEvent_concurrent(t *testing.T) {
+	const publishers, events = 20, 50
+
+	received := make(chan uint64, publishers*events)
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		for i := 0; i < publishers*events; i++ {
+			var msg encoding.DataMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Errorf("reading message %d failed: %v", i, err)
+				return
+			}
+
+			_, evt, err := msg.GetEvent()
+			if err != nil {
+				t.Errorf("message %d is not an event: %v", i, err)
+				return
+			}
+			n, _ := evt.Arguments[0].DataValue.(uint64)
+			received <- n
+		}
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < events; i++ {
+				n := uint64(p*events + i)
+				if err := c.PublishEvent("/topic/test", encoding.NewEvent("ping", encoding.Count(n))); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	seen := make(map[uint64]bool)
+	for i := 0; i < publishers*events; i++ {
+		select {
+		case n := <-received:
+			if seen[n] {
+				t.Errorf("event %d received twice", n)
+			}
+			seen[n] = true
+		case <-time.After(10 * time.Second):
+			t.Fatalf("received only %d of %d events", i, publishers*events)
+		}
+	}
+}
+
+func TestClient_PublishEvents(t *testing.T) {
+	received := make(chan uint64, 3)
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		for {
+			var msg encoding.DataMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+
+			_, evt, err := msg.GetEvent()
+			if err != nil {
+				t.Errorf("message is not an event: %v", err)
+				return
+			}
+			n, _ := evt.Arguments[0].DataValue.(uint64)
+			received <- n
+		}
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.PublishEvents("/topic/test", []encoding.Event{
+		encoding.NewEvent("ping", encoding.Count(1)),
+		encoding.NewEvent("ping", encoding.Count(2)),
+		encoding.NewEvent("ping", encoding.Real(math.NaN())), // can't be encoded as JSON
+		encoding.NewEvent("ping", encoding.Count(4)),
+	})
+
+	var pubErr PublishError
+	if !errors.As(err, &pubErr) || pubErr.Index != 2 {
+		t.Fatalf("expected a PublishError for event 2 but got %v", err)
+	}
+
+	// the events before the failure were published in order, and the client is still usable
+	if err = c.PublishEvent("/topic/test", encoding.NewEvent("ping", encoding.Count(5))); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []uint64{1, 2, 5} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("received event %d, want %d", got, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("event %d not received", want)
+		}
+	}
+}
+
+func TestClient_PublishToTopics(t *testing.T) {
+	received := make(chan string, 2)
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		for {
+			var msg encoding.DataMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+
+			topic, evt, err := msg.GetEvent()
+			if err != nil || evt.Name != "ping" {
+				t.Errorf("GetEvent() = %s, %v", evt, err)
+				return
+			}
+			received <- topic
+		}
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	topics := []string{"/topic/a", "/topic/b"}
+	evt := encoding.NewEvent("ping", encoding.String(strings.Repeat("x", 1024)))
+	if err = c.PublishToTopics(topics, evt); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range topics {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("received event on %s, want %s", got, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("event on %s not received", want)
+		}
+	}
+
+	_ = c.Close()
+
+	err = c.PublishToTopics(topics, evt)
+	var pubErr PublishTopicsError
+	if !errors.As(err, &pubErr) || len(pubErr.Failed) != 2 || pubErr.Failed[0].Topic != "/topic/a" ||
+		pubErr.Failed[1].Topic != "/topic/b" {
+		t.Fatalf("expected a PublishTopicsError for both topics but got %v", err)
+	}
+	if !errors.Is(err, net.ErrClosed) {
+		t.Errorf("expected the error to wrap net.ErrClosed but got %v", err)
+	}
+}
+
+func TestClient_WithMaxMessageSize(t *testing.T) {
+	closeCode := make(chan int, 1)
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		writeEvent(t, conn, "/topic/test", encoding.NewEvent("big", encoding.String(strings.Repeat("x", 4096))))
+
+		_, _, err := conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) {
+			closeCode <- closeErr.Code
+		}
+		close(closeCode)
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"},
+		WithMaxMessageSize(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, _, err = c.ReadEvent()
+	if !errors.Is(err, websocket.ErrReadLimit) || !strings.Contains(err.Error(), "maximum size of 1024 bytes") {
+		t.Fatalf("expected a read limit error but got %v", err)
+	}
+
+	if got := <-closeCode; got != websocket.CloseMessageTooBig {
+		t.Errorf("connection closed with code %d, want %d", got, websocket.CloseMessageTooBig)
+	}
+}
+
+func TestClient_LastError(t *testing.T) {
+	for _, clearOnRead := range []bool{false, true} {
+		t.Run(fmt.Sprintf("clearOnRead=%t", clearOnRead), func(t *testing.T) {
+			hostPort := stubBroker(t, func(conn *websocket.Conn) {
+				if err := conn.WriteJSON(encoding.ErrorMessage{
+					ConstType: "error",
+					Code:      "deserialization_failed",
+					Context:   "input #1 contained malformed JSON",
+				}); err != nil {
+					t.Errorf("writing error failed: %v", err)
+				}
+				writeEvent(t, conn, "/topic/test", encoding.NewEvent("ping", encoding.Count(1)))
+				_, _, _ = conn.ReadMessage()
+			})
+
+			var opts []Option
+			if clearOnRead {
+				opts = append(opts, WithLastErrorClearedOnRead())
+			}
+
+			c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"}, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			if err = c.LastError(); err != nil {
+				t.Fatalf("unexpected error before any reads: %v", err)
+			}
+
+			if _, _, err = c.ReadEvent(); err == nil {
+				t.Fatal("expected an error from broker")
+			}
+
+			var brokerErr encoding.ErrorMessage
+			if !errors.As(c.LastError(), &brokerErr) || brokerErr.Code != "deserialization_failed" {
+				t.Fatalf("LastError() = %v, want the broker error", c.LastError())
+			}
+
+			if _, _, err = c.ReadEvent(); err != nil {
+				t.Fatal(err)
+			}
+
+			if cleared := c.LastError() == nil; cleared != clearOnRead {
+				t.Errorf("LastError() = %v after a successful read", c.LastError())
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrKeepaliveTimeout is returned by reads once the connection has been closed because broker didn't answer a
+// keepalive ping in time, see WithKeepalive.
+var ErrKeepaliveTimeout = errors.New("no pong received from broker within the keepalive timeout")
+
+// ErrIdleTimeout is wrapped by the error returned by a read once no message or pong has been received from broker
+// within the idle timeout, see WithIdleTimeout.
+var ErrIdleTimeout = errors.New("nothing received from broker within the idle timeout")
+
+// errPingNotSent is wrapped (with context.DeadlineExceeded) by the error returned by Ping when ctx's deadline passes
+// before the ping could be written, e.g. while a long publish holds the connection.
+var errPingNotSent = errors.New("ping not sent")
+
+// Ping sends a websocket ping to broker and waits for the matching pong, returning an error if the ping can't be
+// sent, or ctx's error if it is done first (so ctx should have a deadline). If the deadline passes before the ping
+// could be written (because other writes held the connection), the error wraps context.DeadlineExceeded, and the
+// connection remains usable. Pongs are only processed while a read is
+// in progress, so the client must be read from concurrently (e.g. by AsyncSubscription); Ping doesn't read itself,
+// so that it can't consume any messages. Ping is safe to call concurrently with reads, publishes, other pings and
+// the keepalive (see WithKeepalive), each of which waits for its own pong.
+func (c *Client) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	payload := strconv.FormatUint(c.pingSeq.Add(1), 10)
+
+	pong := make(chan struct{})
+	c.pongMu.Lock()
+	c.pongWaiters[payload] = pong
+	c.pongMu.Unlock()
+
+	defer func() {
+		c.pongMu.Lock()
+		delete(c.pongWaiters, payload)
+		c.pongMu.Unlock()
+	}()
+
+	deadline, _ := ctx.Deadline() // no deadline if zero
+	if err := c.conn.WriteControl(websocket.PingMessage, []byte(payload), deadline); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// gorilla/websocket gives up without writing anything once the deadline has passed, including while
+			// waiting for another write to finish, which says nothing about the connection. (Should the write
+			// itself have timed out, gorilla/websocket fails the next publish, which marks the connection broken.)
+			return fmt.Errorf("%w: %w", errPingNotSent, context.DeadlineExceeded)
+		}
+		c.markBroken(err)
+		return err
+	}
+
+	select {
+	case <-pong:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return net.ErrClosed
+	}
+}
+
+// handlePong is the pong handler of the websocket, which wakes up the Ping waiting for the pong's payload (if any),
+// and restarts the idle timeout.
+func (c *Client) handlePong(payload string) error {
+	c.extendIdleTimeout()
+
+	c.pongMu.Lock()
+	defer c.pongMu.Unlock()
+
+	if pong, ok := c.pongWaiters[payload]; ok {
+		close(pong)
+		delete(c.pongWaiters, payload)
+	}
+	return nil
+}
+
+// extendIdleTimeout restarts the idle timeout (if any) of the read in progress, since a frame has been received,
+// without going beyond its read timeout. As setReadDeadline, it doesn't extend the deadline once the client's
+// context is done.
+func (c *Client) extendIdleTimeout() {
+	if c.idleTimeout <= 0 {
+		return
+	}
+
+	c.readDeadlineMu.Lock()
+	defer c.readDeadlineMu.Unlock()
+
+	if c.ctx.Err() != nil {
+		return
+	}
+
+	c.idleTimeoutDue = time.Now().Add(c.idleTimeout)
+	_ = c.conn.SetReadDeadline(c.readDeadlineLocked())
+}
+
+// isIdleTimeout reports whether err is a read timing out because of the idle timeout, rather than the read timeout.
+func (c *Client) isIdleTimeout(err error) bool {
+	var netErr net.Error
+	if c.idleTimeout <= 0 || !errors.As(err, &netErr) || !netErr.Timeout() {
+		return false
+	}
+
+	c.readDeadlineMu.Lock()
+	defer c.readDeadlineMu.Unlock()
+
+	return c.readDeadlineLocked().Equal(c.idleTimeoutDue)
+}
+
+// startKeepalive pings broker every interval, and closes the connection if a pong doesn't arrive within timeout
+// of a ping. As for Ping, the client must be read from continuously for the keepalive to succeed.
+func (c *Client) startKeepalive(interval, timeout time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-c.closed:
+				return
+			case <-c.ctx.Done():
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(c.ctx, timeout)
+			err := c.Ping(ctx)
+			cancel()
+
+			switch {
+			case err == nil, errors.Is(err, errPingNotSent):
+				// A ping that couldn't be sent in time (e.g. behind a long publish) is retried at the next tick.
+			case errors.Is(err, context.DeadlineExceeded) && c.ctx.Err() == nil:
+				c.keepaliveFailed.Store(true)
+				_ = c.conn.Close()
+				return
+			default:
+				return // the client is closed or its connection has failed, which the next read reports
+			}
+		}
+	}()
+}
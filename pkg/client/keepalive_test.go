@@ -0,0 +1,284 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/corelight/go-zeek-broker-ws/pkg/encoding"
+	"github.com/gorilla/websocket"
+)
+
+func TestClient_WithKeepalive(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		// Reading makes gorilla/websocket answer the client's pings.
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		time.Sleep(300 * time.Millisecond)
+		writeEvent(t, conn, "/topic/test", encoding.NewEvent("ping", encoding.Count(1)))
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"},
+		WithKeepalive(20*time.Millisecond, 100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, evt, err := c.ReadEvent(); err != nil || evt.Name != "ping" {
+		t.Errorf("ReadEvent() = %s, %v", evt, err)
+	}
+}
+
+func TestClient_WithKeepalive_timeout(t *testing.T) {
+	release := make(chan struct{})
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		<-release // never read, so the client's pings go unanswered
+	})
+	defer close(release)
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"},
+		WithKeepalive(20*time.Millisecond, 100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	errs := make(chan error, 1)
+	AsyncSubscription(context.Background(), c, func(topic string, event encoding.Event) {
+		t.Errorf("unexpected event %s", event)
+	}, func(err error) {
+		errs <- err
+	})
+
+	select {
+	case err = <-errs:
+		if !errors.Is(err, ErrKeepaliveTimeout) {
+			t.Errorf("expected ErrKeepaliveTimeout but got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("keepalive didn't time out")
+	}
+}
+
+func TestClient_WithIdleTimeout(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		// Reading makes gorilla/websocket answer the client's pings.
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		time.Sleep(300 * time.Millisecond)
+		writeEvent(t, conn, "/topic/test", encoding.NewEvent("ping", encoding.Count(1)))
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	// the pongs keep the connection alive for longer than the idle timeout
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"},
+		WithKeepalive(20*time.Millisecond, 100*time.Millisecond), WithIdleTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, evt, err := c.ReadEvent(); err != nil || evt.Name != "ping" {
+		t.Errorf("ReadEvent() = %s, %v", evt, err)
+	}
+}
+
+func TestClient_WithIdleTimeout_timeout(t *testing.T) {
+	release := make(chan struct{})
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		<-release // send nothing
+	})
+	defer close(release)
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"},
+		WithIdleTimeout(100*time.Millisecond), WithReadTimeout(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	_, _, err = c.ReadEvent()
+	if !errors.Is(err, ErrIdleTimeout) {
+		t.Errorf("expected ErrIdleTimeout but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("idle timeout took too long to fire (%s)", elapsed)
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		_, _, _ = conn.ReadMessage() // reading makes gorilla/websocket answer the client's pings
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"},
+		WithKeepalive(10*time.Millisecond, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// a concurrent reader is needed to process the pongs
+	events := c.Events(ctx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Ping(ctx); err != nil {
+				t.Errorf("Ping() = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event or error %+v", e)
+	default:
+	}
+}
+
+func TestClient_Ping_timeout(t *testing.T) {
+	release := make(chan struct{})
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		<-release // never read, so the client's pings go unanswered
+	})
+	defer close(release)
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_ = c.Events(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err = c.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded but got %v", err)
+	}
+}
+
+func TestClient_Ping_alreadyDone(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		_, _, _ = conn.ReadMessage()
+	})
+
+	var disconnects atomic.Int32
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"},
+		WithOnDisconnect(func(error) { disconnects.Add(1) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_ = c.Events(context.Background())
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	if err = c.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded but got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err = c.Ping(ctx); err != nil {
+		t.Errorf("Ping() after an expired ping = %v", err)
+	}
+	if c.broken.Load() || disconnects.Load() != 0 {
+		t.Error("an expired ping marked the connection broken")
+	}
+}
+
+func TestClient_Ping_behindPublish(t *testing.T) {
+	release := make(chan struct{})
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		_ = conn.UnderlyingConn().(*net.TCPConn).SetReadBuffer(64 << 10)
+		<-release // don't read until released, so that a large publish blocks
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	var disconnects atomic.Int32
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{"/topic/test"},
+		WithOnDisconnect(func(error) { disconnects.Add(1) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_ = c.Events(context.Background())
+	_ = c.conn.UnderlyingConn().(*net.TCPConn).SetWriteBuffer(64 << 10)
+
+	published := make(chan error, 1)
+	go func() {
+		// far more than the socket buffers hold, so the publish holds the connection until broker reads
+		published <- c.PublishEvent("/topic/test", encoding.NewEvent("big", encoding.String(strings.Repeat("x", 4<<20))))
+	}()
+
+	// Pings are sent (and go unanswered) until the socket buffers fill and the publish blocks.
+	for i := 0; ; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err = c.Ping(ctx)
+		cancel()
+
+		if errors.Is(err, errPingNotSent) {
+			break
+		}
+		if !errors.Is(err, context.DeadlineExceeded) || i == 100 {
+			t.Fatalf("expected the ping not to be sent in time but got %v", err)
+		}
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded but got %v", err)
+	}
+
+	close(release)
+	if err = <-published; err != nil {
+		t.Fatalf("PublishEvent() = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err = c.Ping(ctx); err != nil {
+		t.Errorf("Ping() after the publish = %v", err)
+	}
+	if c.broken.Load() || disconnects.Load() != 0 {
+		t.Error("a ping waiting for a publish marked the connection broken")
+	}
+}
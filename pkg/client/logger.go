@@ -0,0 +1,62 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/gorilla/websocket"
+)
+
+// Logger receives the client's log messages, see WithLogger. Each message is accompanied by alternating keys and
+// values (e.g. "error", err), as for log/slog, whose *slog.Logger implements Logger.
+//
+// The client logs connection lifecycle events (connecting, disconnecting and reconnecting) at Info, failures that it
+// recovers from or reports (such as a failed connection, or an error from broker) at Warn, and detail that is only
+// useful when debugging at Debug. Nothing is logged per message read or published.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// markBroken records that the connection has failed with err, which gorilla/websocket can't recover from, and logs
+// the first failure.
+func (c *Client) markBroken(err error) {
+	if !c.broken.CompareAndSwap(false, true) {
+		return
+	}
+
+	switch {
+	case c.ctx.Err() != nil, errors.Is(err, net.ErrClosed):
+		c.logger.Debug("connection to broker closed", "error", err)
+	case websocket.IsCloseError(err, websocketNormalEOFCode):
+		c.logger.Info("broker closed the connection")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		c.logger.Debug("write to broker aborted", "error", err)
+	default:
+		c.logger.Warn("connection to broker failed", "error", err)
+	}
+
+	c.disconnected(err)
+}
+
+// disconnected calls the disconnect callback (see WithOnDisconnect), if this is the first failure of the connection
+// or it is being closed.
+func (c *Client) disconnected(err error) {
+	c.disconnectOnce.Do(func() {
+		if c.onDisconnect != nil {
+			c.onDisconnect(err)
+		}
+	})
+}
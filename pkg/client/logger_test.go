@@ -0,0 +1,89 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/corelight/go-zeek-broker-ws/pkg/encoding"
+	"github.com/gorilla/websocket"
+)
+
+// recordingLogger records each message logged, prefixed with its level.
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) log(level, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.messages = append(l.messages, fmt.Sprintf("%s %s", level, msg))
+}
+
+func (l *recordingLogger) Debug(msg string, _ ...interface{}) { l.log("DEBUG", msg) }
+func (l *recordingLogger) Info(msg string, _ ...interface{})  { l.log("INFO", msg) }
+func (l *recordingLogger) Warn(msg string, _ ...interface{})  { l.log("WARN", msg) }
+func (l *recordingLogger) Error(msg string, _ ...interface{}) { l.log("ERROR", msg) }
+
+func (l *recordingLogger) contains(message string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, m := range l.messages {
+		if m == message {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWithLogger(t *testing.T) {
+	var connections atomic.Int32
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		if connections.Add(1) == 1 {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "error", `+
+				`"code": "deserialization_failed", "context": "input #1 contained malformed JSON"}`)); err != nil {
+				t.Errorf("writing error failed: %v", err)
+			}
+			return // then drop the first connection, as if zeek restarted
+		}
+
+		writeEvent(t, conn, "/topic/test", encoding.NewEvent("ping", encoding.Count(1)))
+		_, _, _ = conn.ReadMessage()
+	})
+
+	logger := &recordingLogger{}
+	c, err := NewReconnectingClient(context.Background(), hostPort,
+		[]Option{WithTopics("/topic/test"), WithLogger(logger)}, WithBackoff(10*time.Millisecond, 100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = c.ReadEvent(); err == nil {
+		t.Fatal("expected the error from broker")
+	}
+	if _, evt, err := c.ReadEvent(); err != nil || evt.Name != "ping" {
+		t.Fatalf("ReadEvent() = %s, %v", evt, err)
+	}
+	_ = c.Close()
+
+	for _, want := range []string{
+		"INFO connected to broker",
+		"WARN broker reported an error",
+		"WARN connection to broker failed",
+		"INFO reconnecting to broker",
+		"INFO reconnected to broker",
+		"DEBUG closing the connection to broker",
+	} {
+		if !logger.contains(want) {
+			t.Errorf("%q wasn't logged, got %q", want, logger.messages)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+// Metrics receives the client's counters, see WithMetrics, e.g. to export them to Prometheus. Its methods are called
+// synchronously on the hot path (so they should be quick, and mustn't call back into the client), possibly from
+// several goroutines at once. Embed NopMetrics to implement only some of them.
+type Metrics interface {
+	// EventRead is called for each event read by ReadEvent, and so for each event received by AsyncSubscription and
+	// Client.Events, before it is filtered by WithEventFilter. Events skipped because of Unsubscribe aren't counted.
+	// ReadMessage and ReadRawMessage don't call it.
+	EventRead(topic string)
+
+	// Published is called for each message published to topic by PublishEvent, PublishEventContext and PublishData
+	// (and so by TopicPublisher), with err being nil if it was written, or why not. PublishEvents calls it for each
+	// event in the batch up to and including the first that fails, and PublishToTopics for each topic.
+	Published(topic string, err error)
+
+	// DecodeError is called when a message from broker can't be decoded as JSON (by ReadMessage), or as an event (by
+	// ReadEvent), with the error that is returned by the read.
+	DecodeError(err error)
+
+	// Reconnected is called each time a ReconnectingClient has replaced a failed connection.
+	Reconnected()
+
+	// QueueDepth is called each time an event is passed to the queue of AsyncSubscription (see WithQueue), once the
+	// overflow policy has been applied, with the number of events then waiting in the queue.
+	QueueDepth(depth int)
+}
+
+// NopMetrics implements Metrics by doing nothing. It is the default, and can be embedded in an implementation of
+// Metrics that only needs some of the methods.
+type NopMetrics struct{}
+
+// EventRead implements Metrics by doing nothing.
+func (NopMetrics) EventRead(string) {}
+
+// Published implements Metrics by doing nothing.
+func (NopMetrics) Published(string, error) {}
+
+// DecodeError implements Metrics by doing nothing.
+func (NopMetrics) DecodeError(error) {}
+
+// Reconnected implements Metrics by doing nothing.
+func (NopMetrics) Reconnected() {}
+
+// QueueDepth implements Metrics by doing nothing.
+func (NopMetrics) QueueDepth(int) {}
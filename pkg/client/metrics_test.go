@@ -0,0 +1,95 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/corelight/go-zeek-broker-ws/pkg/encoding"
+	"github.com/gorilla/websocket"
+)
+
+// countingMetrics counts the calls to each of its methods, except QueueDepth.
+type countingMetrics struct {
+	NopMetrics
+	eventsRead, published, publishFailed, decodeErrors, reconnects atomic.Int32
+}
+
+func (m *countingMetrics) EventRead(string)  { m.eventsRead.Add(1) }
+func (m *countingMetrics) DecodeError(error) { m.decodeErrors.Add(1) }
+func (m *countingMetrics) Reconnected()      { m.reconnects.Add(1) }
+
+func (m *countingMetrics) Published(_ string, err error) {
+	if err != nil {
+		m.publishFailed.Add(1)
+	} else {
+		m.published.Add(1)
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	var connections atomic.Int32
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		if connections.Add(1) == 1 {
+			writeEvent(t, conn, "/topic/test", encoding.NewEvent("ping", encoding.Count(1)))
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "data-message", `)); err != nil {
+				t.Errorf("writing invalid JSON failed: %v", err)
+			}
+			if err := conn.WriteJSON(encoding.NewDataMessage("/topic/test", encoding.Count(1))); err != nil {
+				t.Errorf("writing data failed: %v", err)
+			}
+			return // then drop the first connection, as if zeek restarted
+		}
+
+		writeEvent(t, conn, "/topic/test", encoding.NewEvent("ping", encoding.Count(2)))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	metrics := &countingMetrics{}
+	c, err := NewReconnectingClient(context.Background(), hostPort,
+		[]Option{WithTopics("/topic/test"), WithMetrics(metrics)}, WithBackoff(10*time.Millisecond, 100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 4; i++ {
+		_, _, err = c.ReadEvent() // an event, two errors, and (after reconnecting) another event
+		if wantErr := i == 1 || i == 2; (err != nil) != wantErr {
+			t.Errorf("read %d: ReadEvent() error = %v", i, err)
+		}
+	}
+
+	if err = c.PublishEvent("/topic/test", encoding.NewEvent("pong")); err != nil {
+		t.Fatal(err)
+	}
+	err = c.Client().PublishEvents("/topic/test", []encoding.Event{
+		encoding.NewEvent("pong"), encoding.NewEvent("bad", encoding.Real(math.NaN())), encoding.NewEvent("unsent"),
+	})
+	if err == nil {
+		t.Error("expected PublishEvents to fail")
+	}
+
+	for _, count := range []struct {
+		name      string
+		got, want int32
+	}{
+		{name: "events read", got: metrics.eventsRead.Load(), want: 2},
+		{name: "decode errors", got: metrics.decodeErrors.Load(), want: 2},
+		{name: "reconnects", got: metrics.reconnects.Load(), want: 1},
+		{name: "published", got: metrics.published.Load(), want: 2},
+		{name: "publish errors", got: metrics.publishFailed.Load(), want: 1},
+	} {
+		if count.got != count.want {
+			t.Errorf("%s = %d, want %d", count.name, count.got, count.want)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Option configures optional behaviour of a Client when passed to NewClient or NewClientWithOptions. Each option
+// documents its default, which applies when it isn't given.
+type Option func(*options)
+
+type options struct {
+	secure      bool
+	tlsDialFunc TLSDialFunc
+	dialer      *websocket.Dialer
+	proxy       func(*http.Request) (*url.URL, error)
+	topics      []string
+	headers     http.Header
+
+	lastEventCache bool
+	writeTimeout   time.Duration
+	readTimeout    time.Duration
+	idleTimeout    time.Duration
+	maxMessageSize int64
+
+	compression      bool
+	compressionLevel int
+
+	keepaliveInterval time.Duration
+	keepaliveTimeout  time.Duration
+
+	minBrokerVersion string
+
+	clearLastErrorOnRead bool
+
+	logger  Logger
+	metrics Metrics
+
+	onConnect    func(uuid, version string)
+	onDisconnect func(err error)
+}
+
+func makeOptions(opts []Option) options {
+	o := options{
+		topics:  []string{}, // broker expects a (possibly empty) list rather than null
+		logger:  nopLogger{},
+		metrics: NopMetrics{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithTLS connects to broker over TLS (the wss scheme), making the connection with tlsDialFunc. For the default
+// broker configuration (which disables TLS verification), use weirdtls.BrokerDefaultTLSDialer, and when broker is
+// configured with certificates, use securetls.MakeSecureDialer(). NewClientWithOptions returns
+// ErrTLSDialFuncNotProvided if tlsDialFunc is nil. The default is to connect in plain text (the ws scheme).
+func WithTLS(tlsDialFunc TLSDialFunc) Option {
+	return func(o *options) {
+		o.secure = true
+		o.tlsDialFunc = tlsDialFunc
+	}
+}
+
+// WithDialer makes the connection with a copy of dialer, for settings such as its HandshakeTimeout, NetDialContext
+// or Proxy (which is treated as if given by WithProxy). dialer itself isn't modified, so it may be shared between
+// clients. With WithTLS, the TLS dial function replaces dialer's NetDialTLSContext (and so its TLSClientConfig, which
+// is then only used to connect to an https proxy). The default is a copy of websocket.DefaultDialer, whose Proxy is
+// http.ProxyFromEnvironment (see WithProxy).
+func WithDialer(dialer *websocket.Dialer) Option {
+	return func(o *options) {
+		o.dialer = dialer
+	}
+}
+
+// WithProxy connects to broker through the proxy returned by proxy for the handshake request (whose scheme is http,
+// or https with WithTLS), e.g. http.ProxyFromEnvironment or http.ProxyURL. A nil URL connects directly. The proxy
+// URL's scheme may be:
+//   - http, for an HTTP proxy, which tunnels the connection with a CONNECT request
+//   - https, as http, but connecting to the proxy over TLS, with the TLSClientConfig of the dialer given by WithDialer
+//     (if any) and the proxy's host as the server name
+//   - socks5 or socks5h, for a SOCKS5 proxy, which resolves broker's host in either case
+//
+// Credentials in the proxy URL are sent with basic authentication (http and https) or username/password
+// authentication (socks5). Any other scheme fails to connect.
+//
+// The proxy takes precedence over the TLS dial function: with WithTLS, any of the schemes may be used, and the TLS
+// dial function performs its handshake with broker over the tunnel. For that, it must make its connection with
+// DialContext, as those of the securetls and weirdtls packages do; otherwise it bypasses the proxy. WithProxy takes
+// precedence over the Proxy of a dialer given by WithDialer.
+//
+// By default, the Proxy of the dialer is used, which for the default dialer is http.ProxyFromEnvironment: the
+// HTTP_PROXY (for ws) and HTTPS_PROXY (for wss) environment variables are honoured, except for hosts excluded by
+// NO_PROXY, and for localhost. To connect directly regardless of the environment, pass a function that returns a nil
+// URL; WithProxy(nil) keeps the default.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(o *options) {
+		o.proxy = proxy
+	}
+}
+
+// WithTopics subscribes to topics during the handshake. Later uses replace, rather than add to, the topics of
+// earlier ones. Broker only accepts subscriptions in the handshake, so they are fixed for the life of the connection
+// (see ReconnectingClient.Subscribe to change them). The default is to subscribe to no topics.
+func WithTopics(topics ...string) Option {
+	return func(o *options) {
+		o.topics = append([]string{}, topics...)
+	}
+}
+
+// WithHeaders adds h to the HTTP headers of the websocket handshake request, e.g. to authenticate to a reverse proxy
+// in front of broker. A header given by a later use replaces the same header from an earlier one. By default, no
+// extra headers are sent.
+func WithHeaders(h http.Header) Option {
+	return func(o *options) {
+		if o.headers == nil {
+			o.headers = make(http.Header, len(h))
+		}
+		for k, v := range h {
+			o.headers[http.CanonicalHeaderKey(k)] = append([]string{}, v...)
+		}
+	}
+}
+
+// WithBearerToken sends token as a bearer token in the Authorization header of the websocket handshake request.
+// It is shorthand for the equivalent WithHeaders.
+func WithBearerToken(token string) Option {
+	return WithHeaders(http.Header{"Authorization": []string{"Bearer " + token}})
+}
+
+// WithLastEventCache enables caching of the most recent event received per topic, see Client.LastEvent. The cache
+// is disabled by default.
+func WithLastEventCache() Option {
+	return func(o *options) {
+		o.lastEventCache = true
+	}
+}
+
+// WithWriteTimeout applies a deadline of d to every write to the websocket (including the subscription sent
+// during the handshake), so that a stalled connection cannot block publishing indefinitely. A write that times
+// out returns a net.Error whose Timeout method returns true, after which the connection is no longer usable.
+// The default of zero disables the deadline.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.writeTimeout = d
+	}
+}
+
+// WithReadTimeout applies a deadline of d to every read from the websocket (including the handshake ack), so that a
+// connection whose peer has silently vanished cannot block reading indefinitely. A read that times out returns a
+// net.Error whose Timeout method returns true, after which the connection is no longer usable. Since broker only
+// sends messages for subscribed topics, d should be longer than the longest expected gap between them. If the
+// client's context is done first, reads return the context's error instead. The default of zero disables the
+// deadline.
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = d
+	}
+}
+
+// WithIdleTimeout treats the connection as dead once nothing (neither a message nor a pong) has been received from
+// broker for d while reading. The read then fails with an error wrapping ErrIdleTimeout (and a net.Error whose
+// Timeout method returns true), after which the connection is no longer usable: AsyncSubscription passes the error to
+// its ErrorHandler and exits, and a ReconnectingClient reconnects. Unlike WithReadTimeout, the deadline is restarted
+// by each pong, so on a quiet topic, WithKeepalive's pings keep the connection alive.
+//
+// With WithKeepalive, d must be longer than the keepalive interval (plus the time a pong takes to arrive), or the
+// idle timeout fires between pings. The keepalive then normally notices a dead peer first (within its timeout of a
+// ping), and the idle timeout is a backstop, e.g. for pings that can't be written. Without WithKeepalive, d should be
+// longer than the longest expected gap between events, as for WithReadTimeout. If both a read timeout and an idle
+// timeout are set, a read fails when either expires. The default of zero disables the idle timeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = d
+	}
+}
+
+// WithKeepalive sends a websocket ping to broker every interval, and closes the connection if the pong doesn't
+// arrive within timeout, so that dead peers (and connections dropped by NATs) are noticed. Reads then return
+// ErrKeepaliveTimeout, which AsyncSubscription passes to its ErrorHandler before exiting. Pongs are only processed
+// while reading, so the client must be read from continuously (e.g. by AsyncSubscription). A ping that can't be sent
+// within timeout, because a long publish holds the connection, is retried at the next interval instead. If timeout
+// isn't positive, interval is used. The keepalive is disabled by default.
+func WithKeepalive(interval, timeout time.Duration) Option {
+	return func(o *options) {
+		if timeout <= 0 {
+			timeout = interval
+		}
+		o.keepaliveInterval = interval
+		o.keepaliveTimeout = timeout
+	}
+}
+
+// WithMaxMessageSize limits the size of messages read from broker to n bytes, to protect against a malfunctioning
+// publisher exhausting memory. A larger message ends reading with an error that wraps websocket.ErrReadLimit, and
+// the connection is closed with the "message too big" close code. Zero means the default of
+// encoding.DefaultMaxBytes (64MiB), and a negative value disables the limit.
+func WithMaxMessageSize(n int64) Option {
+	return func(o *options) {
+		o.maxMessageSize = n
+	}
+}
+
+// WithCompression negotiates the permessage-deflate extension with broker, and if it agrees, compresses the
+// messages sent to it at level (from flate.HuffmanOnly to flate.BestCompression, with flate.BestSpeed being a good
+// choice). Broker then compresses the messages it sends too. Zeek events are mostly repetitive JSON, which compresses
+// well, so this saves a lot of bandwidth on constrained links to remote sensors, at the cost of CPU time on both ends
+// (which grows with the level). NewClientWithOptions returns an error for an invalid level. Compression is disabled
+// by default.
+func WithCompression(level int) Option {
+	return func(o *options) {
+		o.compression = true
+		o.compressionLevel = level
+	}
+}
+
+// WithMinBrokerVersion makes NewClientWithOptions fail with an error wrapping ErrIncompatibleBrokerVersion if the
+// version of broker (as sent in the handshake) is older than version, a semantic version such as "2.5.0". Following
+// semantic versioning, a pre-release such as "2.5.0-dev.12" is older than the release "2.5.0", and a broker version
+// that can't be parsed is treated as incompatible. NewClientWithOptions returns an error if version can't be parsed.
+// By default, any version is accepted.
+func WithMinBrokerVersion(version string) Option {
+	return func(o *options) {
+		o.minBrokerVersion = version
+	}
+}
+
+// WithLastErrorClearedOnRead makes Client.LastError return nil again once a message has been read successfully,
+// so that it reflects whether the most recent read failed rather than the most recent failure. By default, LastError
+// keeps returning the most recent failure.
+func WithLastErrorClearedOnRead() Option {
+	return func(o *options) {
+		o.clearLastErrorOnRead = true
+	}
+}
+
+// WithLogger logs the client's connection lifecycle events, reconnects (for a ReconnectingClient) and failures to
+// logger, see Logger. A *slog.Logger can be used directly. By default, nothing is logged.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		if logger == nil {
+			logger = nopLogger{}
+		}
+		o.logger = logger
+	}
+}
+
+// WithMetrics reports the client's activity to metrics, see Metrics for which method is called when. By default,
+// nothing is reported.
+func WithMetrics(metrics Metrics) Option {
+	return func(o *options) {
+		if metrics == nil {
+			metrics = NopMetrics{}
+		}
+		o.metrics = metrics
+	}
+}
+
+// WithOnConnect calls fn with broker's endpoint UUID and version (see RemoteEndpointInfo) once the handshake has
+// succeeded, for each connection: that made by NewClientWithOptions, and each one made by a ReconnectingClient to
+// reconnect or change its subscriptions. fn is called synchronously before NewClientWithOptions returns, and so
+// before any subscription loop (such as AsyncSubscription) can start reading from the connection. After a
+// reconnect, fn is called while the ReconnectingClient is locked (so it mustn't use it), before the resubscribe
+// handler, and reading carries on once both have returned. By default, nothing is called.
+func WithOnConnect(fn func(uuid, version string)) Option {
+	return func(o *options) {
+		o.onConnect = fn
+	}
+}
+
+// WithOnDisconnect calls fn once per connection, when it ends: with the error that first showed the connection had
+// failed (e.g. a read error, or ErrKeepaliveTimeout), or with nil when it is closed with Close (including by a
+// ReconnectingClient switching connections) before failing. fn is called synchronously by the goroutine that
+// noticed, before that error is returned to it (and so before AsyncSubscription passes it to its ErrorHandler), and
+// possibly while a read or publish holds the client's locks, so it mustn't use the client. It isn't called if the
+// handshake fails. By default, nothing is called.
+func WithOnDisconnect(fn func(err error)) Option {
+	return func(o *options) {
+		o.onDisconnect = fn
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+	netproxy "golang.org/x/net/proxy"
+)
+
+// netDialFunc makes the (TCP) connection to broker, before any TLS handshake.
+type netDialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// DialContext calls f, so that it can be used as a golang.org/x/net/proxy.ContextDialer.
+func (f netDialFunc) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f(ctx, network, addr)
+}
+
+// Dial calls f without a deadline, so that it can be used as a golang.org/x/net/proxy.Dialer.
+func (f netDialFunc) Dial(network, addr string) (net.Conn, error) {
+	return f(context.Background(), network, addr)
+}
+
+// netDialKey is the context key under which a TLSDialFunc called by NewClientWithOptions finds the netDialFunc to
+// make its connection with, see DialContext.
+type netDialKey struct{}
+
+// DialContext makes the TCP connection that a TLSDialFunc performs its TLS handshake over. Given the context passed
+// to a TLSDialFunc by NewClientWithOptions, it connects through the proxy set by WithProxy (if any), and otherwise
+// with the NetDialContext of the dialer set by WithDialer (if any); given any other context, it connects directly.
+// The dial functions of the securetls and weirdtls packages use it; a TLSDialFunc that makes its own connection
+// bypasses the proxy.
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial, ok := ctx.Value(netDialKey{}).(netDialFunc); ok {
+		return dial(ctx, network, addr)
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
+// configureDialer sets up dialer (a copy, owned by the client) to connect to hostPort as o specifies: with the TLS
+// dial function, and through the proxy, if any. Since the websocket.Dialer would otherwise make the connection to the
+// proxy with the TLS dial function, its Proxy is cleared, and the proxy is instead applied by wrapping the dialer's
+// NetDialContext (ws) or the TLS dial function (wss, via DialContext).
+func configureDialer(dialer *websocket.Dialer, hostPort string, o options) error {
+	proxy := dialer.Proxy
+	if o.proxy != nil {
+		proxy = o.proxy
+	}
+	dialer.Proxy = nil
+
+	baseDial := netDialFunc(dialer.NetDialContext)
+	if netDial := dialer.NetDial; baseDial == nil && netDial != nil {
+		baseDial = func(_ context.Context, network, addr string) (net.Conn, error) {
+			return netDial(network, addr)
+		}
+	} else if baseDial == nil {
+		var d net.Dialer
+		baseDial = d.DialContext
+	}
+
+	dial := baseDial
+	if proxy != nil {
+		// The request is only used to choose the proxy, e.g. by http.ProxyFromEnvironment, which looks at its scheme
+		// as the websocket.Dialer would have (i.e. http for ws, and https for wss).
+		scheme := "http"
+		if o.secure {
+			scheme = "https"
+		}
+		req, err := http.NewRequest(http.MethodGet, scheme+"://"+hostPort+messagesPath, http.NoBody)
+		if err != nil {
+			return err
+		}
+
+		proxyURL, err := proxy(req)
+		if err != nil {
+			return err
+		}
+
+		if proxyURL != nil {
+			tlsConfig := dialer.TLSClientConfig
+			dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialProxy(ctx, proxyURL, tlsConfig, baseDial, network, addr)
+			}
+		}
+	}
+
+	if o.secure {
+		tlsDialFunc := o.tlsDialFunc
+		dialer.NetDialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return tlsDialFunc(context.WithValue(ctx, netDialKey{}, dial), network, addr)
+		}
+	} else {
+		dialer.NetDialContext = dial
+	}
+
+	return nil
+}
+
+// defaultProxyPorts are the ports of the proxy schemes that dialProxy supports, for a proxy URL without one.
+var defaultProxyPorts = map[string]string{
+	"http":    "80",
+	"https":   "443",
+	"socks5":  "1080",
+	"socks5h": "1080",
+}
+
+// dialProxy connects to addr through the proxy at proxyURL, which is connected to with dial: through a tunnel opened
+// with a CONNECT request for an http or https proxy (the latter over TLS, as tlsConfig specifies), or with the SOCKS5
+// protocol for a socks5 or socks5h proxy.
+func dialProxy(ctx context.Context, proxyURL *url.URL, tlsConfig *tls.Config, dial netDialFunc,
+	network, addr string,
+) (net.Conn, error) {
+	defaultPort, ok := defaultProxyPorts[proxyURL.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported proxy scheme %q (only http, https and socks5 proxies are supported)",
+			proxyURL.Scheme)
+	}
+
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), defaultPort)
+	}
+
+	if proxyURL.Scheme == "socks5" || proxyURL.Scheme == "socks5h" {
+		return dialSOCKS5(ctx, proxyURL, proxyAddr, dial, network, addr)
+	}
+
+	conn, err := dial(ctx, network, proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxyURL.Scheme == "https" {
+		config := &tls.Config{MinVersion: tls.VersionTLS12}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		config.ServerName = proxyURL.Hostname()
+
+		tlsConn := tls.Client(conn, config)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("TLS handshake with proxy %s: %w", proxyURL.Redacted(), err)
+		}
+		conn = tlsConn
+	}
+
+	if err = connectProxy(ctx, conn, proxyURL, addr); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// dialSOCKS5 connects to addr through the SOCKS5 proxy at proxyAddr, which is connected to with dial. Credentials in
+// proxyURL are sent with username/password authentication. The proxy resolves addr's host, for both socks5 and
+// socks5h.
+func dialSOCKS5(ctx context.Context, proxyURL *url.URL, proxyAddr string, dial netDialFunc,
+	network, addr string,
+) (net.Conn, error) {
+	var auth *netproxy.Auth
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		auth = &netproxy.Auth{User: user.Username(), Password: password}
+	}
+
+	d, err := netproxy.SOCKS5(network, proxyAddr, auth, dial)
+	if err != nil {
+		return nil, err
+	}
+
+	// The dialer returned for a forward dialer with a DialContext method (as dial has) is a ContextDialer.
+	if cd, ok := d.(netproxy.ContextDialer); ok {
+		return cd.DialContext(ctx, network, addr)
+	}
+	return d.Dial(network, addr)
+}
+
+// connectProxy sends a CONNECT request for addr over conn, and reads the proxy's response, within ctx.
+func connectProxy(ctx context.Context, conn net.Conn, proxyURL *url.URL, addr string) error {
+	// The connection's deadline is moved into the past to interrupt the request once ctx is done, as watchContext
+	// does for reads.
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
+		}
+	}()
+
+	err := writeConnect(conn, proxyURL, addr)
+	close(stop)
+	if <-interrupted {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// writeConnect sends the CONNECT request for addr over conn, and checks that the proxy accepted it.
+func writeConnect(conn net.Conn, proxyURL *url.URL, addr string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	// The response is read a byte at a time, so that nothing after it (i.e. the start of the tunnelled traffic) is
+	// consumed. Its body, if any, isn't read.
+	resp, err := http.ReadResponse(bufio.NewReaderSize(oneByteReader{conn}, 16), req)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy %s refused to connect to %s: %s", proxyURL.Redacted(), addr, resp.Status)
+	}
+
+	return nil
+}
+
+// oneByteReader reads at most one byte at a time from r.
+type oneByteReader struct {
+	r net.Conn
+}
+
+func (o oneByteReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return o.r.Read(p)
+}
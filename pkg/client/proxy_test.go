@@ -0,0 +1,341 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// stubProxy is a minimal HTTP proxy, started with newServer (so an https proxy with httptest.NewTLSServer), that
+// tunnels CONNECT requests, sending each request it receives to requests.
+func stubProxy(t *testing.T, newServer func(http.Handler) *httptest.Server, requests chan<- *http.Request) *url.URL {
+	t.Helper()
+
+	srv := newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		if r.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Proxy-Authorization") == "" {
+			w.Header().Set("Proxy-Authenticate", "Basic")
+			http.Error(w, "authentication required", http.StatusProxyAuthRequired)
+			return
+		}
+
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		go func() { _, _ = io.Copy(upstream, conn) }()
+		_, _ = io.Copy(conn, upstream)
+	}))
+	t.Cleanup(srv.Close)
+
+	scheme := "http"
+	if srv.TLS != nil {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: srv.Listener.Addr().String()}
+}
+
+// stubSOCKS5Proxy is a minimal SOCKS5 proxy that requires username/password authentication and tunnels CONNECT
+// requests, sending the credentials and address of each request it receives to requests.
+func stubSOCKS5Proxy(t *testing.T, requests chan<- [3]string) *url.URL {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				user, password, addr, err := readSOCKS5Request(conn)
+				if err != nil {
+					t.Errorf("invalid SOCKS5 request: %v", err)
+					return
+				}
+				requests <- [3]string{user, password, addr}
+
+				upstream, err := net.Dial("tcp", addr)
+				if err != nil {
+					_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0}) // connection refused
+					return
+				}
+				defer upstream.Close()
+
+				if _, err = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+					return
+				}
+				go func() { _, _ = io.Copy(upstream, conn) }()
+				_, _ = io.Copy(conn, upstream)
+			}()
+		}
+	}()
+
+	return &url.URL{Scheme: "socks5", Host: ln.Addr().String()}
+}
+
+// readSOCKS5Request reads a SOCKS5 greeting offering username/password authentication, the credentials, and a
+// CONNECT request (RFC 1928 and RFC 1929), returning the credentials and the address to connect to.
+func readSOCKS5Request(conn net.Conn) (user, password, addr string, err error) {
+	r := bufio.NewReader(conn)
+	readBytes := func(n int) []byte {
+		b := make([]byte, n)
+		if err == nil {
+			_, err = io.ReadFull(r, b)
+		}
+		return b
+	}
+
+	greeting := readBytes(2)
+	methods := readBytes(int(greeting[1]))
+	if err != nil || greeting[0] != 5 || !bytes.Contains(methods, []byte{2}) {
+		return "", "", "", fmt.Errorf("greeting %v, methods %v: %w", greeting, methods, err)
+	}
+	if _, err = conn.Write([]byte{5, 2}); err != nil {
+		return "", "", "", err
+	}
+
+	_ = readBytes(1) // subnegotiation version
+	user = string(readBytes(int(readBytes(1)[0])))
+	password = string(readBytes(int(readBytes(1)[0])))
+	if err != nil {
+		return "", "", "", err
+	}
+	if _, err = conn.Write([]byte{1, 0}); err != nil {
+		return "", "", "", err
+	}
+
+	req := readBytes(4)
+	var host string
+	switch req[3] {
+	case 1:
+		host = net.IP(readBytes(4)).String()
+	case 3:
+		host = string(readBytes(int(readBytes(1)[0])))
+	case 4:
+		host = net.IP(readBytes(16)).String()
+	}
+	port := binary.BigEndian.Uint16(readBytes(2))
+	if err != nil || req[1] != 1 || host == "" {
+		return "", "", "", fmt.Errorf("request %v: %w", req, err)
+	}
+
+	return user, password, net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// insecureProxiedDial is a TLSDialFunc for the stub broker, whose TLS certificate is self-signed. The connection is
+// made with DialContext so that it goes through the proxy.
+func insecureProxiedDial(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return tls.Client(conn, &tls.Config{InsecureSkipVerify: true}), nil //nolint:gosec // test server
+}
+
+func TestClient_WithProxy(t *testing.T) {
+	// the dialer's TLSClientConfig is used for the connection to an https proxy, whose certificate is self-signed
+	proxyTLSDialer := &websocket.Dialer{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}} //nolint:gosec // test
+
+	tests := []struct {
+		name      string
+		newServer func(http.Handler) *httptest.Server
+		newProxy  func(http.Handler) *httptest.Server
+		opts      []Option
+		scheme    string
+	}{
+		{name: "ws", newServer: httptest.NewServer, newProxy: httptest.NewServer, scheme: "http"},
+		{name: "wss", newServer: httptest.NewTLSServer, newProxy: httptest.NewServer,
+			opts: []Option{WithTLS(insecureProxiedDial)}, scheme: "https"},
+		{name: "ws https proxy", newServer: httptest.NewServer, newProxy: httptest.NewTLSServer,
+			opts: []Option{WithDialer(proxyTLSDialer)}, scheme: "http"},
+		{name: "wss https proxy", newServer: httptest.NewTLSServer, newProxy: httptest.NewTLSServer,
+			opts: []Option{WithDialer(proxyTLSDialer), WithTLS(insecureProxiedDial)}, scheme: "https"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostPort := startStubBroker(t, tt.newServer, func(_ *http.Request, _ []string, conn *websocket.Conn) {
+				_, _, _ = conn.ReadMessage()
+			})
+
+			requests := make(chan *http.Request, 1)
+			proxyURL := stubProxy(t, tt.newProxy, requests)
+			proxyURL.User = url.UserPassword("user", "secret")
+
+			var chosenFor *url.URL
+			proxy := func(r *http.Request) (*url.URL, error) {
+				chosenFor = r.URL
+				return proxyURL, nil
+			}
+
+			c, err := NewClientWithOptions(context.Background(), hostPort, append(tt.opts, WithProxy(proxy))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			if chosenFor == nil || chosenFor.Scheme != tt.scheme || chosenFor.Host != hostPort {
+				t.Errorf("proxy chosen for %v, want %s://%s", chosenFor, tt.scheme, hostPort)
+			}
+
+			r := <-requests
+			if r.Host != hostPort {
+				t.Errorf("proxy tunnelled to %s, want %s", r.Host, hostPort)
+			}
+			if user, password, ok := parseProxyAuthorization(r); !ok || user != "user" || password != "secret" {
+				t.Errorf("proxy credentials = %q, %q, want %q, %q", user, password, "user", "secret")
+			}
+		})
+	}
+}
+
+func TestClient_WithProxy_refused(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {})
+
+	requests := make(chan *http.Request, 1)
+	proxyURL := stubProxy(t, httptest.NewServer, requests)
+
+	_, err := NewClientWithOptions(context.Background(), hostPort, WithProxy(http.ProxyURL(proxyURL)))
+	if err == nil || !strings.Contains(err.Error(), "407 Proxy Authentication Required") {
+		t.Errorf("expected the proxy to refuse the connection but got %v", err)
+	}
+}
+
+func TestClient_WithProxy_socks5(t *testing.T) {
+	tests := []struct {
+		name      string
+		newServer func(http.Handler) *httptest.Server
+		opts      func(proxyURL *url.URL) []Option
+	}{
+		{name: "ws", newServer: httptest.NewServer, opts: func(proxyURL *url.URL) []Option {
+			return []Option{WithProxy(http.ProxyURL(proxyURL))}
+		}},
+		{name: "wss", newServer: httptest.NewTLSServer, opts: func(proxyURL *url.URL) []Option {
+			return []Option{WithProxy(http.ProxyURL(proxyURL)), WithTLS(insecureProxiedDial)}
+		}},
+		{name: "dialer proxy", newServer: httptest.NewServer, opts: func(proxyURL *url.URL) []Option {
+			return []Option{WithDialer(&websocket.Dialer{Proxy: http.ProxyURL(proxyURL)})}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostPort := startStubBroker(t, tt.newServer, func(_ *http.Request, _ []string, conn *websocket.Conn) {
+				_, _, _ = conn.ReadMessage()
+			})
+
+			requests := make(chan [3]string, 1)
+			proxyURL := stubSOCKS5Proxy(t, requests)
+			proxyURL.User = url.UserPassword("user", "secret")
+
+			c, err := NewClientWithOptions(context.Background(), hostPort, tt.opts(proxyURL)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			if got, want := <-requests, [3]string{"user", "secret", hostPort}; got != want {
+				t.Errorf("proxy request (user, password, address) = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestClient_WithProxy_unsupportedScheme(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {})
+
+	proxyURL := &url.URL{Scheme: "ftp", Host: "127.0.0.1:21"}
+	_, err := NewClientWithOptions(context.Background(), hostPort, WithProxy(http.ProxyURL(proxyURL)))
+	if err == nil || !strings.Contains(err.Error(), `unsupported proxy scheme "ftp"`) {
+		t.Errorf("expected an unsupported scheme error but got %v", err)
+	}
+}
+
+// proxyEnvTestVar marks the process run by TestClient_proxyFromEnvironment, whose HTTPS_PROXY is its stub proxy.
+const proxyEnvTestVar = "GO_ZEEK_BROKER_WS_PROXY_ENV_TEST"
+
+func TestClient_proxyFromEnvironment(t *testing.T) {
+	// broker.invalid, since the environment's proxy isn't used for localhost
+	const hostPort = "broker.invalid:9997"
+
+	if os.Getenv(proxyEnvTestVar) != "" {
+		// The default dialer goes through HTTPS_PROXY, which refuses the connection without credentials.
+		_, err := NewClientWithOptions(context.Background(), hostPort, WithTLS(insecureProxiedDial))
+		if err == nil || !strings.Contains(err.Error(), "407 Proxy Authentication Required") {
+			t.Errorf("expected the environment's proxy to refuse the connection but got %v", err)
+		}
+
+		// A proxy function that returns nil connects directly.
+		_, err = NewClientWithOptions(context.Background(), hostPort, WithTLS(insecureProxiedDial),
+			WithProxy(func(*http.Request) (*url.URL, error) { return nil, nil }))
+		if err == nil || strings.Contains(err.Error(), "Proxy") {
+			t.Errorf("expected to connect directly (and fail to resolve %s) but got %v", hostPort, err)
+		}
+		return
+	}
+
+	requests := make(chan *http.Request, 2)
+	proxyURL := stubProxy(t, httptest.NewServer, requests)
+
+	// http.ProxyFromEnvironment reads the environment once per process, so the client runs in a new one.
+	cmd := exec.Command(os.Args[0], "-test.run=^TestClient_proxyFromEnvironment$")
+	cmd.Env = append(os.Environ(), proxyEnvTestVar+"=1", "HTTPS_PROXY="+proxyURL.String(), "https_proxy=",
+		"NO_PROXY=", "no_proxy=")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("proxy received %d requests, want 1", len(requests))
+	}
+	if r := <-requests; r.Method != http.MethodConnect || r.Host != hostPort {
+		t.Errorf("proxy received %s %s, want CONNECT %s", r.Method, r.Host, hostPort)
+	}
+}
+
+// parseProxyAuthorization returns the basic authentication credentials sent to a proxy.
+func parseProxyAuthorization(r *http.Request) (user, password string, ok bool) {
+	// http.Request.BasicAuth only looks at the Authorization header
+	req := &http.Request{Header: http.Header{"Authorization": r.Header.Values("Proxy-Authorization")}}
+	return req.BasicAuth()
+}
@@ -0,0 +1,423 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/corelight/go-zeek-broker-ws/pkg/encoding"
+)
+
+// ErrClientClosed is returned by a ReconnectingClient once it has been closed.
+var ErrClientClosed = errors.New("client closed")
+
+// ErrReconnectGaveUp is wrapped by the error returned by a ReconnectingClient once it has given up reconnecting, see
+// WithMaxReconnectAttempts and WithMaxReconnectDuration.
+var ErrReconnectGaveUp = errors.New("gave up reconnecting to broker")
+
+// ReconnectOption configures optional behaviour of a ReconnectingClient.
+type ReconnectOption func(*reconnectOptions)
+
+type reconnectOptions struct {
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	maxAttempts    int
+	maxDuration    time.Duration
+	errorHandler   ErrorHandler
+	resubscribed   func(topics []string)
+}
+
+// WithBackoff sets the delay before the first attempt to reconnect (initial), which doubles after each failed
+// attempt up to maximum. A random jitter of up to half the delay is subtracted, so that many clients of a restarted
+// broker don't all reconnect at once. The defaults are 500ms and 30s.
+func WithBackoff(initial, maximum time.Duration) ReconnectOption {
+	return func(o *reconnectOptions) {
+		o.initialBackoff = initial
+		o.maxBackoff = maximum
+	}
+}
+
+// WithMaxReconnectAttempts gives up reconnecting after n failed attempts to reconnect, e.g. so that a batch job
+// fails rather than hangs when broker has gone away. The ReconnectingClient is then unusable: the error handler (see
+// WithReconnectErrorHandler) is called with an error wrapping ErrReconnectGaveUp and the last attempt's error, which
+// is returned by ReadEvent, PublishEvent, Subscribe and Unsubscribe from then on. A value of zero (the default)
+// retries until the context is done or the client is closed.
+func WithMaxReconnectAttempts(n int) ReconnectOption {
+	return func(o *reconnectOptions) {
+		o.maxAttempts = n
+	}
+}
+
+// WithMaxReconnectDuration gives up reconnecting once d has passed since the connection failed without a successful
+// reconnect, as WithMaxReconnectAttempts does after a number of attempts. The delay before an attempt is shortened so
+// that the last attempt is made when d has passed, but an attempt in progress isn't interrupted (its handshake is
+// bounded by the HandshakeTimeout of the dialer, see WithDialer). A value of zero (the default) retries until the
+// context is done or the client is closed.
+func WithMaxReconnectDuration(d time.Duration) ReconnectOption {
+	return func(o *reconnectOptions) {
+		o.maxDuration = d
+	}
+}
+
+// WithReconnectErrorHandler calls eh with the error that caused each disconnect, and with the error from each
+// failed attempt to reconnect. By default these errors aren't reported.
+func WithReconnectErrorHandler(eh ErrorHandler) ReconnectOption {
+	return func(o *reconnectOptions) {
+		o.errorHandler = eh
+	}
+}
+
+// WithResubscribeHandler calls fn after each reconnect, once the new connection has subscribed to topics (the topics
+// given by WithTopics, as changed by Subscribe and Unsubscribe), e.g. to re-request state that was published while
+// disconnected. fn is called by the goroutine whose read or publish noticed the disconnect, before that read or
+// publish carries on with the new connection. It isn't called for the connections made by NewReconnectingClient,
+// Subscribe or Unsubscribe. By default, nothing is called.
+func WithResubscribeHandler(fn func(topics []string)) ReconnectOption {
+	return func(o *reconnectOptions) {
+		o.resubscribed = fn
+	}
+}
+
+// ReconnectingClient wraps a Client, transparently replacing it with a new connection (made with the same options,
+// and subscribing to the current topics, including those changed by Subscribe and Unsubscribe) when the connection
+// to broker fails, e.g. because zeek restarted.
+//
+// Only the events sent by broker while connected are received: any sent while reconnecting are lost.
+type ReconnectingClient struct {
+	ctx      context.Context
+	hostPort string
+	opts     []Option
+	ro       reconnectOptions
+	logger   Logger
+	metrics  Metrics
+
+	mu     sync.Mutex // guards client, topics and gaveUp, and serialises reconnecting
+	client *Client
+	topics []string // the topics subscribed to by each connection, initially those given by WithTopics
+	gaveUp error    // wraps ErrReconnectGaveUp once reconnecting has given up
+
+	closed    chan struct{} // closed by Close, to stop reconnecting
+	closeOnce sync.Once
+}
+
+// NewReconnectingClient connects to broker as NewClientWithOptions does with opts, returning an error if the first
+// connection fails. Later connection failures are retried (with exponential backoff) until ctx is done, or the
+// limits set by WithMaxReconnectAttempts or WithMaxReconnectDuration are reached.
+func NewReconnectingClient(ctx context.Context, hostPort string, opts []Option,
+	reconnectOpts ...ReconnectOption) (*ReconnectingClient, error) {
+	ro := reconnectOptions{
+		initialBackoff: 500 * time.Millisecond,
+		maxBackoff:     30 * time.Second,
+	}
+	for _, opt := range reconnectOpts {
+		opt(&ro)
+	}
+
+	o := makeOptions(opts)
+	r := &ReconnectingClient{
+		ctx:      ctx,
+		hostPort: hostPort,
+		opts:     opts,
+		ro:       ro,
+		logger:   o.logger,
+		metrics:  o.metrics,
+		topics:   o.topics,
+		closed:   make(chan struct{}),
+	}
+
+	var err error
+	if r.client, err = r.dial(r.topics); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// dial makes a new connection, subscribing to topics.
+func (r *ReconnectingClient) dial(topics []string) (*Client, error) {
+	opts := append(append([]Option{}, r.opts...), WithTopics(topics...))
+	return NewClientWithOptions(r.ctx, r.hostPort, opts...)
+}
+
+// Client returns the current underlying Client, e.g. for its RemoteEndpointInfo. It is replaced after a reconnect.
+func (r *ReconnectingClient) Client() *Client {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.client
+}
+
+// ReadEvent reads a single event from broker as Client.ReadEvent does, except that if the connection has failed,
+// it reconnects and reads from the new connection instead. Errors that leave the connection usable, such as
+// errors received from broker, are returned. ReadEvent returns the context's error once it is done, ErrClientClosed
+// once Close has been called, and an error wrapping ErrReconnectGaveUp once reconnecting has given up.
+func (r *ReconnectingClient) ReadEvent() (topic string, evt encoding.Event, err error) {
+	for {
+		var c *Client
+		if c, err = r.current(); err != nil {
+			return "", encoding.Event{}, err
+		}
+
+		topic, evt, err = c.ReadEvent()
+		if err == nil || !c.broken.Load() {
+			return topic, evt, err
+		}
+
+		if err = r.reconnect(c, err); err != nil {
+			return "", encoding.Event{}, err
+		}
+	}
+}
+
+// Events reads events from broker as Client.Events does, carrying on across reconnects. The channel is closed once
+// ctx or the client's context is done, the client is closed, or reconnecting has given up, in which case the error
+// wrapping ErrReconnectGaveUp is sent first.
+func (r *ReconnectingClient) Events(ctx context.Context, opts ...SubscriptionOption) <-chan EventOrError {
+	return readEvents(ctx, r, opts)
+}
+
+func (r *ReconnectingClient) readOutcome(err error) (readOutcome, error) {
+	switch {
+	case errors.Is(err, ErrClientClosed):
+		return readStopped, nil
+	case r.ctx.Err() != nil:
+		return readStopped, r.ctx.Err()
+	case errors.Is(err, ErrReconnectGaveUp):
+		return readFailed, nil
+	default:
+		// ReadEvent reconnects after any other failure.
+		return readContinues, nil
+	}
+}
+
+func (r *ReconnectingClient) queueMetrics() Metrics {
+	return r.metrics
+}
+
+// PublishEvent publishes an event to the topic provided, reconnecting first if the connection has failed. An event
+// that fails to be published isn't retried, since it may have been (partly) sent.
+func (r *ReconnectingClient) PublishEvent(topic string, evt encoding.Event) error {
+	c, err := r.current()
+	if err != nil {
+		return err
+	}
+
+	if c.broken.Load() {
+		if err = r.reconnect(c, errors.New("connection failed before publishing")); err != nil {
+			return err
+		}
+		if c, err = r.current(); err != nil {
+			return err
+		}
+	}
+
+	return c.PublishEvent(topic, evt)
+}
+
+// Subscribe adds topics to those subscribed to (ignoring any that already are), for this and all later connections.
+//
+// Broker's WebSocket API only accepts subscriptions in the handshake (the first message sent by the client, which is
+// a JSON array of topic strings such as ["/topic/a","/topic/b"]), and treats any later message as a data message to
+// publish. Subscribe therefore makes a new connection with the extended list of topics, and then replaces the
+// current connection with it. A pending ReadEvent carries on reading from the new connection. Events published
+// while the connections are switched may be missed or received twice. If the new connection fails, the current one
+// (and its subscriptions) are kept, and the error is returned.
+func (r *ReconnectingClient) Subscribe(topics ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscribed := append([]string{}, r.topics...)
+	for _, topic := range topics {
+		if !containsTopic(subscribed, topic) {
+			subscribed = append(subscribed, topic)
+		}
+	}
+
+	return r.resubscribe(subscribed)
+}
+
+// Unsubscribe removes topics from those subscribed to (ignoring any that aren't), for this and all later
+// connections. As for Subscribe, this is done by switching to a new connection subscribed to the remaining topics,
+// so that broker stops sending events on the removed topics (unlike Client.Unsubscribe, which filters them).
+func (r *ReconnectingClient) Unsubscribe(topics ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.resubscribe(removeTopics(r.topics, topics))
+}
+
+// Topics returns the topics subscribed to: those given by WithTopics, as changed by Subscribe and Unsubscribe.
+func (r *ReconnectingClient) Topics() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.topics...)
+}
+
+// resubscribe switches to a new connection subscribed to topics, unless they are unchanged. r.mu must be held.
+func (r *ReconnectingClient) resubscribe(topics []string) error {
+	if r.isClosed() {
+		return ErrClientClosed
+	}
+	if r.gaveUp != nil {
+		return r.gaveUp
+	}
+
+	if reflect.DeepEqual(topics, r.topics) {
+		return nil
+	}
+
+	r.logger.Info("switching to a new connection to change subscriptions", "topics", topics)
+
+	c, err := r.dial(topics)
+	if err != nil {
+		return err
+	}
+
+	old := r.client
+	r.client, r.topics = c, topics
+	_ = old.Close()
+
+	return nil
+}
+
+func containsTopic(topics []string, topic string) bool {
+	for _, t := range topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// Close closes the current connection, and stops any further reconnects (including one in progress).
+func (r *ReconnectingClient) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.client.Close()
+}
+
+func (r *ReconnectingClient) current() (*Client, error) {
+	if r.isClosed() {
+		return nil, ErrClientClosed
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.gaveUp != nil {
+		return nil, r.gaveUp
+	}
+	return r.client, nil
+}
+
+func (r *ReconnectingClient) isClosed() bool {
+	select {
+	case <-r.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// reconnect replaces failed (which failed with cause) with a new connection subscribed to the current topics,
+// retrying with backoff until it succeeds, the context is done or it gives up, and then calls the resubscribe
+// handler. Nothing is done if failed has already been replaced (e.g. by a concurrent publish), and other uses of the
+// ReconnectingClient wait for it to finish.
+func (r *ReconnectingClient) reconnect(failed *Client, cause error) error {
+	topics, err := r.reconnectLocked(failed, cause)
+	if err == nil && topics != nil && r.ro.resubscribed != nil {
+		r.ro.resubscribed(topics) // called without r.mu held, so that it can use the ReconnectingClient
+	}
+
+	return err
+}
+
+// reconnectLocked does reconnect's work under r.mu, returning the topics subscribed to if it reconnected, and nil if
+// failed had already been replaced.
+func (r *ReconnectingClient) reconnectLocked(failed *Client, cause error) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isClosed() {
+		return nil, ErrClientClosed
+	}
+	if r.gaveUp != nil {
+		return nil, r.gaveUp
+	}
+	if r.client != failed {
+		return nil, nil
+	}
+
+	r.handleError(cause)
+	_ = failed.Close()
+	r.logger.Info("reconnecting to broker", "cause", cause)
+
+	var deadline time.Time
+	if r.ro.maxDuration > 0 {
+		deadline = time.Now().Add(r.ro.maxDuration)
+	}
+
+	backoff := r.ro.initialBackoff
+	for attempt := 1; ; attempt++ {
+		if err := r.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		delay := backoff
+		if jitter := int64(delay / 2); jitter > 0 {
+			delay -= time.Duration(rand.Int63n(jitter)) //nolint:gosec // the jitter needn't be secure
+		}
+		if remaining := time.Until(deadline); !deadline.IsZero() && remaining < delay {
+			delay = remaining
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-r.ctx.Done():
+			timer.Stop()
+			return nil, r.ctx.Err()
+		case <-r.closed:
+			timer.Stop()
+			return nil, ErrClientClosed
+		case <-timer.C:
+		}
+
+		c, err := r.dial(r.topics)
+		if err == nil {
+			r.logger.Info("reconnected to broker", "attempts", attempt)
+			r.metrics.Reconnected()
+			r.client = c
+			return append([]string{}, r.topics...), nil
+		}
+		r.logger.Warn("failed to reconnect to broker", "attempt", attempt, "error", err)
+		r.handleError(err)
+
+		attemptsReached := r.ro.maxAttempts > 0 && attempt >= r.ro.maxAttempts
+		if attemptsReached || (!deadline.IsZero() && !time.Now().Before(deadline)) {
+			r.gaveUp = fmt.Errorf("%w after %d attempts: %w", ErrReconnectGaveUp, attempt, err)
+			r.logger.Error("gave up reconnecting to broker", "attempts", attempt, "error", err)
+			r.handleError(r.gaveUp)
+			return nil, r.gaveUp
+		}
+
+		if backoff *= 2; backoff > r.ro.maxBackoff {
+			backoff = r.ro.maxBackoff
+		}
+	}
+}
+
+func (r *ReconnectingClient) handleError(err error) {
+	if r.ro.errorHandler != nil {
+		r.ro.errorHandler(err)
+	}
+}
@@ -0,0 +1,413 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/corelight/go-zeek-broker-ws/pkg/encoding"
+	"github.com/gorilla/websocket"
+)
+
+func TestReconnectingClient_ReadEvent(t *testing.T) {
+	var connections atomic.Int32
+	subscribed := make(chan []string, 2)
+	hostPort := stubBrokerWithTopics(t, func(topics []string, conn *websocket.Conn) {
+		subscribed <- topics
+		if connections.Add(1) == 1 {
+			return // drop the first connection, as if zeek restarted
+		}
+
+		writeEvent(t, conn, "/topic/test", encoding.NewEvent("ping", encoding.Count(1)))
+		_, _, _ = conn.ReadMessage()
+	})
+
+	var disconnects atomic.Int32
+	c, err := NewReconnectingClient(context.Background(), hostPort, []Option{WithTopics("/topic/test")},
+		WithBackoff(10*time.Millisecond, 100*time.Millisecond),
+		WithReconnectErrorHandler(func(err error) { disconnects.Add(1) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, evt, err := c.ReadEvent()
+	if err != nil || evt.Name != "ping" {
+		t.Fatalf("ReadEvent() = %s, %v", evt, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if got, want := <-subscribed, []string{"/topic/test"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("connection %d subscribed to %v, want %v", i, got, want)
+		}
+	}
+
+	if got := disconnects.Load(); got != 1 {
+		t.Errorf("error handler called %d times, want 1", got)
+	}
+}
+
+func TestReconnectingClient_Close(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewReconnectingClient(context.Background(), hostPort, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.AfterFunc(50*time.Millisecond, func() { _ = c.Close() })
+
+	if _, _, err = c.ReadEvent(); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("expected ErrClientClosed but got %v", err)
+	}
+}
+
+func TestReconnectingClient_contextCancelled(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {}) // always drop the connection
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, err := NewReconnectingClient(ctx, hostPort, nil, WithBackoff(time.Hour, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	if _, _, err = c.ReadEvent(); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled but got %v", err)
+	}
+}
+
+func TestReconnectingClient_Subscribe(t *testing.T) {
+	subscribed := make(chan []string, 2)
+	hostPort := stubBrokerWithTopics(t, func(topics []string, conn *websocket.Conn) {
+		subscribed <- topics
+		if len(topics) > 1 {
+			writeEvent(t, conn, "/topic/b", encoding.NewEvent("ping", encoding.Count(1)))
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewReconnectingClient(context.Background(), hostPort, []Option{WithTopics("/topic/a")},
+		WithReconnectErrorHandler(func(err error) { t.Errorf("unexpected disconnect: %v", err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if got, want := <-subscribed, []string{"/topic/a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("subscribed to %v, want %v", got, want)
+	}
+
+	read := make(chan encoding.Event, 1)
+	go func() {
+		_, evt, err := c.ReadEvent() // pending while subscribing
+		if err != nil {
+			t.Error(err)
+		}
+		read <- evt
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if err = c.Subscribe("/topic/a", "/topic/b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := <-subscribed, []string{"/topic/a", "/topic/b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("subscribed to %v, want %v", got, want)
+	}
+
+	if evt := <-read; evt.Name != "ping" {
+		t.Errorf("read unexpected event %s", evt)
+	}
+}
+
+func TestReconnectingClient_Unsubscribe(t *testing.T) {
+	subscribed := make(chan []string, 3)
+	hostPort := stubBrokerWithTopics(t, func(topics []string, conn *websocket.Conn) {
+		subscribed <- topics
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewReconnectingClient(context.Background(), hostPort, []Option{WithTopics("/topic/a", "/topic/b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-subscribed
+
+	// unsubscribing from a topic that isn't subscribed to doesn't reconnect
+	if err = c.Unsubscribe("/topic/c"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Unsubscribe("/topic/a"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.Topics(), []string{"/topic/b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Topics() = %v, want %v", got, want)
+	}
+	if got, want := <-subscribed, []string{"/topic/b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reconnected subscribing to %v, want %v", got, want)
+	}
+
+	if err = c.Subscribe("/topic/c"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.Topics(), []string{"/topic/b", "/topic/c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Topics() = %v, want %v", got, want)
+	}
+	if got, want := <-subscribed, []string{"/topic/b", "/topic/c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reconnected subscribing to %v, want %v", got, want)
+	}
+}
+
+func TestReconnectingClient_resubscribe(t *testing.T) {
+	var connections atomic.Int32
+	subscribed := make(chan []string, 3)
+	hostPort := stubBrokerWithTopics(t, func(topics []string, conn *websocket.Conn) {
+		subscribed <- topics
+		switch connections.Add(1) {
+		case 2:
+			return // drop the connection made by Subscribe, as if zeek restarted
+		case 3:
+			writeEvent(t, conn, "/topic/b", encoding.NewEvent("ping", encoding.Count(1)))
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+
+	resubscribed := make(chan []string, 1)
+	c, err := NewReconnectingClient(context.Background(), hostPort, []Option{WithTopics("/topic/a")},
+		WithBackoff(10*time.Millisecond, 100*time.Millisecond),
+		WithResubscribeHandler(func(topics []string) { resubscribed <- topics }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err = c.Subscribe("/topic/b"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, evt, err := c.ReadEvent()
+	if err != nil || evt.Name != "ping" {
+		t.Fatalf("ReadEvent() = %s, %v", evt, err)
+	}
+
+	want := [][]string{{"/topic/a"}, {"/topic/a", "/topic/b"}, {"/topic/a", "/topic/b"}}
+	for i := range want {
+		if got := <-subscribed; !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("connection %d subscribed to %v, want %v", i, got, want[i])
+		}
+	}
+
+	select {
+	case got := <-resubscribed:
+		if !reflect.DeepEqual(got, want[2]) {
+			t.Errorf("resubscribe handler called with %v, want %v", got, want[2])
+		}
+	default:
+		t.Error("resubscribe handler wasn't called")
+	}
+}
+
+func TestReconnectingClient_connectionCallbacks(t *testing.T) {
+	var connections atomic.Int32
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		if connections.Add(1) == 1 {
+			return // drop the first connection
+		}
+		writeEvent(t, conn, "/topic/a", encoding.NewEvent("ping", encoding.Count(1)))
+		_, _, _ = conn.ReadMessage()
+	})
+
+	var calls []string
+	opts := []Option{
+		WithTopics("/topic/a"),
+		WithOnConnect(func(uuid, version string) { calls = append(calls, "connect "+uuid+" "+version) }),
+		WithOnDisconnect(func(err error) { calls = append(calls, fmt.Sprintf("disconnect %t", err != nil)) }),
+	}
+
+	c, err := NewReconnectingClient(context.Background(), hostPort, opts,
+		WithBackoff(10*time.Millisecond, 100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, evt, err := c.ReadEvent(); err != nil || evt.Name != "ping" {
+		t.Fatalf("ReadEvent() = %s, %v", evt, err)
+	}
+	_ = c.Close()
+
+	connected := "connect 00000000-0000-0000-0000-000000000000 2.5.0"
+	want := []string{connected, "disconnect true", connected, "disconnect false"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("callbacks called as %q, want %q", calls, want)
+	}
+}
+
+// refuseAfterFirst is a newServer for startStubBroker whose server refuses every connection after the first, counting
+// the connections made in connections.
+func refuseAfterFirst(connections *atomic.Int32) func(http.Handler) *httptest.Server {
+	return func(h http.Handler) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if connections.Add(1) > 1 {
+				http.Error(w, "broker has gone away", http.StatusServiceUnavailable)
+				return
+			}
+			h.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// checkGaveUp checks that c has given up reconnecting, and refuses further use.
+func checkGaveUp(t *testing.T, c *ReconnectingClient, err error, handled []error) {
+	t.Helper()
+
+	if !errors.Is(err, ErrReconnectGaveUp) {
+		t.Fatalf("expected ErrReconnectGaveUp but got %v", err)
+	}
+	if len(handled) == 0 || handled[len(handled)-1] != err {
+		t.Errorf("error handler wasn't called with the terminal error, got %v", handled)
+	}
+
+	if _, _, err2 := c.ReadEvent(); err2 != err {
+		t.Errorf("ReadEvent() after giving up = %v, want %v", err2, err)
+	}
+	if err2 := c.PublishEvent("/topic/test", encoding.NewEvent("ping")); err2 != err {
+		t.Errorf("PublishEvent() after giving up = %v, want %v", err2, err)
+	}
+	if err2 := c.Subscribe("/topic/other"); err2 != err {
+		t.Errorf("Subscribe() after giving up = %v, want %v", err2, err)
+	}
+}
+
+func TestReconnectingClient_WithMaxReconnectAttempts(t *testing.T) {
+	var connections atomic.Int32
+	hostPort := startStubBroker(t, refuseAfterFirst(&connections), func(*http.Request, []string, *websocket.Conn) {})
+
+	var handled []error // only appended to by the reading goroutine (i.e. this one)
+	c, err := NewReconnectingClient(context.Background(), hostPort, nil,
+		WithBackoff(time.Millisecond, time.Millisecond), WithMaxReconnectAttempts(3),
+		WithReconnectErrorHandler(func(err error) { handled = append(handled, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, _, err = c.ReadEvent()
+	checkGaveUp(t, c, err, handled)
+
+	if got := connections.Load(); got != 4 {
+		t.Errorf("made %d connections, want the first and 3 attempts to reconnect", got)
+	}
+	if !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestReconnectingClient_WithMaxReconnectDuration(t *testing.T) {
+	var connections atomic.Int32
+	hostPort := startStubBroker(t, refuseAfterFirst(&connections), func(*http.Request, []string, *websocket.Conn) {})
+
+	const maxDuration = 200 * time.Millisecond
+
+	var handled []error
+	c, err := NewReconnectingClient(context.Background(), hostPort, nil,
+		WithBackoff(10*time.Millisecond, time.Hour), WithMaxReconnectDuration(maxDuration),
+		WithReconnectErrorHandler(func(err error) { handled = append(handled, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	_, _, err = c.ReadEvent()
+	elapsed := time.Since(start)
+	checkGaveUp(t, c, err, handled)
+
+	// the backoff would reach an hour, but the last attempt is made once maxDuration has passed
+	if elapsed < maxDuration || elapsed > 5*time.Second {
+		t.Errorf("gave up after %s, want about %s", elapsed, maxDuration)
+	}
+	if got := connections.Load(); got < 3 {
+		t.Errorf("made %d connections, want several attempts to reconnect", got)
+	}
+}
+
+func TestReconnectingClient_Events(t *testing.T) {
+	var connections atomic.Int32
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		n := connections.Add(1)
+		writeEvent(t, conn, "/topic/test", encoding.NewEvent("ping", encoding.Count(uint64(n))))
+		if n == 1 {
+			return // drop the first connection, as if zeek restarted
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+
+	c, err := NewReconnectingClient(context.Background(), hostPort, []Option{WithTopics("/topic/test")},
+		WithBackoff(10*time.Millisecond, 100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := c.Events(context.Background())
+	for i := uint64(1); i <= 2; i++ {
+		e := <-events
+		if want := fmt.Sprintf("event ping(count(%d))", i); e.Err != nil || e.Event.String() != want {
+			t.Fatalf("event %d = %s, %v", i, e.Event, e.Err)
+		}
+	}
+
+	_ = c.Close()
+	for e := range events {
+		t.Errorf("unexpected %s, %v after Close", e.Event, e.Err)
+	}
+}
+
+func TestAsyncSubscription_ReconnectingClient(t *testing.T) {
+	var connections atomic.Int32
+	hostPort := startStubBroker(t, refuseAfterFirst(&connections),
+		func(_ *http.Request, _ []string, conn *websocket.Conn) {
+			writeEvent(t, conn, "/topic/test", encoding.NewEvent("ping"))
+		})
+
+	c, err := NewReconnectingClient(context.Background(), hostPort, nil,
+		WithBackoff(time.Millisecond, time.Millisecond), WithMaxReconnectAttempts(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var received atomic.Int32
+	var handled []error
+	sub := AsyncSubscription(context.Background(), c,
+		func(string, encoding.Event) { received.Add(1) },
+		func(err error) { handled = append(handled, err) })
+	waitDone(t, sub)
+
+	if got := received.Load(); got != 1 {
+		t.Errorf("received %d events, want 1", got)
+	}
+	if err = sub.Err(); !errors.Is(err, ErrReconnectGaveUp) {
+		t.Errorf("Err() = %v, want ErrReconnectGaveUp", err)
+	}
+	if len(handled) != 1 || handled[0] != sub.Err() {
+		t.Errorf("error handler called with %v, want only the terminal error", handled)
+	}
+}
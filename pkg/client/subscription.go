@@ -4,6 +4,8 @@ package client
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
 
 	"github.com/corelight/go-zeek-broker-ws/pkg/encoding"
@@ -14,44 +16,364 @@ type EventHandler func(topic string, event encoding.Event)
 
 type ErrorHandler func(err error)
 
-// AsyncSubscription runs the message handling loop given an EventHandler and optional ErrorHandler.
+// EventFilter is a predicate used to select which events are delivered by a subscription.
+type EventFilter func(topic string, event encoding.Event) bool
+
+// SubscriptionOption configures optional behaviour of AsyncSubscription and Client.Events.
+type SubscriptionOption func(*subscriptionOptions)
+
+type subscriptionOptions struct {
+	filter         EventFilter
+	bufferSize     int
+	queueSize      int
+	overflowPolicy OverflowPolicy
+}
+
+func makeSubscriptionOptions(opts []SubscriptionOption) subscriptionOptions {
+	o := subscriptionOptions{
+		bufferSize: 64,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithEventFilter only delivers events for which fn returns true; other events are silently dropped
+// before the EventHandler is called (or before they are sent on the channel of Client.Events).
+func WithEventFilter(fn EventFilter) SubscriptionOption {
+	return func(o *subscriptionOptions) {
+		o.filter = fn
+	}
+}
+
+// WithBufferSize sets the capacity of the channel returned by Client.Events. The default is 64.
+func WithBufferSize(n int) SubscriptionOption {
+	return func(o *subscriptionOptions) {
+		o.bufferSize = n
+	}
+}
+
+// OverflowPolicy decides what the queue of a subscription (see WithQueue) does with an event that arrives while it
+// is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock pauses reading until there is room in the queue, as happens without a queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest silently discards the oldest queued event to make room for the new one.
+	OverflowDropOldest
+	// OverflowError discards the new event, and passes an error wrapping ErrQueueFull to the ErrorHandler.
+	OverflowError
+)
+
+// ErrQueueFull is wrapped by the error passed to the ErrorHandler of a subscription when an event is discarded
+// because its queue is full, see OverflowError.
+var ErrQueueFull = errors.New("subscription queue is full")
+
+// WithQueue runs the EventHandler of AsyncSubscription in a goroutine of its own, fed by a queue of up to size events,
+// so that reading from broker carries on while the handler processes earlier events. This smooths out bursts that a
+// slow handler would otherwise back up into broker (which may drop messages for a slow client). policy decides what
+// happens to an event that arrives while the queue is full.
 //
-//nolint:gocognit // neccessary nesting
-func AsyncSubscription(ctx context.Context, broker *Client, hm EventHandler, eh ErrorHandler) {
-	if hm == nil {
-		panic("Client.Handle must be passed a non-nil EventHandler")
+// With a queue, the ErrorHandler is called by the reading goroutine, and so may be called concurrently with the
+// EventHandler. Once reading stops, the queued events are still handled before the Subscription is done, unless
+// its context is done. The default is no queue, with the EventHandler called by the reading goroutine.
+func WithQueue(size int, policy OverflowPolicy) SubscriptionOption {
+	return func(o *subscriptionOptions) {
+		o.queueSize = size
+		o.overflowPolicy = policy
+	}
+}
+
+// EventReader is the source of events for AsyncSubscription: a *Client, or a *ReconnectingClient to carry on across
+// reconnects.
+type EventReader interface {
+	ReadEvent() (topic string, evt encoding.Event, err error)
+
+	// readOutcome classifies an error returned by ReadEvent, returning for readStopped the error (if any) that
+	// reading stopped with.
+	readOutcome(err error) (readOutcome, error)
+
+	// queueMetrics returns the Metrics to report the depth of a subscription's queue to.
+	queueMetrics() Metrics
+}
+
+// readOutcome is what an error returned by ReadEvent means for a loop reading events.
+type readOutcome int
+
+const (
+	// readContinues means that reading can carry on, e.g. after an encoding.ErrorMessage from broker.
+	readContinues readOutcome = iota
+	// readFailed means that reading can't carry on, since the connection failed.
+	readFailed
+	// readStopped means that reading can't carry on, since the connection was closed normally (by broker or with
+	// Close) or the client's context is done.
+	readStopped
+)
+
+func (c *Client) readOutcome(err error) (readOutcome, error) {
+	switch {
+	case c.ctx.Err() != nil:
+		// The client's context is done, so every further read would fail the same way.
+		return readStopped, c.ctx.Err()
+	case websocket.IsCloseError(err, websocketNormalEOFCode), errors.Is(err, net.ErrClosed):
+		// Normal EOF close, or closed by Client.Close
+		return readStopped, nil
+	case c.broken.Load():
+		// gorilla/websocket can't recover from a failed connection (e.g. an abnormal close, or a read or keepalive
+		// timeout).
+		return readFailed, nil
+	default:
+		return readContinues, nil
+	}
+}
+
+func (c *Client) queueMetrics() Metrics {
+	return c.metrics
+}
+
+// EventOrError is either an event received on a topic, or an error, as delivered by Client.Events.
+type EventOrError struct {
+	Topic string
+	Event encoding.Event
+	Err   error // if not nil, Topic and Event are unset
+}
+
+// Events reads events from the client in a new goroutine, delivering them (and any errors) on the returned channel,
+// until ctx or the context the client was created with is done, or the connection fails or is closed. The channel
+// is then closed. Errors after which the client remains usable (e.g. an encoding.ErrorMessage from broker) are
+// delivered and reading carries on, whereas an error that ends reading is delivered last, unless the connection
+// was closed normally (by broker or with Close) or a context is done.
+//
+// The channel is buffered (see WithBufferSize). If the consumer falls behind and the buffer fills, reading pauses
+// until there is room, so the backlog builds up in the network buffers and, in turn, in broker (which may drop
+// messages for a slow client). A pending read isn't interrupted when ctx is done, so the channel is only closed once
+// the next message arrives; cancel the client's context to stop promptly. Only one reader (whether Events,
+// AsyncSubscription or ReadEvent) should be used at a time.
+func (c *Client) Events(ctx context.Context, opts ...SubscriptionOption) <-chan EventOrError {
+	return readEvents(ctx, c, opts)
+}
+
+// readEvents is Events, for either kind of client.
+func readEvents(ctx context.Context, broker EventReader, opts []SubscriptionOption) <-chan EventOrError {
+	o := makeSubscriptionOptions(opts)
+	events := make(chan EventOrError, o.bufferSize)
+
+	send := func(e EventOrError) bool {
+		select {
+		case events <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
 	}
+
 	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				topic, evt, err := broker.ReadEvent()
-
-				if err != nil {
-					e, ok := err.(*websocket.CloseError) //nolint:errorlint //oh shush
-					if ok {
-						// Normal EOF close
-						if e.Code == websocketNormalEOFCode {
-							return
-						}
-
-						// Abnormal websocket error, pass to handler then exit
-						eh(err)
-						return
-					}
+		defer close(events)
 
-					//nolint:errorlint //oh shush
-					if opErr, ok := err.(*net.OpError); ok && opErr.Err.Error() == "use of closed network connection" {
+		for ctx.Err() == nil {
+			topic, evt, err := broker.ReadEvent()
+			if err != nil {
+				outcome, _ := broker.readOutcome(err)
+				if outcome == readContinues {
+					if !send(EventOrError{Err: err}) {
 						return
 					}
-					eh(err)
 					continue
 				}
 
-				hm(topic, evt)
+				if outcome == readFailed && ctx.Err() == nil {
+					send(EventOrError{Err: err})
+				}
+				return
+			}
+
+			if o.filter != nil && !o.filter(topic, evt) {
+				continue
+			}
+
+			if !send(EventOrError{Topic: topic, Event: evt}) {
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+// Subscription is a handle to the message handling loop started by AsyncSubscription.
+type Subscription struct {
+	done chan struct{}
+	err  error
+}
+
+// Done returns a channel that is closed once the loop has exited (and will no longer call its handlers).
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the loop exited, once Done is closed (and nil before then): the error from the context that was
+// done, or the error that ended reading (which was also passed to the ErrorHandler). It is nil if the connection was
+// closed normally, whether by broker or with Client.Close.
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// AsyncSubscription runs the message handling loop given an EventHandler and optional ErrorHandler, returning a
+// Subscription to wait for the loop to exit. The loop stops when ctx or the context the client was created with is
+// done, or when the connection fails or is closed. Errors after which the client remains usable (e.g. an
+// encoding.ErrorMessage from broker) are passed to the ErrorHandler and the loop carries on.
+//
+// A pending read isn't interrupted when ctx is done, so the loop only exits once the next message arrives; to stop
+// promptly, cancel the client's context or close the client.
+//
+// broker may be a *ReconnectingClient, in which case the loop carries on across reconnects, and only stops once it is
+// closed, its context is done, or it gives up reconnecting (see WithMaxReconnectAttempts).
+func AsyncSubscription(ctx context.Context, broker EventReader, hm EventHandler, eh ErrorHandler,
+	opts ...SubscriptionOption) *Subscription {
+	if hm == nil {
+		panic("Client.Handle must be passed a non-nil EventHandler")
+	}
+
+	o := makeSubscriptionOptions(opts)
+
+	sub := &Subscription{done: make(chan struct{})}
+	go func() {
+		defer close(sub.done)
+		sub.err = runSubscription(ctx, broker, hm, eh, o)
+	}()
+
+	return sub
+}
+
+// runSubscription is the message handling loop of AsyncSubscription, returning why it exited.
+func runSubscription(ctx context.Context, broker EventReader, hm EventHandler, eh ErrorHandler,
+	o subscriptionOptions) error {
+	if o.queueSize > 0 {
+		q := startEventQueue(ctx, hm, broker.queueMetrics(), o)
+		defer q.close()
+
+		hm = func(topic string, evt encoding.Event) {
+			if err := q.push(topic, evt); err != nil && eh != nil {
+				eh(err)
+			}
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		topic, evt, err := broker.ReadEvent()
+		if err != nil {
+			outcome, stopErr := broker.readOutcome(err)
+			if outcome == readStopped {
+				return stopErr
+			}
+
+			if eh != nil {
+				eh(err)
+			}
+
+			if outcome == readFailed {
+				return err
+			}
+			continue
+		}
+
+		if o.filter != nil && !o.filter(topic, evt) {
+			continue
+		}
+
+		hm(topic, evt)
+	}
+}
+
+type queuedEvent struct {
+	topic string
+	evt   encoding.Event
+}
+
+// eventQueue is the queue between the reading goroutine and the EventHandler of a subscription, see WithQueue.
+type eventQueue struct {
+	ctx     context.Context
+	metrics Metrics
+	policy  OverflowPolicy
+	events  chan queuedEvent
+	done    chan struct{} // closed once the goroutine calling the EventHandler has exited
+}
+
+// startEventQueue starts a goroutine calling hm for each event pushed to the returned queue, until it is closed or
+// ctx is done.
+func startEventQueue(ctx context.Context, hm EventHandler, metrics Metrics, o subscriptionOptions) *eventQueue {
+	q := &eventQueue{
+		ctx:     ctx,
+		metrics: metrics,
+		policy:  o.overflowPolicy,
+		events:  make(chan queuedEvent, o.queueSize),
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		defer close(q.done)
+
+		for e := range q.events {
+			if ctx.Err() != nil {
+				return
 			}
+			hm(e.topic, e.evt)
 		}
 	}()
+
+	return q
+}
+
+// push queues an event, applying the overflow policy if the queue is full, and reports the queue's depth. It returns
+// an error if the event was discarded because of OverflowError.
+func (q *eventQueue) push(topic string, evt encoding.Event) error {
+	defer func() { q.metrics.QueueDepth(len(q.events)) }()
+
+	e := queuedEvent{topic: topic, evt: evt}
+
+	switch q.policy {
+	case OverflowDropOldest:
+		for {
+			select {
+			case q.events <- e:
+				return nil
+			default:
+			}
+
+			select {
+			case <-q.events: // discard the oldest event, unless the handler has just taken it
+			default:
+			}
+		}
+	case OverflowError:
+		select {
+		case q.events <- e:
+			return nil
+		default:
+			return fmt.Errorf("%w: discarded event %s on topic %s", ErrQueueFull, evt.Name, topic)
+		}
+	default:
+		select {
+		case q.events <- e:
+		case <-q.ctx.Done(): // the subscription is exiting, so the event wouldn't be handled anyway
+		}
+		return nil
+	}
+}
+
+// close stops the queue once the events in it have been handled (unless its context is done), and waits for that.
+func (q *eventQueue) close() {
+	close(q.events)
+	<-q.done
 }
@@ -0,0 +1,32 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import "github.com/corelight/go-zeek-broker-ws/pkg/encoding"
+
+// TopicPublisher publishes events to a single topic, see Client.Topic.
+type TopicPublisher struct {
+	client *Client
+	topic  string
+}
+
+// Topic returns a TopicPublisher bound to topic, for code that publishes many events to the same topic.
+// Publishing through the handle is equivalent to calling PublishEvent with that topic.
+func (c *Client) Topic(topic string) *TopicPublisher {
+	return &TopicPublisher{client: c, topic: topic}
+}
+
+// Name returns the topic that the TopicPublisher publishes to.
+func (p *TopicPublisher) Name() string {
+	return p.topic
+}
+
+// Publish publishes an event to the TopicPublisher's topic.
+func (p *TopicPublisher) Publish(evt encoding.Event) error {
+	return p.client.PublishEvent(p.topic, evt)
+}
+
+// PublishData publishes d to the TopicPublisher's topic, as for Client.PublishData.
+func (p *TopicPublisher) PublishData(d encoding.Data) error {
+	return p.client.PublishData(p.topic, d)
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/corelight/go-zeek-broker-ws/pkg/encoding"
+	"github.com/gorilla/websocket"
+)
+
+func TestTopicPublisher_Publish(t *testing.T) {
+	type published struct {
+		topic string
+		n     uint64
+	}
+
+	received := make(chan published, 3)
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		for i := 0; i < 3; i++ {
+			var msg encoding.DataMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Errorf("reading published event failed: %v", err)
+				return
+			}
+
+			topic, evt, err := msg.GetEvent()
+			if err != nil {
+				t.Errorf("decoding published event failed: %v", err)
+				return
+			}
+
+			n, _ := evt.Arguments[0].DataValue.(uint64)
+			received <- published{topic: topic, n: n}
+		}
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	pub := c.Topic("/topic/test")
+	if pub.Name() != "/topic/test" {
+		t.Errorf("unexpected topic %s", pub.Name())
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		if err = pub.Publish(encoding.NewEvent("ping", encoding.Count(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		if got := <-received; got.topic != "/topic/test" || got.n != i {
+			t.Errorf("received event %d on topic %s, want %d on /topic/test", got.n, got.topic, i)
+		}
+	}
+}
+
+func TestTopicPublisher_PublishData(t *testing.T) {
+	received := make(chan encoding.DataMessage, 2)
+	hostPort := stubBroker(t, func(conn *websocket.Conn) {
+		for i := 0; i < 2; i++ {
+			var msg encoding.DataMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Errorf("reading published data failed: %v", err)
+				return
+			}
+			received <- msg
+		}
+	})
+
+	c, err := NewClient(context.Background(), hostPort, false, nil, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	set := encoding.Set(map[encoding.Data]struct{}{encoding.String("a"): {}, encoding.String("b"): {}})
+	if err = c.PublishData("/topic/data", encoding.Count(42)); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Topic("/topic/data").PublishData(set); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []encoding.Data{encoding.Count(42), set} {
+		msg := <-received
+		if msg.ConstType != "data-message" || msg.Topic != "/topic/data" || msg.Data == nil || !msg.Data.Equal(want) {
+			t.Errorf("received %+v, want %s on /topic/data", msg, want)
+		}
+	}
+}
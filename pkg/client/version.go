@@ -0,0 +1,122 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrIncompatibleBrokerVersion is wrapped by the error returned by NewClientWithOptions when broker's version (from
+// the handshake) is older than the minimum set by WithMinBrokerVersion, or can't be parsed.
+var ErrIncompatibleBrokerVersion = errors.New("incompatible broker version")
+
+// brokerVersion is a parsed semantic version, e.g. 2.7.0-dev.12.
+type brokerVersion struct {
+	release    [3]uint64
+	prerelease []string // the dot-separated identifiers after the "-", if any
+}
+
+// parseBrokerVersion parses a semantic version, optionally prefixed with "v". The minor and patch numbers may be
+// omitted (and are then zero), and any build metadata (after a "+") is ignored.
+func parseBrokerVersion(s string) (brokerVersion, error) {
+	var v brokerVersion
+
+	rest := strings.TrimPrefix(s, "v")
+	rest, _, _ = strings.Cut(rest, "+")
+	rest, prerelease, hasPrerelease := strings.Cut(rest, "-")
+
+	numbers := strings.Split(rest, ".")
+	if len(numbers) > len(v.release) {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	for i, n := range numbers {
+		var err error
+		if v.release[i], err = strconv.ParseUint(n, 10, 64); err != nil {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+	}
+
+	if hasPrerelease {
+		if prerelease == "" {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		v.prerelease = strings.Split(prerelease, ".")
+	}
+
+	return v, nil
+}
+
+// compare returns -1, 0 or 1 as v is older than, the same as, or newer than other, by semantic versioning's rules
+// of precedence: a pre-release is older than its release.
+func (v brokerVersion) compare(other brokerVersion) int {
+	for i := range v.release {
+		if v.release[i] != other.release[i] {
+			return compareUint(v.release[i], other.release[i])
+		}
+	}
+
+	switch {
+	case len(v.prerelease) == 0 && len(other.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(other.prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		if c := comparePrereleaseIdentifier(v.prerelease[i], other.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+
+	return compareUint(uint64(len(v.prerelease)), uint64(len(other.prerelease)))
+}
+
+// comparePrereleaseIdentifier compares identifiers of pre-release versions: numeric identifiers numerically, others
+// lexically, with numeric identifiers older than others.
+func comparePrereleaseIdentifier(a, b string) int {
+	aNum, aErr := strconv.ParseUint(a, 10, 64)
+	bNum, bErr := strconv.ParseUint(b, 10, 64)
+
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareUint(aNum, bNum)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// checkBrokerVersion returns an error wrapping ErrIncompatibleBrokerVersion if version is older than minVersion, or
+// can't be parsed.
+func checkBrokerVersion(version string, minVersion brokerVersion, minVersionString string) error {
+	v, err := parseBrokerVersion(version)
+	if err != nil {
+		return fmt.Errorf("%w: cannot check broker version: %w", ErrIncompatibleBrokerVersion, err)
+	}
+
+	if v.compare(minVersion) < 0 {
+		return fmt.Errorf("%w: broker version %s is older than the minimum of %s", ErrIncompatibleBrokerVersion,
+			version, minVersionString)
+	}
+
+	return nil
+}
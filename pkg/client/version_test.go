@@ -0,0 +1,96 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBrokerVersion_compare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "2.5.0", b: "2.5.0", want: 0},
+		{a: "v2.5.0", b: "2.5.0", want: 0},
+		{a: "2.5", b: "2.5.0", want: 0},
+		{a: "2.5.0+build.1", b: "2.5.0", want: 0},
+		{a: "2.5.1", b: "2.5.0", want: 1},
+		{a: "2.10.0", b: "2.9.0", want: 1},
+		{a: "3.0.0", b: "2.99.99", want: 1},
+		{a: "2.5.0-dev.12", b: "2.5.0", want: -1},
+		{a: "2.5.0-dev.12", b: "2.4.9", want: 1},
+		{a: "2.5.0-dev.12", b: "2.5.0-dev.9", want: 1},
+		{a: "2.5.0-dev", b: "2.5.0-dev.1", want: -1},
+		{a: "2.5.0-1", b: "2.5.0-dev", want: -1},
+		{a: "2.5.0-alpha", b: "2.5.0-beta", want: -1},
+	}
+
+	for _, tt := range tests {
+		a, err := parseBrokerVersion(tt.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := parseBrokerVersion(tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := a.compare(b); got != tt.want {
+			t.Errorf("compare(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.compare(a); got != -tt.want {
+			t.Errorf("compare(%s, %s) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestParseBrokerVersion_invalid(t *testing.T) {
+	for _, s := range []string{"", "abc", "2.x.0", "2.5.0.1", "2.5.0-", "-1.0.0"} {
+		if _, err := parseBrokerVersion(s); err == nil {
+			t.Errorf("parseBrokerVersion(%q) succeeded", s)
+		}
+	}
+}
+
+func TestClient_WithMinBrokerVersion(t *testing.T) {
+	hostPort := stubBroker(t, func(conn *websocket.Conn) { // version 2.5.0
+		_, _, _ = conn.ReadMessage()
+	})
+
+	tests := []struct {
+		minVersion       string
+		wantIncompatible bool
+	}{
+		{minVersion: "2.4.0"},
+		{minVersion: "2.5.0"},
+		{minVersion: "2.5.0-dev.1"},
+		{minVersion: "2.5.1", wantIncompatible: true},
+		{minVersion: "3.0", wantIncompatible: true},
+	}
+
+	for _, tt := range tests {
+		c, err := NewClientWithOptions(context.Background(), hostPort, WithMinBrokerVersion(tt.minVersion))
+		if tt.wantIncompatible {
+			if !errors.Is(err, ErrIncompatibleBrokerVersion) {
+				t.Errorf("minimum %s: expected ErrIncompatibleBrokerVersion but got %v", tt.minVersion, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("minimum %s: %v", tt.minVersion, err)
+			continue
+		}
+		_ = c.Close()
+	}
+
+	_, err := NewClientWithOptions(context.Background(), hostPort, WithMinBrokerVersion("latest"))
+	if err == nil || errors.Is(err, ErrIncompatibleBrokerVersion) {
+		t.Errorf("expected an invalid minimum version error but got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// AsIPFamily returns the value of an address as a net.IP, along with whether it is an IPv6 address. The family is
+// that of the address as it was written (i.e., whether it contains a ':'), so an IPv4-mapped IPv6 address such as
+// ::ffff:1.2.3.4 is reported as IPv6 even though net.IP treats it as equal to 1.2.3.4. IPv4 addresses are returned
+// in their 4-byte form and IPv6 addresses in their 16-byte form.
+func (d Data) AsIPFamily() (ip net.IP, isV6 bool, err error) {
+	if d.DataType != TypeAddress {
+		return nil, false, fmt.Errorf("expected an address but got a %s", d.DataType.String())
+	}
+
+	addr, ok := d.DataValue.(netip.Addr)
+	if !ok {
+		return nil, false, fmt.Errorf("address value has invalid type %T", d.DataValue)
+	}
+
+	if !addr.IsValid() {
+		return nil, false, fmt.Errorf("address is not valid")
+	}
+
+	return addr.AsSlice(), addr.Is6(), nil
+}
+
+// AsPrefix returns the value of a subnet exactly as it was encoded, i.e. including any host bits (e.g. 10.1.2.3/16
+// rather than 10.0.0.0/16), which is also the form that MarshalJSON emits. Use the Masked method of the result for
+// the network itself.
+func (d Data) AsPrefix() (netip.Prefix, error) {
+	if d.DataType != TypeSubnet {
+		return netip.Prefix{}, fmt.Errorf("expected a subnet but got a %s", d.DataType.String())
+	}
+
+	prefix, ok := d.DataValue.(netip.Prefix)
+	if !ok {
+		return netip.Prefix{}, fmt.Errorf("subnet value has invalid type %T", d.DataValue)
+	}
+
+	if !prefix.IsValid() {
+		return netip.Prefix{}, fmt.Errorf("subnet is not valid")
+	}
+
+	return prefix, nil
+}
+
+// Get returns the value found by following path from d, where each step is either an int, which indexes a vector,
+// or a Data, which looks up a key in a table (compared with Equal). For example, given the arguments of an event,
+// Vector(args...).Get(2, String("key"), 0) returns element 0 of the vector stored under the key "key" of the
+// table that is argument 2. An empty path returns d itself. An error, naming the failing step, is returned if a
+// step is of the wrong type for the value it is applied to, an index is out of range or a key is missing.
+func (d Data) Get(path ...interface{}) (Data, error) {
+	cur := d
+	for i, step := range path {
+		var err error
+		switch s := step.(type) {
+		case int:
+			cur, err = cur.VectorAt(s)
+		case Data:
+			cur, err = cur.tableLookup(s)
+		default:
+			err = fmt.Errorf("unsupported path step type %T (expected an int or a Data)", step)
+		}
+
+		if err != nil {
+			return Data{}, fmt.Errorf("path step %d (%v): %w", i, step, err)
+		}
+	}
+
+	return cur, nil
+}
+
+// tableLookup returns the value stored under key in the table d.
+func (d Data) tableLookup(key Data) (Data, error) {
+	if d.DataType != TypeTable {
+		return Data{}, fmt.Errorf("expected a table but got a %s", d.DataType.String())
+	}
+
+	if table, ok := d.DataValue.(map[Data]Data); ok && isMapKeyEqual(key) {
+		if v, ok := table[key]; ok {
+			return v, nil
+		}
+		return Data{}, fmt.Errorf("table key %v not found", key)
+	}
+
+	entries, err := d.tableMembers()
+	if err != nil {
+		return Data{}, err
+	}
+
+	for _, entry := range entries {
+		if entry["key"].Equal(key) {
+			return entry["value"], nil
+		}
+	}
+
+	return Data{}, fmt.Errorf("table key %v not found", key)
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestData_AsIPFamily(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantIP  net.IP
+		wantV6  bool
+		wantLen int
+		wantErr bool
+	}{
+		{name: "IPv4", json: `{"@data-type":"address","data":"1.2.3.4"}`,
+			wantIP: net.ParseIP("1.2.3.4"), wantLen: net.IPv4len},
+		{name: "IPv6", json: `{"@data-type":"address","data":"2001:db8::1"}`,
+			wantIP: net.ParseIP("2001:db8::1"), wantV6: true, wantLen: net.IPv6len},
+		{name: "IPv4-mapped IPv6", json: `{"@data-type":"address","data":"::ffff:1.2.3.4"}`,
+			wantIP: net.ParseIP("1.2.3.4"), wantV6: true, wantLen: net.IPv6len},
+		{name: "not an address", json: `{"@data-type":"string","data":"1.2.3.4"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Data
+			if err := d.UnmarshalJSON([]byte(tt.json)); err != nil {
+				t.Fatal(err)
+			}
+
+			ip, isV6, err := d.AsIPFamily()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AsIPFamily() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !ip.Equal(tt.wantIP) || isV6 != tt.wantV6 || len(ip) != tt.wantLen {
+				t.Errorf("AsIPFamily() = %v (%d bytes), %t, want %v (%d bytes), %t",
+					ip, len(ip), isV6, tt.wantIP, tt.wantLen, tt.wantV6)
+			}
+		})
+	}
+}
+
+func TestData_AsIPFamily_helper(t *testing.T) {
+	// net.ParseIP returns IPv4 addresses in their 16-byte form, but they are still IPv4.
+	_, isV6, err := Address(net.ParseIP("1.2.3.4")).AsIPFamily()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if isV6 {
+		t.Error("expected an IPv4 address")
+	}
+}
+
+func TestData_AsPrefix_hostBits(t *testing.T) {
+	for _, cidr := range []string{"196.25.1.1/16", "2001:db8::1/64", "10.0.0.0/8"} {
+		t.Run(cidr, func(t *testing.T) {
+			want := `{"@data-type":"subnet","data":"` + cidr + `"}` + "\n"
+
+			var d Data
+			if err := d.UnmarshalJSON([]byte(want)); err != nil {
+				t.Fatal(err)
+			}
+
+			prefix, err := d.AsPrefix()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if prefix.String() != cidr {
+				t.Errorf("AsPrefix() = %s, want %s", prefix, cidr)
+			}
+
+			network := netip.MustParsePrefix(cidr).Masked()
+			if prefix.Masked() != network {
+				t.Errorf("AsPrefix().Masked() = %s, want %s", prefix.Masked(), network)
+			}
+
+			buf, err := d.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(buf) != want {
+				t.Errorf("expected %s got %s", want, buf)
+			}
+		})
+	}
+}
+
+func TestData_Get(t *testing.T) {
+	var table Data
+	if err := table.UnmarshalJSON([]byte(`{"@data-type": "table", "data": [
+		{"key": {"@data-type": "string", "data": "ports"}, "value": {"@data-type": "vector", "data": [
+			{"@data-type": "port", "data": "22/tcp"},
+			{"@data-type": "port", "data": "443/tcp"}
+		]}},
+		{"key": {"@data-type": "string", "data": "name"}, "value": {"@data-type": "string", "data": "ssh"}}
+	]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	args := Vector(String("first"), Count(2), table)
+	built := Vector(Table(map[Data]Data{String("k"): Count(1)}))
+
+	tests := []struct {
+		name    string
+		d       Data
+		path    []interface{}
+		want    Data
+		wantErr string
+	}{
+		{name: "empty path", path: nil, want: args},
+		{name: "vector index", path: []interface{}{0}, want: String("first")},
+		{name: "nested", path: []interface{}{2, String("ports"), 1}, want: PortOf(443, ProtocolTCP)},
+		{name: "built table", d: built, path: []interface{}{0, String("k")}, want: Count(1)},
+		{name: "other key", path: []interface{}{2, String("name")}, want: String("ssh")},
+		{name: "missing key", path: []interface{}{2, String("nope")},
+			wantErr: `path step 1 (string("nope")): table key string("nope") not found`},
+		{name: "index out of range", path: []interface{}{2, String("ports"), 2},
+			wantErr: "path step 2 (2): vector index 2 out of range (length 2)"},
+		{name: "negative index", path: []interface{}{-1}, wantErr: "out of range"},
+		{name: "index into a table", path: []interface{}{2, 0}, wantErr: "expected a vector but got a table"},
+		{name: "key into a vector", path: []interface{}{String("x")}, wantErr: "expected a table but got a vector"},
+		{name: "unsupported step", path: []interface{}{"ports"}, wantErr: "unsupported path step type string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.d
+			if d.DataType == "" {
+				d = args
+			}
+
+			got, err := d.Get(tt.path...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected an error containing %q but got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Get(%v) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"fmt"
+	"testing"
+)
+
+// benchmarkEventJSON is a typical event: a connection record with a mix of scalar and container fields.
+const benchmarkEventJSON = `{"@data-type":"vector","data":[
+	{"@data-type":"count","data":1},{"@data-type":"count","data":1},
+	{"@data-type":"vector","data":[{"@data-type":"string","data":"connection_state_remove"},
+		{"@data-type":"vector","data":[{"@data-type":"vector","data":[
+			{"@data-type":"string","data":"CHhAvVGS1DHFjwGM9"},
+			{"@data-type":"vector","data":[
+				{"@data-type":"address","data":"192.168.1.10"},{"@data-type":"port","data":"49152/tcp"},
+				{"@data-type":"address","data":"2001:db8::1"},{"@data-type":"port","data":"443/tcp"}]},
+			{"@data-type":"timestamp","data":"2023-01-02T03:04:05.678901"},
+			{"@data-type":"timespan","data":"1.5s"},
+			{"@data-type":"enum-value","data":"Conn::SF"},
+			{"@data-type":"count","data":1234},{"@data-type":"count","data":56789},
+			{"@data-type":"real","data":0.25},{"@data-type":"boolean","data":true},
+			{"@data-type":"subnet","data":"10.0.0.0/8"},{"@data-type":"none","data":{}},
+			{"@data-type":"set","data":[{"@data-type":"string","data":"ssl"},{"@data-type":"string","data":"http"}]},
+			{"@data-type":"table","data":[
+				{"key":{"@data-type":"string","data":"a"},"value":{"@data-type":"count","data":1}},
+				{"key":{"@data-type":"string","data":"b"},"value":{"@data-type":"count","data":2}}]}
+		]}]}
+	]}
+]}`
+
+// benchmarkCase is a representative value to encode and decode, given as JSON.
+type benchmarkCase struct {
+	name string
+	json []byte
+}
+
+// benchmarkCases returns the representative values used by the encode and decode benchmarks.
+func benchmarkCases(b *testing.B) []benchmarkCase {
+	b.Helper()
+
+	marshal := func(d Data) []byte {
+		buf, err := d.MarshalJSON()
+		if err != nil {
+			b.Fatal(err)
+		}
+		return buf
+	}
+
+	const n = 10000
+	setElems := make([]Data, n)
+	table := make(map[Data]Data, n)
+	for i := 0; i < n; i++ {
+		setElems[i] = String(fmt.Sprintf("indicator-%d.example.com", i))
+		table[Count(uint64(i))] = String(fmt.Sprintf("value-%d", i))
+	}
+
+	return []benchmarkCase{
+		{name: "event", json: []byte(benchmarkEventJSON)},
+		{name: "flat event", json: marshal(*NewEvent("flat_event", String("CHhAvVGS1DHFjwGM9"), Count(1234),
+			Integer(-5), Real(0.25), Boolean(true), EnumValue("Conn::SF"), PortOf(443, ProtocolTCP)).Encode("").Data)},
+		{name: "nested vector", json: []byte(nestedVectorJSON(DefaultMaxDepth - 1))},
+		{name: "large set", json: marshal(Data{DataType: TypeSet, DataValue: setElems})},
+		{name: "large table", json: marshal(Table(table))},
+	}
+}
+
+func BenchmarkData_UnmarshalJSON(b *testing.B) {
+	for _, bc := range benchmarkCases(b) {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bc.json)))
+			for n := 0; n < b.N; n++ {
+				var d Data
+				if err := d.UnmarshalJSON(bc.json); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkData_MarshalJSON(b *testing.B) {
+	for _, bc := range benchmarkCases(b) {
+		var d Data
+		if err := d.UnmarshalJSON(bc.json); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bc.json)))
+			for n := 0; n < b.N; n++ {
+				if _, err := d.MarshalJSON(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
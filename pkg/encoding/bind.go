@@ -0,0 +1,259 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"reflect"
+	"time"
+)
+
+var (
+	dataType     = reflect.TypeOf(Data{})
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	addrType     = reflect.TypeOf(netip.Addr{})
+	ipType       = reflect.TypeOf(net.IP{})
+	prefixType   = reflect.TypeOf(netip.Prefix{})
+	ipNetType    = reflect.TypeOf(net.IPNet{})
+	serviceType  = reflect.TypeOf(Service{})
+)
+
+// Bind sets the exported fields of the struct pointed to by v from the event's arguments, by position: the first
+// exported field from the first argument, and so on. An error is returned if the number of exported fields doesn't
+// match the number of arguments, or if an argument can't be converted to the type of its field.
+//
+// Arguments are converted to fields as follows:
+//   - a string or enum value to a string; a boolean to a bool; a real to a float32 or float64
+//   - a count to any unsigned integer type and an integer to any signed integer type, if the value fits
+//   - a timestamp to a time.Time and a timespan to a time.Duration
+//   - an address to a netip.Addr or net.IP, a subnet to a netip.Prefix or net.IPNet, and a port to a Service
+//   - a vector or set to a slice, converting each element in turn
+//   - a table to a map, converting each key and value in turn (an error is returned for a key that isn't comparable,
+//     such as a vector bound to a Data key)
+//   - a vector (as broker encodes a zeek record) to a struct, by position as for the event's arguments
+//   - anything to a Data, which is set as-is
+//
+// For a pointer field, None (e.g. an unset optional record field) sets the field to nil, and any other value is
+// converted to the type pointed to.
+func (e Event) Bind(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected a non-nil pointer to a struct but got a %T", v)
+	}
+
+	return bindStruct(e.Arguments, rv.Elem(), "argument")
+}
+
+// bindStruct sets the exported fields of the struct rv from elems by position. what describes the elements in
+// errors.
+func bindStruct(elems []Data, rv reflect.Value, what string) error {
+	var fields []int
+	for i := 0; i < rv.NumField(); i++ {
+		if rv.Type().Field(i).IsExported() {
+			fields = append(fields, i)
+		}
+	}
+
+	if len(fields) != len(elems) {
+		return fmt.Errorf("%s has %d exported fields but there are %d %ss", rv.Type(), len(fields), len(elems), what)
+	}
+
+	for i, field := range fields {
+		if err := elems[i].bindValue(rv.Field(field)); err != nil {
+			return fmt.Errorf("%s %d (field %s): %w", what, i, rv.Type().Field(field).Name, err)
+		}
+	}
+
+	return nil
+}
+
+// bindValue converts d to the type of rv, and sets rv to the result.
+//
+//nolint:funlen,gocognit,gocyclo // a flat switch over all of the types is easier to follow than splitting it up
+func (d Data) bindValue(rv reflect.Value) error {
+	mismatch := func() error {
+		return fmt.Errorf("cannot convert a %s to a %s", d.DataType.String(), rv.Type())
+	}
+
+	switch rv.Type() {
+	case dataType:
+		rv.Set(reflect.ValueOf(d))
+		return nil
+	case timeType:
+		t, ok := d.DataValue.(time.Time)
+		if d.DataType != TypeTimestamp || !ok {
+			return mismatch()
+		}
+		rv.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		dur, ok := d.DataValue.(time.Duration)
+		if d.DataType != TypeTimespan || !ok {
+			return mismatch()
+		}
+		rv.SetInt(int64(dur))
+		return nil
+	case addrType, ipType:
+		addr, ok := d.DataValue.(netip.Addr)
+		if d.DataType != TypeAddress || !ok {
+			return mismatch()
+		}
+		if rv.Type() == ipType {
+			rv.Set(reflect.ValueOf(net.IP(addr.AsSlice())))
+		} else {
+			rv.Set(reflect.ValueOf(addr))
+		}
+		return nil
+	case prefixType, ipNetType:
+		prefix, ok := d.DataValue.(netip.Prefix)
+		if d.DataType != TypeSubnet || !ok {
+			return mismatch()
+		}
+		if rv.Type() == ipNetType {
+			bits := prefix.Addr().BitLen()
+			rv.Set(reflect.ValueOf(net.IPNet{
+				IP:   prefix.Addr().AsSlice(), // any host bits are kept, as for a netip.Prefix
+				Mask: net.CIDRMask(prefix.Bits(), bits),
+			}))
+		} else {
+			rv.Set(reflect.ValueOf(prefix))
+		}
+		return nil
+	case serviceType:
+		s, ok := d.DataValue.(Service)
+		if d.DataType != TypePort || !ok {
+			return mismatch()
+		}
+		rv.Set(reflect.ValueOf(s))
+		return nil
+	}
+
+	switch rv.Kind() { //nolint:exhaustive // the remaining kinds are unsupported
+	case reflect.Pointer:
+		if d.DataType == TypeNone {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+
+		elem := reflect.New(rv.Type().Elem())
+		if err := d.bindValue(elem.Elem()); err != nil {
+			return err
+		}
+		rv.Set(elem)
+		return nil
+	case reflect.String:
+		s, ok := d.DataValue.(string)
+		if (d.DataType != TypeString && d.DataType != TypeEnumValue) || !ok {
+			return mismatch()
+		}
+		rv.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, ok := d.DataValue.(bool)
+		if d.DataType != TypeBoolean || !ok {
+			return mismatch()
+		}
+		rv.SetBool(b)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, ok := d.DataValue.(float64)
+		if d.DataType != TypeReal || !ok {
+			return mismatch()
+		}
+		if rv.OverflowFloat(f) && !math.IsInf(f, 0) {
+			return fmt.Errorf("real %v overflows a %s", f, rv.Type())
+		}
+		rv.SetFloat(f)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, ok := d.DataValue.(uint64)
+		if d.DataType != TypeCount || !ok {
+			return mismatch()
+		}
+		if rv.OverflowUint(u) {
+			return fmt.Errorf("count %d overflows a %s", u, rv.Type())
+		}
+		rv.SetUint(u)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := d.DataValue.(int64)
+		if d.DataType != TypeInteger || !ok {
+			return mismatch()
+		}
+		if rv.OverflowInt(i) {
+			return fmt.Errorf("integer %d overflows a %s", i, rv.Type())
+		}
+		rv.SetInt(i)
+		return nil
+	case reflect.Slice:
+		var elems []Data
+		var err error
+		switch d.DataType { //nolint:exhaustive // only vectors and sets convert to slices
+		case TypeVector:
+			elems, err = d.vectorElements()
+		case TypeSet:
+			elems, _, err = d.setMembers()
+		default:
+			return mismatch()
+		}
+		if err != nil {
+			return err
+		}
+
+		s := reflect.MakeSlice(rv.Type(), len(elems), len(elems))
+		for i, elem := range elems {
+			if err = elem.bindValue(s.Index(i)); err != nil {
+				return fmt.Errorf("%s element %d: %w", d.DataType.String(), i, err)
+			}
+		}
+		rv.Set(s)
+		return nil
+	case reflect.Map:
+		if d.DataType != TypeTable {
+			return mismatch()
+		}
+
+		entries, err := d.tableMembers()
+		if err != nil {
+			return err
+		}
+
+		m := reflect.MakeMapWithSize(rv.Type(), len(entries))
+		for i, entry := range entries {
+			k := reflect.New(rv.Type().Key()).Elem()
+			if err = entry["key"].bindValue(k); err != nil {
+				return fmt.Errorf("table key %d: %w", i, err)
+			}
+			if !k.Comparable() {
+				// as checkComparable, since e.g. a vector bound into a Data key would panic as a map key
+				return fmt.Errorf("table key %d: a %s is not comparable and cannot be bound as a map key", i,
+					entry["key"].DataType.String())
+			}
+
+			v := reflect.New(rv.Type().Elem()).Elem()
+			if err = entry["value"].bindValue(v); err != nil {
+				return fmt.Errorf("table value %d: %w", i, err)
+			}
+
+			m.SetMapIndex(k, v)
+		}
+		rv.Set(m)
+		return nil
+	case reflect.Struct:
+		if d.DataType != TypeVector {
+			return mismatch()
+		}
+
+		elems, err := d.vectorElements()
+		if err != nil {
+			return err
+		}
+		return bindStruct(elems, rv, "record field")
+	}
+
+	return fmt.Errorf("unsupported field type %s", rv.Type())
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindConnID struct {
+	OrigH netip.Addr
+	OrigP Service
+	RespH net.IP
+	RespP Service
+}
+
+type bindState string
+
+type bindArgs struct {
+	UID      string
+	ID       bindConnID
+	TS       time.Time
+	Duration time.Duration
+	State    bindState
+	Bytes    uint32
+	Delta    int8
+	Ratio    float64
+	Local    bool
+	Network  netip.Prefix
+	Services []string
+	Counts   map[string]uint64
+	Note     *string
+	Extra    *uint64
+	Raw      Data
+
+	unexported int
+}
+
+func TestEvent_Bind(t *testing.T) {
+	ts := time.Date(2023, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+	evt := NewEvent("conn",
+		String("CHhAvVGS1DHFjwGM9"),
+		Vector(Address(net.ParseIP("10.0.0.1")), PortOf(49152, ProtocolTCP),
+			Address(net.ParseIP("2001:db8::1")), PortOf(443, ProtocolTCP)),
+		Timestamp(ts),
+		Timespan(time.Second),
+		EnumValue("Conn::SF"),
+		Count(1234),
+		Integer(-5),
+		Real(0.25),
+		Boolean(true),
+		NetIPSubnet(netip.MustParsePrefix("10.0.0.0/8")),
+		Data{DataType: TypeSet, DataValue: []Data{String("http"), String("ssl")}},
+		Table(map[Data]Data{String("a"): Count(1)}),
+		None(),
+		Count(7),
+		Vector(Count(1)),
+	)
+
+	var got bindArgs
+	if err := evt.Bind(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	extra := uint64(7)
+	want := bindArgs{
+		UID: "CHhAvVGS1DHFjwGM9",
+		ID: bindConnID{
+			OrigH: netip.MustParseAddr("10.0.0.1"),
+			OrigP: Service{Port: 49152, Protocol: ProtocolTCP},
+			RespH: net.ParseIP("2001:db8::1"),
+			RespP: Service{Port: 443, Protocol: ProtocolTCP},
+		},
+		TS:       ts,
+		Duration: time.Second,
+		State:    "Conn::SF",
+		Bytes:    1234,
+		Delta:    -5,
+		Ratio:    0.25,
+		Local:    true,
+		Network:  netip.MustParsePrefix("10.0.0.0/8"),
+		Services: []string{"http", "ssl"},
+		Counts:   map[string]uint64{"a": 1},
+		Note:     nil,
+		Extra:    &extra,
+		Raw:      Vector(Count(1)),
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Bind() =\n\t%#v\nwant\n\t%#v", got, want)
+	}
+}
+
+func TestEvent_Bind_errors(t *testing.T) {
+	type oneCount struct{ N uint8 }
+	type oneRecord struct{ R struct{ A, B string } }
+	type oneMap struct{ M map[Data]uint64 }
+
+	var vectorKeyed OrderedTable
+	vectorKeyed.Put(Vector(Count(1), Count(2)), Count(3))
+
+	tests := []struct {
+		name    string
+		evt     Event
+		v       interface{}
+		wantErr string
+	}{
+		{name: "not a pointer", evt: NewEvent("e", Count(1)), v: oneCount{}, wantErr: "expected a non-nil pointer"},
+		{name: "too few arguments", evt: NewEvent("e"), v: &oneCount{}, wantErr: "has 1 exported fields but there are 0"},
+		{name: "too many arguments", evt: NewEvent("e", Count(1), Count(2)), v: &oneCount{},
+			wantErr: "has 1 exported fields but there are 2"},
+		{name: "type mismatch", evt: NewEvent("e", String("1")), v: &oneCount{},
+			wantErr: "argument 0 (field N): cannot convert a string to a uint8"},
+		{name: "overflow", evt: NewEvent("e", Count(256)), v: &oneCount{}, wantErr: "count 256 overflows a uint8"},
+		{name: "record arity", evt: NewEvent("e", Vector(String("a"))), v: &oneRecord{},
+			wantErr: "argument 0 (field R): struct { A string; B string } has 2 exported fields but there are 1 record fields"},
+		{name: "record field mismatch", evt: NewEvent("e", Vector(String("a"), Count(1))), v: &oneRecord{},
+			wantErr: "record field 1 (field B): cannot convert a count to a string"},
+		{name: "uncomparable key", evt: NewEvent("e", vectorKeyed.Encode()), v: &oneMap{},
+			wantErr: "argument 0 (field M): table key 0: a vector is not comparable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.evt.Bind(tt.v)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
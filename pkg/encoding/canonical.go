@@ -0,0 +1,155 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"bytes"
+	"sort"
+)
+
+// MarshalCanonicalJSON is like MarshalJSON, but produces deterministic output suitable for hashing or golden
+// files: set elements and table entries (at any depth) are sorted by the bytes of their canonical JSON encoding
+// (for tables, that of the key). The output is otherwise identical to that of MarshalJSON.
+func (d Data) MarshalCanonicalJSON() ([]byte, error) {
+	c, err := d.canonical()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.MarshalJSON()
+}
+
+// MarshalCanonicalJSON is like MarshalJSON, but with the deterministic ordering of Data.MarshalCanonicalJSON.
+func (d DataMessage) MarshalCanonicalJSON() ([]byte, error) {
+	if d.Data == nil {
+		return d.MarshalJSON()
+	}
+
+	c, err := d.Data.canonical()
+	if err != nil {
+		return nil, err
+	}
+
+	d.Data = &c
+
+	return d.MarshalJSON()
+}
+
+// canonical returns a copy of d in which sets and tables are slice-backed and sorted. Values with an unexpected
+// Go type are returned as-is, leaving it to MarshalJSON to deal with them.
+//
+//nolint:gocognit // shush
+func (d Data) canonical() (Data, error) {
+	switch d.DataType { //nolint:exhaustive // only containers need to be made canonical
+	case TypeVector:
+		switch d.DataValue.(type) {
+		case []Data, lazyVector:
+		default:
+			return d, nil
+		}
+
+		elems, err := d.vectorElements()
+		if err != nil {
+			return Data{}, err
+		}
+
+		out := make([]Data, len(elems))
+		for i, elem := range elems {
+			if out[i], err = elem.canonical(); err != nil {
+				return Data{}, err
+			}
+		}
+
+		return Data{DataType: TypeVector, DataValue: out}, nil
+	case TypeSet:
+		var elems []Data
+		switch set := d.DataValue.(type) {
+		case []Data:
+			elems = set
+		case map[Data]struct{}:
+			elems = setElements(set)
+		default:
+			return d, nil
+		}
+
+		sorted := make([]canonicalEntry, len(elems))
+		for i, elem := range elems {
+			var err error
+			if sorted[i], err = makeCanonicalEntry(elem, None()); err != nil {
+				return Data{}, err
+			}
+		}
+		sortCanonicalEntries(sorted)
+
+		out := make([]Data, len(sorted))
+		for i, entry := range sorted {
+			out[i] = entry.key
+		}
+
+		return Data{DataType: TypeSet, DataValue: out}, nil
+	case TypeTable:
+		var entries []map[string]Data
+		switch table := d.DataValue.(type) {
+		case []map[string]Data:
+			entries = table
+		case map[Data]Data:
+			entries = tableEntries(table)
+		default:
+			return d, nil
+		}
+
+		sorted := make([]canonicalEntry, len(entries))
+		for i, entry := range entries {
+			var err error
+			if sorted[i], err = makeCanonicalEntry(entry["key"], entry["value"]); err != nil {
+				return Data{}, err
+			}
+		}
+		sortCanonicalEntries(sorted)
+
+		out := make([]map[string]Data, len(sorted))
+		for i, entry := range sorted {
+			out[i] = map[string]Data{
+				"key":   entry.key,
+				"value": entry.value,
+			}
+		}
+
+		return Data{DataType: TypeTable, DataValue: out}, nil
+	default:
+		return d, nil
+	}
+}
+
+// canonicalEntry is a canonical set element (with a None value) or table entry, along with the encoding of
+// its key used for sorting.
+type canonicalEntry struct {
+	key      Data
+	value    Data
+	keyBytes []byte
+}
+
+func makeCanonicalEntry(key, value Data) (canonicalEntry, error) {
+	var entry canonicalEntry
+	var err error
+
+	if entry.key, err = key.canonical(); err != nil {
+		return canonicalEntry{}, err
+	}
+
+	if entry.value, err = value.canonical(); err != nil {
+		return canonicalEntry{}, err
+	}
+
+	if entry.keyBytes, err = entry.key.MarshalJSON(); err != nil {
+		return canonicalEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func sortCanonicalEntries(entries []canonicalEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].keyBytes, entries[j].keyBytes) < 0
+	})
+}
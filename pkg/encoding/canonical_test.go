@@ -0,0 +1,84 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestData_MarshalCanonicalJSON(t *testing.T) {
+	set := Set(map[Data]struct{}{
+		String("foo"): {},
+		String("bar"): {},
+		Count(1):      {},
+	})
+
+	want := []byte(`{"@data-type":"set","data":[` +
+		`{"@data-type":"count","data":1},` +
+		`{"@data-type":"string","data":"bar"},` +
+		`{"@data-type":"string","data":"foo"}]}` + "\n")
+
+	got, err := set.MarshalCanonicalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(want, got) {
+		t.Errorf("expected %s got %s", want, got)
+	}
+
+	table := Table(map[Data]Data{
+		Count(11): Set(map[Data]struct{}{String("y"): {}, String("x"): {}}),
+		Count(5):  String("five"),
+	})
+
+	want = []byte(`{"@data-type":"table","data":[` +
+		`{"key":{"@data-type":"count","data":11},"value":{"@data-type":"set","data":[` +
+		`{"@data-type":"string","data":"x"},{"@data-type":"string","data":"y"}]}},` +
+		`{"key":{"@data-type":"count","data":5},"value":{"@data-type":"string","data":"five"}}]}` + "\n")
+
+	got, err = table.MarshalCanonicalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(want, got) {
+		t.Errorf("expected %s got %s", want, got)
+	}
+}
+
+func TestData_MarshalCanonicalJSON_stable(t *testing.T) {
+	elems := make(map[Data]struct{})
+	entries := make(map[Data]Data)
+	for i := 0; i < 100; i++ {
+		elems[String(fmt.Sprintf("elem-%d", i))] = struct{}{}
+		entries[Count(uint64(i))] = Vector(String(fmt.Sprintf("value-%d", i)))
+	}
+	built := NewEvent("test", Set(elems), Table(entries)).Encode("/topic/test")
+
+	want, err := built.MarshalCanonicalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decoded sets and tables are map-backed, and must produce the same output as the helper-built ones.
+	var decoded DataMessage
+	if err = decoded.UnmarshalJSON(want); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		for _, dm := range []DataMessage{built, decoded} {
+			got, err := dm.MarshalCanonicalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(want, got) {
+				t.Fatalf("canonical output is not stable, expected %s got %s", want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// connIDFields is the number of fields in the Zeek conn_id record that we understand (orig_h, orig_p, resp_h, resp_p).
+const connIDFields = 4
+
+// ErrConnIDMixedFamily is returned when a ConnID's originator and responder addresses are not of the same IP family.
+var ErrConnIDMixedFamily = errors.New("conn_id originator and responder addresses must both be IPv4 or both be IPv6")
+
+// ErrConnIDMixedProtocol is returned when a ConnID's originator and responder ports have different protocols.
+var ErrConnIDMixedProtocol = errors.New("conn_id originator and responder ports must have the same protocol")
+
+// ConnID is a Go representation of the Zeek conn_id record, which is encoded by broker as a vector of
+// fields in declaration order (orig_h, orig_p, resp_h, resp_p).
+type ConnID struct {
+	OrigH net.IP
+	OrigP Service
+	RespH net.IP
+	RespP Service
+}
+
+// ParseConnID extracts a ConnID from a Zeek conn_id record. Any trailing fields beyond the four that
+// ConnID models (as added by newer versions of Zeek) are ignored.
+func ParseConnID(d Data) (ConnID, error) {
+	if d.DataType != TypeVector {
+		return ConnID{}, fmt.Errorf("expected conn_id record to be encoded as a vector but got a %s",
+			d.DataType.String())
+	}
+
+	fields, ok := d.DataValue.([]Data)
+	if !ok {
+		return ConnID{}, fmt.Errorf("conn_id record has invalid parsed type (%T)", d.DataValue)
+	}
+
+	if len(fields) < connIDFields {
+		return ConnID{}, fmt.Errorf("conn_id record has too few fields (%d)", len(fields))
+	}
+
+	var c ConnID
+	var err error
+
+	if c.OrigH, err = connIDAddress("orig_h", fields[0]); err != nil {
+		return ConnID{}, err
+	}
+	if c.OrigP, err = connIDPort("orig_p", fields[1]); err != nil {
+		return ConnID{}, err
+	}
+	if c.RespH, err = connIDAddress("resp_h", fields[2]); err != nil {
+		return ConnID{}, err
+	}
+	if c.RespP, err = connIDPort("resp_p", fields[3]); err != nil {
+		return ConnID{}, err
+	}
+
+	return c, c.Validate()
+}
+
+func connIDAddress(name string, d Data) (net.IP, error) {
+	if d.DataType != TypeAddress {
+		return nil, fmt.Errorf("conn_id field %s has invalid type (%s)", name, d.DataType.String())
+	}
+
+	addr, ok := d.DataValue.(netip.Addr)
+	if !ok {
+		return nil, fmt.Errorf("conn_id field %s has invalid parsed type (%T)", name, d.DataValue)
+	}
+
+	return addr.AsSlice(), nil
+}
+
+func connIDPort(name string, d Data) (Service, error) {
+	if d.DataType != TypePort {
+		return Service{}, fmt.Errorf("conn_id field %s has invalid type (%s)", name, d.DataType.String())
+	}
+
+	s, ok := d.DataValue.(Service)
+	if !ok {
+		return Service{}, fmt.Errorf("conn_id field %s has invalid parsed type (%T)", name, d.DataValue)
+	}
+
+	return s, nil
+}
+
+// Validate checks that the originator and responder addresses are of the same IP family and that
+// the originator and responder ports use the same protocol.
+func (c ConnID) Validate() error {
+	if c.OrigH == nil || c.RespH == nil {
+		return fmt.Errorf("conn_id addresses must not be nil")
+	}
+
+	if (c.OrigH.To4() == nil) != (c.RespH.To4() == nil) {
+		return ErrConnIDMixedFamily
+	}
+
+	if c.OrigP.Protocol != c.RespP.Protocol {
+		return ErrConnIDMixedProtocol
+	}
+
+	return nil
+}
+
+// Encode encodes a ConnID as the record vector that Zeek expects for a conn_id.
+func (c ConnID) Encode() Data {
+	return Vector(
+		Address(c.OrigH),
+		Port(c.OrigP),
+		Address(c.RespH),
+		Port(c.RespP),
+	)
+}
+
+// AppendConnID validates the ConnID and appends it to the event's arguments.
+func (e *Event) AppendConnID(c ConnID) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	e.Arguments = append(e.Arguments, c.Encode())
+
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestConnID_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		c    ConnID
+	}{
+		{name: "IPv4", c: ConnID{
+			OrigH: net.ParseIP("10.0.0.1"),
+			OrigP: Service{Port: 49152, Protocol: ProtocolTCP},
+			RespH: net.ParseIP("192.168.1.1"),
+			RespP: Service{Port: 443, Protocol: ProtocolTCP},
+		}},
+		{name: "IPv6", c: ConnID{
+			OrigH: net.ParseIP("2001:db8::1"),
+			OrigP: Service{Port: 5353, Protocol: ProtocolUDP},
+			RespH: net.ParseIP("ff02::fb"),
+			RespP: Service{Port: 5353, Protocol: ProtocolUDP},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evt := NewEvent("connection_seen")
+			if err := evt.AppendConnID(tt.c); err != nil {
+				t.Fatal(err)
+			}
+
+			buf, err := json.Marshal(evt.Encode("/topic/test"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dm DataMessage
+			if err = json.Unmarshal(buf, &dm); err != nil {
+				t.Fatal(err)
+			}
+
+			_, gotEvt, err := dm.GetEvent()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(gotEvt.Arguments) != 1 {
+				t.Fatalf("expected 1 argument but got %d", len(gotEvt.Arguments))
+			}
+
+			got, err := ParseConnID(gotEvt.Arguments[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !got.OrigH.Equal(tt.c.OrigH) || !got.RespH.Equal(tt.c.RespH) ||
+				got.OrigP != tt.c.OrigP || got.RespP != tt.c.RespP {
+				t.Errorf("output value incorrect, wanted: \n\t%#v\ngot: \n\t%#v", tt.c, got)
+			}
+		})
+	}
+}
+
+func TestConnID_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       ConnID
+		wantErr error
+	}{
+		{name: "mixed family", wantErr: ErrConnIDMixedFamily, c: ConnID{
+			OrigH: net.ParseIP("10.0.0.1"),
+			OrigP: Service{Port: 1234, Protocol: ProtocolTCP},
+			RespH: net.ParseIP("2001:db8::1"),
+			RespP: Service{Port: 80, Protocol: ProtocolTCP},
+		}},
+		{name: "mixed protocol", wantErr: ErrConnIDMixedProtocol, c: ConnID{
+			OrigH: net.ParseIP("10.0.0.1"),
+			OrigP: Service{Port: 1234, Protocol: ProtocolTCP},
+			RespH: net.ParseIP("10.0.0.2"),
+			RespP: Service{Port: 53, Protocol: ProtocolUDP},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evt := NewEvent("connection_seen")
+			if err := evt.AppendConnID(tt.c); !errors.Is(err, tt.wantErr) {
+				t.Errorf("AppendConnID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(evt.Arguments) != 0 {
+				t.Errorf("invalid conn_id was appended to the event arguments")
+			}
+
+			if _, err := ParseConnID(tt.c.Encode()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseConnID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseConnID_invalid(t *testing.T) {
+	if _, err := ParseConnID(String("foo")); err == nil {
+		t.Error("expected an error for a non-vector conn_id")
+	}
+
+	if _, err := ParseConnID(Vector(Address(net.ParseIP("10.0.0.1")))); err == nil {
+		t.Error("expected an error for a conn_id with too few fields")
+	}
+
+	if _, err := ParseConnID(Vector(String("x"), String("y"), String("z"), String("w"))); err == nil {
+		t.Error("expected an error for a conn_id with fields of the wrong type")
+	}
+}
@@ -5,12 +5,17 @@ package encoding
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
-	"net"
+	"math/big"
+	"net/netip"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 )
 
 //go:generate go-enum --marshal
@@ -26,8 +31,8 @@ Timespan = "timespan" // String-encoded time span (maps to time.Duration)
 Timestamp = "timestamp" // ISO 8601 encoded time in YYYY-MM-DDThh:mm:ss.sss format (maps to time.Time)
 String = "string" // Native JSON string (maps to string)
 EnumValue = "enum-value" // Zeek enum value mapped to native JSON string (maps to string)
-Address = "address" // String-encoded IPv4/IPv6 address (maps to net.Addr)
-Subnet = "subnet" // String-encoded IPv4/IPv6 subnet in <address>/<prefix-length> format (maps to net.IPNet)
+Address = "address" // String-encoded IPv4/IPv6 address (maps to netip.Addr)
+Subnet = "subnet" // String-encoded IPv4/IPv6 subnet in <address>/<prefix-length> format (maps to netip.Prefix, host bits preserved)
 Port = "port" // String-encoded service port in <port>/<protocol> format (maps to encoding.Service)
 Vector = "vector" // Sequence of encoding.Data (maps to []Data)
 Set = "set" // Sequence of encoding.Data with distinct objects (maps to map[Data]struct{})
@@ -39,7 +44,17 @@ type Type string
 
 const nanosecondsIn24Hours = 8.64e+13
 
-const brokerTimeFormat = "2006-01-02T15:04:05.000"
+// Timestamps are encoded with millisecond precision, or with microsecond or nanosecond precision when needed
+// to represent the value exactly (see formatTimestamp).
+const (
+	brokerTimeFormat      = "2006-01-02T15:04:05.000"
+	brokerTimeFormatMicro = "2006-01-02T15:04:05.000000"
+	brokerTimeFormatNano  = "2006-01-02T15:04:05.000000000"
+)
+
+// brokerTimeParseFormat is used to decode timestamps. When parsing, time.Parse accepts a fractional second of
+// any length after the seconds field even though the layout doesn't include one.
+const brokerTimeParseFormat = "2006-01-02T15:04:05"
 
 // Data is the recursive type/value structure used by the Zeek broker websocket encoding.
 type Data struct {
@@ -47,6 +62,10 @@ type Data struct {
 	DataValue interface{} `json:"data"`
 }
 
+// ErrNonFiniteReal is returned when marshalling a Real that is infinite or NaN, since JSON (and therefore broker)
+// has no representation for such values. Decoding a real that is out of the range of a float64 also returns it.
+var ErrNonFiniteReal = errors.New("real value is not finite")
+
 // AckMessage is the handshake sent by broker on connect.
 type AckMessage struct {
 	ConstType    string `json:"type"` // always "ack"
@@ -67,10 +86,7 @@ func (e ErrorMessage) Error() string {
 }
 
 // decode unpacks values from a JSON object deserialised to a map.
-//
-//nolint:funlen // it just needs to be long due to the verbosity of error checking
-//nolint:gocognit // shush
-func (d *Data) decode(rawDataPtr *map[string]interface{}) error {
+func (d *Data) decode(rawDataPtr *map[string]interface{}, st *decodeState) error {
 	rawData := *rawDataPtr
 	t, ok := rawData["@data-type"]
 	if !ok {
@@ -93,6 +109,25 @@ func (d *Data) decode(rawDataPtr *map[string]interface{}) error {
 		return err
 	}
 
+	return d.decodeValue(v, st)
+}
+
+// decodeValue unpacks the "data" property v of a JSON object deserialised to a map, given that d.DataType
+// has been set from its "@data-type" property.
+//
+//nolint:funlen // it just needs to be long due to the verbosity of error checking
+//nolint:gocognit // shush
+func (d *Data) decodeValue(v interface{}, st *decodeState) error {
+	var ok bool
+	var err error
+
+	if d.DataType == TypeVector || d.DataType == TypeSet || d.DataType == TypeTable {
+		if err = st.enter(); err != nil {
+			return err
+		}
+		defer st.leave()
+	}
+
 	var numberValue json.Number
 	if d.DataType == TypeReal || d.DataType == TypeInteger || d.DataType == TypeCount {
 		numberValue, ok = v.(json.Number)
@@ -134,6 +169,9 @@ func (d *Data) decode(rawDataPtr *map[string]interface{}) error {
 	case TypeReal:
 		f, err := numberValue.Float64()
 		if err != nil {
+			if math.IsInf(f, 0) {
+				return fmt.Errorf("%w: %s overflows a float64", ErrNonFiniteReal, numberValue.String())
+			}
 			return fmt.Errorf("problem converting Real type to float64: %w", err)
 		}
 		d.DataValue = f
@@ -154,36 +192,32 @@ func (d *Data) decode(rawDataPtr *map[string]interface{}) error {
 		}
 		d.DataValue = i
 	case TypeTimespan:
-		if strings.HasSuffix(stringValue, "min") {
-			stringValue = stringValue[:len(stringValue)-2]
-		}
-		if strings.HasSuffix(stringValue, "d") {
-			days, err := strconv.ParseFloat(stringValue[:len(stringValue)-1], 64)
-			if err != nil {
-				return err
-			}
-			d.DataValue = time.Duration(math.Trunc(days * nanosecondsIn24Hours))
-			return nil
-		}
-		d.DataValue, err = time.ParseDuration(stringValue)
+		d.DataValue, err = parseTimespan(stringValue)
 		if err != nil {
 			return err
 		}
 	case TypeTimestamp:
-		d.DataValue, err = time.Parse(brokerTimeFormat, stringValue)
+		// With no zone in the layout, the time is parsed (and so always returned) as UTC.
+		d.DataValue, err = time.Parse(brokerTimeParseFormat, stringValue)
 		if err != nil {
 			return err
 		}
 	case TypeAddress:
-		d.DataValue = net.ParseIP(stringValue)
-		if d.DataValue == nil {
-			return fmt.Errorf("JSON string encoded Address (%s) failed to parse", stringValue)
+		// Stored as a netip.Addr rather than a net.IP since slices are not comparable and Data must be
+		// usable as a map key. IPv4-mapped IPv6 addresses are kept as-is (i.e., not unmapped).
+		addr, err := netip.ParseAddr(stringValue)
+		if err != nil {
+			return fmt.Errorf("JSON string encoded Address (%s) failed to parse: %w", stringValue, err)
 		}
+		d.DataValue = addr
 	case TypeSubnet:
-		_, d.DataValue, err = net.ParseCIDR(stringValue)
+		// Unlike net.ParseCIDR, any host bits are retained (e.g., 10.1.2.3/16 is not turned into 10.0.0.0/16)
+		// so that the subnet is re-encoded exactly as it was received.
+		prefix, err := netip.ParsePrefix(stringValue)
 		if err != nil {
 			return err
 		}
+		d.DataValue = prefix
 	case TypePort:
 		service, err := ParseService(stringValue)
 		if err != nil {
@@ -196,6 +230,10 @@ func (d *Data) decode(rawDataPtr *map[string]interface{}) error {
 			return fmt.Errorf("expected Vector type to be serialized as JSON array but got type %T value %v", v, v)
 		}
 
+		if err = st.addElements(len(va)); err != nil {
+			return err
+		}
+
 		datas := make([]Data, len(va))
 		for i, intf := range va {
 			m, ok := intf.(map[string]interface{})
@@ -203,7 +241,7 @@ func (d *Data) decode(rawDataPtr *map[string]interface{}) error {
 				return fmt.Errorf("expected Vector type elements to be serialized as JSON objects but got type %T value %v",
 					intf, intf)
 			}
-			err = datas[i].decode(&m)
+			err = datas[i].decode(&m, st)
 			if err != nil {
 				return fmt.Errorf("error decoding Vector element %d: %w", i, err)
 			}
@@ -215,6 +253,10 @@ func (d *Data) decode(rawDataPtr *map[string]interface{}) error {
 			return fmt.Errorf("expected Set type to be serialized as JSON array but got type %T value %v", v, v)
 		}
 
+		if err = st.addElements(len(sa)); err != nil {
+			return err
+		}
+
 		datas := make(map[Data]struct{}, len(sa))
 		for i, intf := range sa {
 			m, ok := intf.(map[string]interface{})
@@ -224,11 +266,15 @@ func (d *Data) decode(rawDataPtr *map[string]interface{}) error {
 			}
 
 			var dElem Data
-			err = dElem.decode(&m)
+			err = dElem.decode(&m, st)
 			if err != nil {
 				return fmt.Errorf("error decoding Set element %d: %w", i, err)
 			}
 
+			if err = checkComparable(dElem); err != nil {
+				return fmt.Errorf("error decoding Set element %d: %w", i, err)
+			}
+
 			if _, ok := datas[dElem]; ok {
 				return fmt.Errorf("duplicate Set element %d: %#v", i, dElem)
 			}
@@ -242,6 +288,10 @@ func (d *Data) decode(rawDataPtr *map[string]interface{}) error {
 			return fmt.Errorf("expected Table type to be serialized as JSON array but got type %T value %v", v, v)
 		}
 
+		if err = st.addElements(len(ta)); err != nil {
+			return err
+		}
+
 		datas := make(map[Data]Data, len(ta))
 		for i, intf := range ta {
 			m, ok := intf.(map[string]interface{})
@@ -266,7 +316,7 @@ func (d *Data) decode(rawDataPtr *map[string]interface{}) error {
 			}
 
 			var dKey Data
-			err = dKey.decode(&mkm)
+			err = dKey.decode(&mkm, st)
 			if err != nil {
 				return fmt.Errorf("error decoding Table key element %d: %w", i, err)
 			}
@@ -283,11 +333,15 @@ func (d *Data) decode(rawDataPtr *map[string]interface{}) error {
 			}
 
 			var dValue Data
-			err = dValue.decode(&mvm)
+			err = dValue.decode(&mvm, st)
 			if err != nil {
 				return fmt.Errorf("error decoding Table value element %d: %w", i, err)
 			}
 
+			if err = checkComparable(dKey); err != nil {
+				return fmt.Errorf("error decoding Table key element %d: %w", i, err)
+			}
+
 			if _, ok := datas[dKey]; ok {
 				return fmt.Errorf("duplicate Table key %d: %#v", i, dKey)
 			}
@@ -301,49 +355,175 @@ func (d *Data) decode(rawDataPtr *map[string]interface{}) error {
 
 }
 
-// UnmarshalJSON implemnts the Unmarshaller interface for Data. It calls json.Unmarshal to produce a map[string]interface{}
-// which is then passed to Data.decode() which does the heavy lifting.
+// checkComparable returns an error if d can't be used as a key of a map-backed set or table, e.g. a vector (as
+// used by zeek for the composite keys of multi-index sets and tables), rather than letting the insertion panic.
+func checkComparable(d Data) error {
+	if d.DataValue != nil && !reflect.TypeOf(d.DataValue).Comparable() {
+		return fmt.Errorf("a %s is not comparable and cannot be decoded as a set element or table key",
+			d.DataType.String())
+	}
+
+	return nil
+}
+
+// UnmarshalJSON implemnts the Unmarshaller interface for Data. The JSON is read as a stream of tokens by a Decoder,
+// rather than first being deserialised to a map[string]interface{}, to limit allocations. The default
+// DecoderOptions apply.
 func (d *Data) UnmarshalJSON(b []byte) error {
-	var rawData map[string]interface{}
+	return d.UnmarshalJSONWithOptions(b, DecoderOptions{})
+}
+
+// UnmarshalJSONWithOptions is like UnmarshalJSON, but with limits given by opts.
+func (d *Data) UnmarshalJSONWithOptions(b []byte, opts DecoderOptions) error {
+	if err := opts.checkSize(len(b)); err != nil {
+		return err
+	}
 
-	dec := json.NewDecoder(bytes.NewReader(b))
-	dec.UseNumber()
+	dec := NewDecoder(bytes.NewReader(b))
+	dec.SetOptions(opts)
 
-	if err := dec.Decode(&rawData); err != nil {
+	data, err := dec.Decode()
+	if err != nil {
 		return err
 	}
 
-	return d.decode(&rawData)
+	*d = data
+	return nil
 }
 
-// formatTimespan implements the string encoding of the zeek timespan type in the format specific to the broker WS API.
-func formatTimespan(duration time.Duration) string {
-	trim := func(s string) string {
-		return strings.TrimRight(strings.TrimRight(s, "0"), ".")
+// timespanUnits maps the unit suffixes that zeek/broker may use for a timespan to their duration.
+var timespanUnits = map[string]time.Duration{
+	"ns":    time.Nanosecond,
+	"nsec":  time.Nanosecond,
+	"nsecs": time.Nanosecond,
+	"us":    time.Microsecond,
+	"µs":    time.Microsecond,
+	"usec":  time.Microsecond,
+	"usecs": time.Microsecond,
+	"ms":    time.Millisecond,
+	"msec":  time.Millisecond,
+	"msecs": time.Millisecond,
+	"s":     time.Second,
+	"sec":   time.Second,
+	"secs":  time.Second,
+	"m":     time.Minute,
+	"min":   time.Minute,
+	"mins":  time.Minute,
+	"h":     time.Hour,
+	"hr":    time.Hour,
+	"hrs":   time.Hour,
+	"d":     nanosecondsIn24Hours,
+	"day":   nanosecondsIn24Hours,
+	"days":  nanosecondsIn24Hours,
+}
+
+// parseTimespan parses the string encoding of the zeek timespan type, i.e. a (possibly fractional and possibly
+// negative, since zeek intervals can be) number followed by one of the unit suffixes in timespanUnits. Anything else
+// (e.g. "1h30m") is left to time.ParseDuration.
+//
+// The number is converted exactly and then rounded to the nearest nanosecond, so any value produced by
+// formatTimespan decodes back to the same time.Duration. Precision beyond a nanosecond is lost, and values
+// outside the range of a time.Duration (roughly ±292 years) are rejected.
+func parseTimespan(s string) (time.Duration, error) {
+	i := strings.LastIndexFunc(s, func(r rune) bool { return !unicode.IsLetter(r) }) + 1
+
+	if unit, ok := timespanUnits[s[i:]]; ok && !strings.Contains(s[:i], "/") {
+		if r, ok := new(big.Rat).SetString(s[:i]); ok {
+			n := roundRat(r.Mul(r, new(big.Rat).SetInt64(int64(unit))))
+			if !n.IsInt64() {
+				return 0, fmt.Errorf("timespan %q is out of range", s)
+			}
+			return time.Duration(n.Int64()), nil
+		}
 	}
 
-	ret := float64(duration) // Nanoseconds
-	if duration.Abs() < time.Millisecond {
-		return trim(fmt.Sprintf("%.4f", ret)) + "ns"
+	return time.ParseDuration(s)
+}
+
+// roundRat rounds r to the nearest integer, with halves rounded away from zero.
+func roundRat(r *big.Rat) *big.Int {
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if m.Sign() == 0 {
+		return q
+	}
+
+	if new(big.Int).Mul(new(big.Int).Abs(m), big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(r.Sign())))
+	}
+
+	return q
+}
+
+// formatTimestamp implements the string encoding of the zeek timestamp type. The encoding has no zone and broker
+// timestamps are relative to the UTC epoch, so ts is converted to UTC first. The fractional second has three, six
+// or nine digits, whichever is the fewest that represent ts exactly, so millisecond timestamps are encoded as
+// they always have been.
+func formatTimestamp(ts time.Time) string {
+	ts = ts.UTC()
+
+	switch ns := ts.Nanosecond(); {
+	case ns%int(time.Millisecond) == 0:
+		return ts.Format(brokerTimeFormat)
+	case ns%int(time.Microsecond) == 0:
+		return ts.Format(brokerTimeFormatMicro)
+	default:
+		return ts.Format(brokerTimeFormatNano)
 	}
-	if duration.Abs() < time.Second {
-		return trim(fmt.Sprintf("%.4f", ret/float64(time.Millisecond))) + "ms"
+}
+
+// formatTimespan implements the string encoding of the zeek timespan type in the format specific to the broker WS API.
+// Enough fractional digits are included for parseTimespan to recover the exact duration. Negative durations are
+// encoded with a leading '-' and the unit chosen by their absolute value (e.g. -90s is encoded as "-1.5min").
+func formatTimespan(duration time.Duration) string {
+	abs := duration.Abs()
+
+	unit, suffix := time.Duration(nanosecondsIn24Hours), "d"
+	switch {
+	case abs < time.Millisecond:
+		unit, suffix = time.Nanosecond, "ns"
+	case abs < time.Second:
+		unit, suffix = time.Millisecond, "ms"
+	case abs < time.Minute:
+		unit, suffix = time.Second, "s"
+	case abs < time.Hour:
+		unit, suffix = time.Minute, "min"
+	case abs < nanosecondsIn24Hours:
+		unit, suffix = time.Hour, "h"
 	}
-	if duration.Abs() < time.Minute {
-		return trim(fmt.Sprintf("%.4f", ret/float64(time.Second))) + "s"
+
+	sign := ""
+	if duration < 0 {
+		sign = "-"
 	}
-	if duration.Abs() < time.Hour {
-		return trim(fmt.Sprintf("%.4f", ret/float64(time.Minute))) + "min"
+
+	return sign + formatDecimal(abs, unit) + suffix
+}
+
+// formatDecimal formats d/unit as a decimal number, with as many fractional digits as unit has digits (which is
+// enough to identify the value to within half a nanosecond) and without trailing zeros.
+func formatDecimal(d, unit time.Duration) string {
+	whole, rem := int64(d/unit), int64(d%unit)
+	if rem == 0 {
+		return strconv.FormatInt(whole, 10)
 	}
-	if duration.Abs() < nanosecondsIn24Hours {
-		return trim(fmt.Sprintf("%.4f", ret/float64(time.Hour))) + "h"
+
+	digits := len(strconv.FormatInt(int64(unit), 10))
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	frac := roundRat(new(big.Rat).SetFrac(new(big.Int).Mul(big.NewInt(rem), scale), big.NewInt(int64(unit))))
+
+	if frac.Cmp(scale) == 0 {
+		return strconv.FormatInt(whole+1, 10)
 	}
-	return trim(fmt.Sprintf("%.4f", ret/nanosecondsIn24Hours)) + "d"
+
+	fracDigits := frac.String()
+	fracDigits = strings.TrimRight(strings.Repeat("0", digits-len(fracDigits))+fracDigits, "0")
+
+	return strconv.FormatInt(whole, 10) + "." + fracDigits
 }
 
 // MarshalJSON implements the Marshaller interface for Data, taking care specific cases where json.Marshal doesn't
 // produce output compliant to the zeek broker websocket JSON encoding (e.g., timestamps, ports, etc).
-func (d *Data) MarshalJSON() ([]byte, error) {
+func (d Data) MarshalJSON() ([]byte, error) {
 	switch d.DataType {
 	case TypeTimestamp:
 		ts, ok := d.DataValue.(time.Time)
@@ -352,7 +532,7 @@ func (d *Data) MarshalJSON() ([]byte, error) {
 		}
 		return json.Marshal(map[string]interface{}{
 			"@data-type": d.DataType,
-			"data":       ts.Format(brokerTimeFormat),
+			"data":       formatTimestamp(ts),
 		})
 	case TypeTimespan:
 		dur, ok := d.DataValue.(time.Duration)
@@ -372,25 +552,85 @@ func (d *Data) MarshalJSON() ([]byte, error) {
 			"@data-type": d.DataType,
 			"data":       fmt.Sprintf("%d/%s", serv.Port, serv.Protocol.String()),
 		})
+	case TypeReal:
+		if f, ok := d.DataValue.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+			return nil, fmt.Errorf("%w: %v", ErrNonFiniteReal, f)
+		}
+		return d.marshalValue(d.DataValue)
+	case TypeVector:
+		// A nil slice (e.g. from calling the Vector helper with no elements) is still an empty vector.
+		if elems, ok := d.DataValue.([]Data); ok && elems == nil {
+			return d.marshalValue([]Data{})
+		}
+		return d.marshalValue(d.DataValue)
+	case TypeSet:
+		// Decoded sets are map-backed, whereas the Set helper produces a slice.
+		if set, ok := d.DataValue.(map[Data]struct{}); ok {
+			return d.marshalValue(setElements(set))
+		}
+		return d.marshalValue(d.DataValue)
+	case TypeTable:
+		// Decoded tables are map-backed, whereas the Table helper produces a slice of key/value maps.
+		if table, ok := d.DataValue.(map[Data]Data); ok {
+			return d.marshalValue(tableEntries(table))
+		}
+		return d.marshalValue(d.DataValue)
 	case TypeNone:
 		return []byte(`{"@data-type":"none","data":{}}`), nil
 	default:
-		buf := &bytes.Buffer{}
-		enc := json.NewEncoder(buf)
-		enc.SetEscapeHTML(false)
+		return d.marshalValue(d.DataValue)
+	}
+}
 
-		if err := enc.Encode(map[string]interface{}{
-			"@data-type": d.DataType,
-			"data":       d.DataValue,
-		}); err != nil {
-			return nil, err
-		}
+// marshalValue encodes the data type and the provided value (without escaping HTML entities).
+func (d Data) marshalValue(value interface{}) ([]byte, error) {
+	return marshalPooled(dataEnvelope{DataType: d.DataType, Data: value})
+}
 
-		return buf.Bytes(), nil
-	}
+// dataEnvelope is the JSON object for a Data value. A struct is cheaper to encode than the equivalent map, and
+// its fields are in the same (sorted) order in which a map's keys would be encoded.
+type dataEnvelope struct {
+	DataType Type        `json:"@data-type"`
+	Data     interface{} `json:"data"`
+}
+
+// maxPooledBufferSize is the capacity above which an encodeState's buffer is not returned to the pool, so that
+// encoding an unusually large value doesn't pin its memory.
+const maxPooledBufferSize = 64 << 10
+
+// encodeState is a buffer and a JSON encoder (without escaping HTML entities) that writes to it.
+type encodeState struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+// encodeStatePool saves allocating a buffer and encoder for every MarshalJSON call, which adds up since one is
+// made for every (nested) value.
+var encodeStatePool = sync.Pool{
+	New: func() interface{} {
+		s := &encodeState{}
+		s.enc = json.NewEncoder(&s.buf)
+		s.enc.SetEscapeHTML(false)
+		return s
+	},
 }
 
-// String implements the Stringer interface for encoding.Data and produces a compact string representation.
-func (d *Data) String() string {
-	return fmt.Sprintf("\"%v\": %s", d.DataValue, d.DataType.String())
+// marshalPooled encodes v (without escaping HTML entities) using a pooled encodeState. The result is copied out of
+// the pooled buffer, so remains valid after the encodeState is reused.
+func marshalPooled(v interface{}) ([]byte, error) {
+	s, _ := encodeStatePool.Get().(*encodeState)
+
+	if err := s.enc.Encode(v); err != nil {
+		// the encoder may have written part of the value, so don't reuse it
+		return nil, err
+	}
+
+	b := append([]byte(nil), s.buf.Bytes()...)
+
+	if s.buf.Cap() <= maxPooledBufferSize {
+		s.buf.Reset()
+		encodeStatePool.Put(s)
+	}
+
+	return b, nil
 }
@@ -33,10 +33,10 @@ const (
 	// Zeek enum value mapped to native JSON string (maps to string)
 	TypeEnumValue Type = "enum-value"
 	// TypeAddress is a Type of type Address.
-	// String-encoded IPv4/IPv6 address (maps to net.Addr)
+	// String-encoded IPv4/IPv6 address (maps to netip.Addr)
 	TypeAddress Type = "address"
 	// TypeSubnet is a Type of type Subnet.
-	// String-encoded IPv4/IPv6 subnet in <address>/<prefix-length> format (maps to net.IPNet)
+	// String-encoded IPv4/IPv6 subnet in <address>/<prefix-length> format (maps to netip.Prefix, host bits preserved)
 	TypeSubnet Type = "subnet"
 	// TypePort is a Type of type Port.
 	// String-encoded service port in <port>/<protocol> format (maps to encoding.Service)
@@ -4,31 +4,25 @@ package encoding
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net"
+	"net/netip"
 	"reflect"
 	"testing"
 	"time"
+	_ "time/tzdata" // for TestData_MarshalJSON_timestampZone on systems without a zoneinfo database
 )
 
 //nolint:gocognit // non-complex repetition of subtests
 func TestData_UnmarshalJSON(t *testing.T) {
 	var dur time.Duration
-	ipv6 := net.ParseIP("2001:db8::")
-	if ipv6 == nil {
-		t.Fatal("test data is invalid")
-	}
-	ipv4 := net.ParseIP("196.25.1.1")
-	if ipv4 == nil {
-		t.Fatal("test data is invalid")
-	}
-	_, ipv6Subnet, err := net.ParseCIDR("2001:db8::/127")
-	if err != nil {
-		t.Fatal(err)
-	}
-	_, ipv4Subnet, err := net.ParseCIDR("196.25.0.0/16")
-	if err != nil {
-		t.Fatal(err)
-	}
+	ipv6 := netip.MustParseAddr("2001:db8::")
+	ipv4 := netip.MustParseAddr("196.25.1.1")
+	ipv6Subnet := netip.MustParsePrefix("2001:db8::/127")
+	ipv4Subnet := netip.MustParsePrefix("196.25.0.0/16")
 	timeString := "2006-01-02T15:04:05.999"
 	ts, err := time.Parse("2006-01-02T15:04:05.999", timeString)
 	if err != nil {
@@ -181,28 +175,28 @@ func TestData_UnmarshalJSON(t *testing.T) {
 		}
 		`)},
 		{name: "address IPv6 valid", want: Data{DataType: TypeAddress, DataValue: ipv6},
-			wantType: reflect.TypeOf(ipv6).Kind(), wantErr: false, arg: []byte(`
+			wantType: reflect.Struct, wantErr: false, arg: []byte(`
 		{
 		  "@data-type": "address",
 		  "data": "2001:db8::"
 		}
 		`)},
 		{name: "address IPv4 valid", want: Data{DataType: TypeAddress, DataValue: ipv4},
-			wantType: reflect.TypeOf(ipv4).Kind(), wantErr: false, arg: []byte(`
+			wantType: reflect.Struct, wantErr: false, arg: []byte(`
 		{
 		  "@data-type": "address",
 		  "data": "196.25.1.1"
 		}
 		`)},
 		{name: "subnet IPv6 valid", want: Data{DataType: TypeSubnet, DataValue: ipv6Subnet},
-			wantType: reflect.TypeOf(ipv6Subnet).Kind(), wantErr: false, arg: []byte(`
+			wantType: reflect.Struct, wantErr: false, arg: []byte(`
 		{
 		  "@data-type": "subnet",
 		  "data": "2001:db8::/127"
 		}
 		`)},
 		{name: "subnet IPv4 valid", want: Data{DataType: TypeSubnet, DataValue: ipv4Subnet},
-			wantType: reflect.TypeOf(ipv4Subnet).Kind(), wantErr: false, arg: []byte(`
+			wantType: reflect.Struct, wantErr: false, arg: []byte(`
 		{
 		  "@data-type": "subnet",
 		  "data": "196.25.0.0/16"
@@ -385,6 +379,8 @@ func Test_formatTimespan(t *testing.T) {
 		{name: "minutes", args: args{duration: time.Nanosecond * 90000000000}, want: "1.5min"},
 		{name: "hours", args: args{duration: time.Nanosecond * 5400000000000}, want: "1.5h"},
 		{name: "days", args: args{duration: time.Nanosecond * 129600000000000}, want: "1.5d"},
+		{name: "negative", args: args{duration: -time.Nanosecond * 90000000000}, want: "-1.5min"},
+		{name: "full precision", args: args{duration: time.Nanosecond * 100000001}, want: "100.000001ms"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -395,6 +391,286 @@ func Test_formatTimespan(t *testing.T) {
 	}
 }
 
+func Test_parseTimespan(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{arg: "10ns", want: 10 * time.Nanosecond},
+		{arg: "1nsec", want: time.Nanosecond},
+		{arg: "10nsecs", want: 10 * time.Nanosecond},
+		{arg: "1.5us", want: 1500 * time.Nanosecond},
+		{arg: "1.5µs", want: 1500 * time.Nanosecond},
+		{arg: "1usec", want: time.Microsecond},
+		{arg: "250usecs", want: 250 * time.Microsecond},
+		{arg: "1.5ms", want: 1500 * time.Microsecond},
+		{arg: "1msec", want: time.Millisecond},
+		{arg: "20msecs", want: 20 * time.Millisecond},
+		{arg: "1.5s", want: 1500 * time.Millisecond},
+		{arg: "1sec", want: time.Second},
+		{arg: "30secs", want: 30 * time.Second},
+		{arg: "2m", want: 2 * time.Minute},
+		{arg: "1min", want: time.Minute},
+		{arg: "1.5min", want: 90 * time.Second},
+		{arg: "10min", want: 10 * time.Minute},
+		{arg: "5mins", want: 5 * time.Minute},
+		{arg: "1.5h", want: 90 * time.Minute},
+		{arg: "1hr", want: time.Hour},
+		{arg: "12hrs", want: 12 * time.Hour},
+		{arg: "1d", want: 24 * time.Hour},
+		{arg: "1day", want: 24 * time.Hour},
+		{arg: "1.5days", want: 36 * time.Hour},
+		{arg: "-1.5min", want: -90 * time.Second},
+		{arg: "1h30m", want: 90 * time.Minute},
+		{arg: "1", wantErr: true},
+		{arg: "min", wantErr: true},
+		{arg: "1fortnight", wantErr: true},
+		{arg: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := parseTimespan(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTimespan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseTimespan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_timespanRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want time.Duration
+	}{
+		{name: "fractional day", arg: "1.234567d", want: 106666588800000},
+		{name: "day plus a nanosecond", arg: "1.00000000000001d", want: 24*time.Hour + time.Nanosecond},
+		{name: "hour plus a nanosecond", arg: "1.0000000000003h", want: time.Hour + time.Nanosecond},
+		{name: "minute plus a nanosecond", arg: "1.00000000002min", want: time.Minute + time.Nanosecond},
+		{name: "negative fractional day", arg: "-2.5000000000001d", want: -(60*time.Hour + 9)},
+		{name: "large", arg: "106751.99116730064591d", want: 1<<63 - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimespan(tt.arg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("parseTimespan(%q) = %d, want %d", tt.arg, got, tt.want)
+			}
+
+			encoded := formatTimespan(got)
+			again, err := parseTimespan(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != got {
+				t.Errorf("%d re-encoded as %q which decodes to %d", got, encoded, again)
+			}
+		})
+	}
+}
+
+func TestData_UnmarshalJSON_negativeTimespan(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want time.Duration
+	}{
+		{arg: "-1.5d", want: -36 * time.Hour},
+		{arg: "-250ms", want: -250 * time.Millisecond},
+		{arg: "-1min", want: -time.Minute},
+		{arg: "-1.5min", want: -90 * time.Second},
+		{arg: "-2hrs", want: -2 * time.Hour},
+		{arg: "-10ns", want: -10 * time.Nanosecond},
+		{arg: "-1h30m", want: -90 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			var d Data
+			if err := d.UnmarshalJSON([]byte(`{"@data-type":"timespan","data":"` + tt.arg + `"}`)); err != nil {
+				t.Fatal(err)
+			}
+			if d.DataValue != tt.want {
+				t.Fatalf("decoded %q as %v, want %v", tt.arg, d.DataValue, tt.want)
+			}
+
+			buf, err := d.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var again Data
+			if err = again.UnmarshalJSON(buf); err != nil {
+				t.Fatal(err)
+			}
+			if again != d {
+				t.Errorf("%q re-encoded as %s which decodes to %v", tt.arg, buf, again.DataValue)
+			}
+		})
+	}
+}
+
+func Test_parseTimespan_outOfRange(t *testing.T) {
+	if _, err := parseTimespan("200000d"); err == nil {
+		t.Error("expected an error for a timespan that overflows time.Duration")
+	}
+}
+
+func TestData_timestampPrecision(t *testing.T) {
+	tests := []struct {
+		name string
+		ts   time.Time
+		want string
+	}{
+		{name: "seconds", ts: time.Date(2023, time.May, 2, 4, 31, 49, 0, time.UTC),
+			want: "2023-05-02T04:31:49.000"},
+		{name: "milliseconds", ts: time.Date(2023, time.May, 2, 4, 31, 49, 123000000, time.UTC),
+			want: "2023-05-02T04:31:49.123"},
+		{name: "microseconds", ts: time.Date(2023, time.May, 2, 4, 31, 49, 123456000, time.UTC),
+			want: "2023-05-02T04:31:49.123456"},
+		{name: "nanoseconds", ts: time.Date(2023, time.May, 2, 4, 31, 49, 123456789, time.UTC),
+			want: "2023-05-02T04:31:49.123456789"},
+		{name: "nanoseconds with trailing zero", ts: time.Date(2023, time.May, 2, 4, 31, 49, 1000010, time.UTC),
+			want: "2023-05-02T04:31:49.001000010"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := Timestamp(tt.ts).MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := `{"@data-type":"timestamp","data":"` + tt.want + `"}`
+			if string(buf) != want {
+				t.Errorf("expected %s got %s", want, buf)
+			}
+
+			var d Data
+			if err = d.UnmarshalJSON(buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, _ := d.DataValue.(time.Time); !got.Equal(tt.ts) {
+				t.Errorf("decoded %v, want %v", d.DataValue, tt.ts)
+			}
+		})
+	}
+}
+
+func TestData_MarshalJSON_timestampZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Date(2023, time.May, 2, 0, 31, 49, 123000000, loc) // EDT, UTC-4
+
+	buf, err := Timestamp(ts).MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"@data-type":"timestamp","data":"2023-05-02T04:31:49.123"}`
+	if string(buf) != want {
+		t.Errorf("expected %s got %s", want, buf)
+	}
+
+	var d Data
+	if err = d.UnmarshalJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := d.DataValue.(time.Time)
+	if !got.Equal(ts) || got.Location() != time.UTC {
+		t.Errorf("decoded %v, want %v in UTC", got, ts)
+	}
+}
+
+func TestData_UnmarshalJSON_timestampFraction(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want int
+	}{
+		{arg: "2023-05-02T04:31:49", want: 0},
+		{arg: "2023-05-02T04:31:49.5", want: 500000000},
+		{arg: "2023-05-02T04:31:49.12", want: 120000000},
+		{arg: "2023-05-02T04:31:49.123", want: 123000000},
+		{arg: "2023-05-02T04:31:49.1234", want: 123400000},
+		{arg: "2023-05-02T04:31:49.123456789", want: 123456789},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			var d Data
+			if err := d.UnmarshalJSON([]byte(`{"@data-type":"timestamp","data":"` + tt.arg + `"}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			ts, _ := d.DataValue.(time.Time)
+			if ts.Nanosecond() != tt.want {
+				t.Errorf("decoded %d nanoseconds, want %d", ts.Nanosecond(), tt.want)
+			}
+		})
+	}
+}
+
+func TestData_UnmarshalJSON_timestampInvalid(t *testing.T) {
+	for _, arg := range []string{"2023-05-02T04:31", "2023-05-02T04:31:49.", "2023-05-02T04:31:49.12x", "2023-05-02"} {
+		t.Run(arg, func(t *testing.T) {
+			var d Data
+			if err := d.UnmarshalJSON([]byte(`{"@data-type":"timestamp","data":"` + arg + `"}`)); err == nil {
+				t.Errorf("expected an error but decoded %v", d.DataValue)
+			}
+		})
+	}
+}
+
+func TestData_MarshalJSON_nonFiniteReal(t *testing.T) {
+	for _, f := range []float64{math.Inf(1), math.Inf(-1), math.NaN()} {
+		t.Run(fmt.Sprint(f), func(t *testing.T) {
+			if _, err := Real(f).MarshalJSON(); !errors.Is(err, ErrNonFiniteReal) {
+				t.Errorf("expected ErrNonFiniteReal but got %v", err)
+			}
+
+			if _, err := json.Marshal(Vector(Count(1), Real(f))); !errors.Is(err, ErrNonFiniteReal) {
+				t.Errorf("expected ErrNonFiniteReal for a nested value but got %v", err)
+			}
+		})
+	}
+}
+
+func TestData_UnmarshalJSON_nonFiniteReal(t *testing.T) {
+	tests := []struct {
+		name          string
+		arg           string
+		wantNonFinite bool
+	}{
+		{name: "overflow", arg: `1e400`, wantNonFinite: true},
+		{name: "negative overflow", arg: `-1e400`, wantNonFinite: true},
+		{name: "string inf", arg: `"inf"`},
+		{name: "string nan", arg: `"nan"`},
+		{name: "bare inf", arg: `inf`},
+		{name: "bare NaN", arg: `NaN`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Data
+			err := d.UnmarshalJSON([]byte(`{"@data-type":"real","data":` + tt.arg + `}`))
+			if err == nil {
+				t.Fatalf("expected an error but decoded %v", d.DataValue)
+			}
+
+			if errors.Is(err, ErrNonFiniteReal) != tt.wantNonFinite {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
 func Test_encodeHTMLEntity(t *testing.T) {
 	stringWithHTMLEntity := Data{
 		DataType:  TypeString,
@@ -432,3 +708,149 @@ func Test_None(t *testing.T) {
 		t.Errorf("expected %s got %s", want, buf)
 	}
 }
+
+func TestData_UnmarshalJSON_addressSet(t *testing.T) {
+	raw := []byte(`
+	{
+	  "@data-type": "set",
+	  "data": [
+		{
+		  "@data-type": "address",
+		  "data": "1.2.3.4"
+		},
+		{
+		  "@data-type": "address",
+		  "data": "2001:db8::1"
+		},
+		{
+		  "@data-type": "subnet",
+		  "data": "10.0.0.0/8"
+		}
+	  ]
+	}`)
+
+	want := Set(map[Data]struct{}{
+		Address(net.ParseIP("1.2.3.4")):                  {},
+		Address(net.ParseIP("2001:db8::1")):              {},
+		NetIPSubnet(netip.MustParsePrefix("10.0.0.0/8")): {},
+	})
+
+	var d Data
+	if err := d.UnmarshalJSON(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	set, ok := d.DataValue.(map[Data]struct{})
+	if !ok {
+		t.Fatalf("expected a map[Data]struct{} but got %T", d.DataValue)
+	}
+
+	wantElems, ok := want.DataValue.([]Data)
+	if !ok {
+		t.Fatalf("expected a []Data but got %T", want.DataValue)
+	}
+
+	if len(set) != len(wantElems) {
+		t.Fatalf("expected %d elements but got %d", len(wantElems), len(set))
+	}
+
+	for _, elem := range wantElems {
+		if _, ok := set[elem]; !ok {
+			t.Errorf("set is missing element %#v", elem)
+		}
+	}
+}
+
+func TestData_MarshalJSON_roundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  []byte
+	}{
+		{name: "set", arg: []byte(`
+		{
+		  "@data-type": "set",
+		  "data": [
+			{
+			  "@data-type": "port",
+			  "data": "21/tcp"
+			},
+			{
+			  "@data-type": "port",
+			  "data": "443/tcp"
+			}
+		  ]
+		}`)},
+		{name: "table", arg: []byte(`
+		{
+		  "@data-type": "table",
+		  "data": [
+			{
+			  "key": {
+				"@data-type": "count",
+				"data": 5
+			  },
+			  "value": {
+				"@data-type": "string",
+				"data": "five"
+			  }
+			},
+			{
+			  "key": {
+				"@data-type": "count",
+				"data": 11
+			  },
+			  "value": {
+				"@data-type": "set",
+				"data": [
+				  {
+					"@data-type": "address",
+					"data": "1.2.3.4"
+				  }
+				]
+			  }
+			}
+		  ]
+		}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded Data
+			if err := decoded.UnmarshalJSON(tt.arg); err != nil {
+				t.Fatal(err)
+			}
+
+			buf, err := decoded.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var redecoded Data
+			if err = redecoded.UnmarshalJSON(buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(decoded, redecoded) {
+				t.Errorf("output value incorrect, wanted: \n\t%#v\ngot: \n\t%#v", decoded, redecoded)
+			}
+		})
+	}
+}
+
+func TestData_MarshalJSON_pooledBuffersNotShared(t *testing.T) {
+	first, err := String("first").MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := string(first)
+
+	for i := 0; i < 10; i++ {
+		if _, err = Vector(String("second"), Count(uint64(i))).MarshalJSON(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if string(first) != want {
+		t.Errorf("earlier result was overwritten: got %s, want %s", first, want)
+	}
+}
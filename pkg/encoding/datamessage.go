@@ -4,7 +4,6 @@ package encoding
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 )
 
@@ -15,6 +14,15 @@ type DataMessage struct {
 	Data      *Data
 }
 
+// NewDataMessage creates a data message carrying d to topic, for publishing values other than events.
+func NewDataMessage(topic string, d Data) DataMessage {
+	return DataMessage{
+		ConstType: "data-message",
+		Topic:     topic,
+		Data:      &d,
+	}
+}
+
 // DataMessageUnknownTypeError is raised when we receive a DataMessage that is neither an event or an error from broker.
 type DataMessageUnknownTypeError struct {
 	TypeValue string
@@ -25,31 +33,91 @@ func (e DataMessageUnknownTypeError) Error() string {
 	return fmt.Sprintf("the DataMessage's \"type\" property is an unknown value of \"%s\"", e.TypeValue)
 }
 
-// MarshalJSON implements the Marshaler interface for DataMessage.
+// MarshalJSON implements the Marshaler interface for DataMessage. The message's data is encoded as by
+// Data.MarshalJSON, with the "topic" and "type" properties added to its object.
 func (d DataMessage) MarshalJSON() ([]byte, error) {
-	buf := &bytes.Buffer{}
-	enc := json.NewEncoder(buf)
-	enc.SetEscapeHTML(false)
-
-	if err := enc.Encode(map[string]interface{}{
-		"type":       d.ConstType,
-		"topic":      d.Topic,
-		"@data-type": d.Data.DataType,
-		"data":       d.Data.DataValue,
-	}); err != nil {
+	header, err := marshalPooled(messageHeader{Topic: d.Topic, Type: d.ConstType})
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Data == nil {
+		return header, nil
+	}
+
+	data, err := d.Data.MarshalJSON()
+	if err != nil {
 		return nil, err
 	}
 
-	return buf.Bytes(), nil
+	return spliceMessageHeader(bytes.TrimRight(data, "\n"), header), nil
+}
+
+// MarshalDataMessages encodes a data message carrying d to each of topics, as DataMessage.MarshalJSON would, but
+// only encodes d once, e.g. to publish the same (large) event to several topics.
+func MarshalDataMessages(d Data, topics []string) ([][]byte, error) {
+	data, err := d.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimRight(data, "\n")
+
+	msgs := make([][]byte, len(topics))
+	for i, topic := range topics {
+		header, err := marshalPooled(messageHeader{Topic: topic, Type: "data-message"})
+		if err != nil {
+			return nil, err
+		}
+		msgs[i] = spliceMessageHeader(data, header)
+	}
+
+	return msgs, nil
+}
+
+// spliceMessageHeader splices the header's properties (after its opening brace) in place of the data object's closing
+// brace, returning a new slice.
+func spliceMessageHeader(data, header []byte) []byte {
+	b := make([]byte, 0, len(data)+len(header))
+	b = append(b, data[:len(data)-1]...)
+	b = append(b, ',')
+	return append(b, header[1:]...)
+}
+
+// messageHeader is the JSON object for the properties of a DataMessage other than its data, which sort after them.
+type messageHeader struct {
+	Topic string `json:"topic"`
+	Type  string `json:"type"`
 }
 
 // UnmarshalJSON implements the Unmarshaler interface for DataMessage
 func (d *DataMessage) UnmarshalJSON(b []byte) error {
-	var rawData map[string]interface{}
-	if err := json.Unmarshal(b, &rawData); err != nil {
+	return d.UnmarshalJSONWithOptions(b, DecoderOptions{})
+}
+
+// UnmarshalJSONWithOptions is like UnmarshalJSON, but with limits on decoding the data given by opts.
+func (d *DataMessage) UnmarshalJSONWithOptions(b []byte, opts DecoderOptions) error {
+	if err := opts.checkSize(len(b)); err != nil {
 		return err
 	}
 
+	// The message is parsed once, as a stream of tokens: the "type", "topic" (and for an error, "code" and
+	// "context") properties are collected as the data is decoded, then checked by decodeHeader.
+	dec := NewDecoder(bytes.NewReader(b))
+	dec.SetOptions(opts)
+
+	msg, err := dec.DecodeMessage()
+	if err != nil {
+		return err
+	}
+
+	*d = msg
+	return nil
+}
+
+// decodeHeader unpacks the properties of a message other than its data, given the other properties of the JSON
+// object deserialised to a map.
+// An ErrorMessage is returned if the message is an error from broker.
+func (d *DataMessage) decodeHeader(rawData map[string]interface{}) error {
 	t, ok := rawData["type"]
 	if !ok {
 		return fmt.Errorf("DataMessage is missing the \"type\" property")
@@ -106,14 +174,35 @@ func (d *DataMessage) UnmarshalJSON(b []byte) error {
 
 	d.Topic = ts
 
-	return json.Unmarshal(b, &d.Data)
+	return nil
 }
 
 const eventToplevelVectorLen = 3
 const eventSignatureVectorLen = 2
 
+// IsEvent reports whether the message carries a zeek event, as opposed to other data published to the topic, by
+// checking for the event's format and message type numbers. GetEvent can still fail for a malformed event.
+func (d *DataMessage) IsEvent() bool {
+	if d.Data == nil || d.Data.DataType != TypeVector {
+		return false
+	}
+
+	vec, ok := d.Data.DataValue.([]Data)
+	if !ok || len(vec) != eventToplevelVectorLen {
+		return false
+	}
+
+	formatNumber, _ := vec[0].DataValue.(uint64)
+	zeekMessageType, _ := vec[1].DataValue.(uint64)
+	return vec[0].DataType == TypeCount && formatNumber == 1 && vec[1].DataType == TypeCount && zeekMessageType == 1
+}
+
 // GetEvent obtains the topic, and Event from a zeek broker event encoded in a DataMessage.
 func (d *DataMessage) GetEvent() (topic string, evt Event, err error) {
+	if d.Data == nil {
+		return "", Event{}, fmt.Errorf("message has no data")
+	}
+
 	if d.Data.DataType != TypeVector {
 		return "", Event{},
 			fmt.Errorf("expected data type for event to be a vector but got a %s instead",
@@ -5,7 +5,11 @@ package encoding
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDataMessage_UnmarshalJSON(t *testing.T) {
@@ -80,3 +84,164 @@ func Test_DataMessage_encodeHTMLEntity(t *testing.T) {
 		t.Errorf("expected %s got %s", want, buf)
 	}
 }
+
+func TestDataMessage_MarshalJSON_data(t *testing.T) {
+	for _, d := range []Data{
+		Count(42),
+		Timestamp(time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)),
+		PortOf(443, ProtocolTCP),
+		Timespan(1500 * time.Millisecond),
+		// as decoded, i.e. map-backed
+		{DataType: TypeSet, DataValue: map[Data]struct{}{String("a"): {}, String("b"): {}}},
+		{DataType: TypeTable, DataValue: map[Data]Data{String("a"): Count(1)}},
+		None(),
+	} {
+		d := d
+		t.Run(d.DataType.String(), func(t *testing.T) {
+			b, err := DataMessage{ConstType: "data-message", Topic: "/topic/test", Data: &d}.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got DataMessage
+			if err = json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("unmarshalling %s: %v", b, err)
+			}
+
+			if got.Topic != "/topic/test" || got.Data == nil || !got.Data.Equal(d) {
+				t.Errorf("round-tripped %s to %+v, want %s", b, got, d)
+			}
+		})
+	}
+}
+
+func TestMarshalDataMessages(t *testing.T) {
+	d := *NewEvent("test_event", String("big"), Count(1)).Encode("").Data
+	topics := []string{"/topic/a", "/topic/b"}
+
+	msgs, err := MarshalDataMessages(d, topics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != len(topics) {
+		t.Fatalf("got %d messages, want %d", len(msgs), len(topics))
+	}
+
+	for i, topic := range topics {
+		want, err := NewDataMessage(topic, d).MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(msgs[i], want) {
+			t.Errorf("message %d = %s, want %s", i, msgs[i], want)
+		}
+	}
+}
+
+func TestDataMessage_IsEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  DataMessage
+		want bool
+	}{
+		{name: "event", msg: NewEvent("test_event", Count(1)).Encode("/topic/test"), want: true},
+		{name: "count", msg: NewDataMessage("/topic/test", Count(1)), want: false},
+		{name: "vector", msg: NewDataMessage("/topic/test", Vector(Count(1), Count(2), Vector())), want: false},
+		{name: "no data", msg: DataMessage{ConstType: "data-message", Topic: "/topic/test"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.msg.IsEvent(); got != tt.want {
+				t.Errorf("IsEvent() = %v, want %v", got, tt.want)
+			}
+
+			if _, _, err := tt.msg.GetEvent(); (err == nil) != tt.want {
+				t.Errorf("GetEvent() error = %v", err)
+			}
+		})
+	}
+}
+
+func BenchmarkDataMessage_UnmarshalJSON(b *testing.B) {
+	buf := []byte(`{"type":"data-message","topic":"/topic/test",` + strings.TrimPrefix(benchmarkEventJSON, "{"))
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(buf)))
+	for n := 0; n < b.N; n++ {
+		var msg DataMessage
+		if err := msg.UnmarshalJSON(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDataMessage_UnmarshalJSON_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr error
+	}{
+		{
+			name: "broker error",
+			json: `{"type":"error","code":"deserialization_failed","context":"input #1 contained malformed JSON"}`,
+			wantErr: ErrorMessage{
+				ConstType: "error",
+				Code:      "deserialization_failed",
+				Context:   "input #1 contained malformed JSON",
+			},
+		},
+		{
+			name:    "unknown type",
+			json:    `{"type":"ack","topic":"/topic/test","@data-type":"count","data":1}`,
+			wantErr: DataMessageUnknownTypeError{TypeValue: "ack"},
+		},
+		{
+			name:    "error missing context",
+			json:    `{"type":"error","code":"deserialization_failed"}`,
+			wantErr: fmt.Errorf("ErrorMessage is missing the \"context\" property"),
+		},
+		{
+			name:    "missing topic",
+			json:    `{"type":"data-message","@data-type":"count","data":1}`,
+			wantErr: fmt.Errorf("DataMessage is missing the \"topic\" property"),
+		},
+		{
+			name:    "missing data",
+			json:    `{"type":"data-message","topic":"/topic/test"}`,
+			wantErr: fmt.Errorf("JSON object is missing the \"@data-type\" property - not a valid data object"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg DataMessage
+			err := msg.UnmarshalJSON([]byte(tt.json))
+			if err == nil || err.Error() != tt.wantErr.Error() {
+				t.Fatalf("expected error %v but got %v", tt.wantErr, err)
+			}
+
+			if want, ok := tt.wantErr.(ErrorMessage); ok {
+				var got ErrorMessage
+				if !errors.As(err, &got) || got != want {
+					t.Errorf("expected ErrorMessage %#v but got %#v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDataMessage_MarshalJSON(b *testing.B) {
+	var d Data
+	if err := d.UnmarshalJSON([]byte(benchmarkEventJSON)); err != nil {
+		b.Fatal(err)
+	}
+	msg := DataMessage{ConstType: "data-message", Topic: "/topic/test", Data: &d}
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := msg.MarshalJSON(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// DefaultMaxDepth is the maximum nesting depth used when DecoderOptions.MaxDepth is zero. It is far deeper
+	// than any type zeek can express in practice.
+	DefaultMaxDepth = 128
+
+	// DefaultMaxElements is the maximum number of elements used when DecoderOptions.MaxElements is zero.
+	DefaultMaxElements = 1 << 20
+
+	// DefaultMaxBytes is the maximum encoded size used when DecoderOptions.MaxBytes is zero.
+	DefaultMaxBytes = 64 << 20
+)
+
+var (
+	// ErrMaxDepthExceeded is returned when decoding a value whose containers are nested more deeply than allowed.
+	ErrMaxDepthExceeded = errors.New("maximum nesting depth exceeded")
+
+	// ErrMaxElementsExceeded is returned when decoding a value whose containers have more elements than allowed.
+	ErrMaxElementsExceeded = errors.New("maximum number of elements exceeded")
+
+	// ErrMaxBytesExceeded is returned when decoding a value whose encoding is larger than allowed.
+	ErrMaxBytesExceeded = errors.New("maximum encoded size exceeded")
+)
+
+// DecoderOptions sets limits on decoding, to protect against untrusted peers sending pathological messages.
+// The zero value applies the defaults.
+type DecoderOptions struct {
+	// MaxDepth is the maximum nesting depth of containers (vectors, sets and tables), where a top-level vector
+	// has a depth of 1. Zero means DefaultMaxDepth, and a negative value disables the limit.
+	MaxDepth int
+
+	// MaxElements is the maximum total number of elements of all containers (vectors, sets and tables) in a value,
+	// which is checked before the elements of each container are allocated. Zero means DefaultMaxElements, and a
+	// negative value disables the limit.
+	MaxElements int
+
+	// MaxBytes is the maximum size of the JSON encoding of a value (or for a DataMessage, of the message). Zero
+	// means DefaultMaxBytes, and a negative value disables the limit.
+	MaxBytes int
+}
+
+// limit returns v, or def if v is zero.
+func limit(v, def int) int {
+	if v == 0 {
+		return def
+	}
+
+	return v
+}
+
+// checkSize returns an error if an encoding of n bytes exceeds MaxBytes.
+func (opts DecoderOptions) checkSize(n int) error {
+	if maxBytes := limit(opts.MaxBytes, DefaultMaxBytes); maxBytes > 0 && n > maxBytes {
+		return fmt.Errorf("%w (%d > %d bytes)", ErrMaxBytesExceeded, n, maxBytes)
+	}
+
+	return nil
+}
+
+// decodeState tracks the limits of DecoderOptions during a (recursive) decode.
+type decodeState struct {
+	maxDepth    int
+	depth       int
+	maxElements int
+	elements    int
+}
+
+func newDecodeState(opts DecoderOptions) *decodeState {
+	return &decodeState{
+		maxDepth:    limit(opts.MaxDepth, DefaultMaxDepth),
+		maxElements: limit(opts.MaxElements, DefaultMaxElements),
+	}
+}
+
+// addElements is called with the number of elements of a container before they are allocated.
+func (st *decodeState) addElements(n int) error {
+	st.elements += n
+	if st.maxElements > 0 && st.elements > st.maxElements {
+		return fmt.Errorf("%w (%d)", ErrMaxElementsExceeded, st.maxElements)
+	}
+
+	return nil
+}
+
+// enter is called when decoding descends into a container.
+func (st *decodeState) enter() error {
+	st.depth++
+	if st.maxDepth > 0 && st.depth > st.maxDepth {
+		st.depth--
+		return fmt.Errorf("%w (%d)", ErrMaxDepthExceeded, st.maxDepth)
+	}
+
+	return nil
+}
+
+// leave is called when decoding of a container completes.
+func (st *decodeState) leave() {
+	st.depth--
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// nestedVectorJSON returns the encoding of depth vectors, each containing the next, around a count.
+func nestedVectorJSON(depth int) string {
+	return strings.Repeat(`{"@data-type":"vector","data":[`, depth) +
+		`{"@data-type":"count","data":1}` +
+		strings.Repeat(`]}`, depth)
+}
+
+func TestData_UnmarshalJSONWithOptions_maxDepth(t *testing.T) {
+	tests := []struct {
+		name    string
+		depth   int
+		opts    DecoderOptions
+		wantErr bool
+	}{
+		{name: "default limit", depth: DefaultMaxDepth},
+		{name: "beyond default limit", depth: DefaultMaxDepth + 1, wantErr: true},
+		{name: "pathological", depth: 4000, wantErr: true},
+		{name: "at custom limit", depth: 3, opts: DecoderOptions{MaxDepth: 3}},
+		{name: "beyond custom limit", depth: 4, opts: DecoderOptions{MaxDepth: 3}, wantErr: true},
+		{name: "unlimited", depth: 1000, opts: DecoderOptions{MaxDepth: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Data
+			err := d.UnmarshalJSONWithOptions([]byte(nestedVectorJSON(tt.depth)), tt.opts)
+			if errors.Is(err, ErrMaxDepthExceeded) != tt.wantErr {
+				t.Fatalf("UnmarshalJSONWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestData_UnmarshalJSON_defaultMaxDepth(t *testing.T) {
+	var d Data
+	if err := d.UnmarshalJSON([]byte(nestedVectorJSON(DefaultMaxDepth + 1))); !errors.Is(err, ErrMaxDepthExceeded) {
+		t.Errorf("expected ErrMaxDepthExceeded but got %v", err)
+	}
+}
+
+func TestDecoder_SetOptions_maxDepth(t *testing.T) {
+	msg := `{"type":"data-message","topic":"/topic/test",` + strings.TrimPrefix(nestedVectorJSON(5), "{")
+
+	dec := NewDecoder(strings.NewReader(msg + msg))
+	if _, err := dec.DecodeMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	dec.SetOptions(DecoderOptions{MaxDepth: 4})
+	if _, err := dec.DecodeMessage(); !errors.Is(err, ErrMaxDepthExceeded) {
+		t.Errorf("expected ErrMaxDepthExceeded but got %v", err)
+	}
+}
+
+// countVectorJSON returns the encoding of a vector of n counts.
+func countVectorJSON(n int) string {
+	elems := make([]string, n)
+	for i := range elems {
+		elems[i] = `{"@data-type":"count","data":1}`
+	}
+
+	return `{"@data-type":"vector","data":[` + strings.Join(elems, ",") + `]}`
+}
+
+func TestData_UnmarshalJSONWithOptions_maxElements(t *testing.T) {
+	nested := `{"@data-type":"vector","data":[` + countVectorJSON(3) + `,` + countVectorJSON(3) + `]}`
+	set := `{"@data-type":"set","data":[{"@data-type":"count","data":1},{"@data-type":"count","data":2}]}`
+	table := `{"@data-type":"table","data":[{"key":{"@data-type":"count","data":1},"value":` + countVectorJSON(2) + `}]}`
+
+	tests := []struct {
+		name    string
+		json    string
+		opts    DecoderOptions
+		wantErr bool
+	}{
+		{name: "at limit", json: countVectorJSON(10), opts: DecoderOptions{MaxElements: 10}},
+		{name: "oversized vector", json: countVectorJSON(11), opts: DecoderOptions{MaxElements: 10}, wantErr: true},
+		{name: "nested total at limit", json: nested, opts: DecoderOptions{MaxElements: 8}},
+		{name: "nested total beyond limit", json: nested, opts: DecoderOptions{MaxElements: 7}, wantErr: true},
+		{name: "oversized set", json: set, opts: DecoderOptions{MaxElements: 1}, wantErr: true},
+		{name: "oversized table", json: table, opts: DecoderOptions{MaxElements: 2}, wantErr: true},
+		{name: "table at limit", json: table, opts: DecoderOptions{MaxElements: 3}},
+		{name: "unlimited", json: countVectorJSON(100), opts: DecoderOptions{MaxElements: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Data
+			err := d.UnmarshalJSONWithOptions([]byte(tt.json), tt.opts)
+			if errors.Is(err, ErrMaxElementsExceeded) != tt.wantErr {
+				t.Fatalf("UnmarshalJSONWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestData_UnmarshalJSONWithOptions_maxBytes(t *testing.T) {
+	b := []byte(countVectorJSON(10))
+
+	var d Data
+	if err := d.UnmarshalJSONWithOptions(b, DecoderOptions{MaxBytes: len(b)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.UnmarshalJSONWithOptions(b, DecoderOptions{MaxBytes: len(b) - 1}); !errors.Is(err, ErrMaxBytesExceeded) {
+		t.Errorf("expected ErrMaxBytesExceeded but got %v", err)
+	}
+
+	var msg DataMessage
+	raw := []byte(`{"type":"data-message","topic":"/topic/test",` + strings.TrimPrefix(string(b), "{"))
+	if err := msg.UnmarshalJSONWithOptions(raw, DecoderOptions{MaxBytes: len(b)}); !errors.Is(err, ErrMaxBytesExceeded) {
+		t.Errorf("expected ErrMaxBytesExceeded but got %v", err)
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestDecoder_SetOptions_dataBeforeType(t *testing.T) {
+	// a vector of n counts, with the "data" property first, so that its type isn't known as it is read
+	const n = 100000
+	vector := countVectorJSON(n)
+	dataFirst := `{"data":` + strings.TrimSuffix(strings.TrimPrefix(vector, `{"@data-type":"vector","data":`), "}") +
+		`,"@data-type":"vector"}`
+
+	tests := []struct {
+		name    string
+		opts    DecoderOptions
+		wantErr error
+	}{
+		{name: "MaxBytes", opts: DecoderOptions{MaxBytes: 1000}, wantErr: ErrMaxBytesExceeded},
+		{name: "MaxElements", opts: DecoderOptions{MaxElements: 10}, wantErr: ErrMaxElementsExceeded},
+		{name: "within limits", opts: DecoderOptions{MaxElements: n}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &countingReader{r: strings.NewReader(dataFirst)}
+			dec := NewDecoder(r)
+			dec.SetOptions(tt.opts)
+
+			d, err := dec.Decode()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v but got %v", tt.wantErr, err)
+			}
+
+			if err == nil {
+				if d.VectorLen() != n {
+					t.Errorf("decoded %d elements, want %d", d.VectorLen(), n)
+				}
+			} else if r.n >= len(dataFirst)/2 {
+				// the limit is enforced as the value is read, rather than once it has been buffered
+				t.Errorf("read %d of %d bytes before failing", r.n, len(dataFirst))
+			}
+		})
+	}
+}
@@ -0,0 +1,482 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Decoder reads a stream of JSON objects, e.g. DataMessages as captured from the broker websocket API to a file.
+// Objects are framed by the JSON syntax itself rather than by lines, so any whitespace (including CRLF line
+// endings and the newlines in pretty-printed, multi-line objects) may separate or appear within them.
+//
+// Vectors, sets and tables are decoded element by element as they are read, rather than by first buffering the
+// whole object and deserialising it to a map, so large values need far less memory than with Data.UnmarshalJSON.
+type Decoder struct {
+	dec   *json.Decoder
+	opts  DecoderOptions
+	st    *decodeState
+	start int64
+}
+
+// NewDecoder returns a Decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &Decoder{dec: dec}
+}
+
+// SetOptions sets the limits applied when decoding subsequent values. MaxBytes is checked as each value is read.
+func (d *Decoder) SetOptions(opts DecoderOptions) {
+	d.opts = opts
+}
+
+// Decode reads the next Data value (a JSON object with "@data-type" and "data" properties) from the stream. It
+// returns io.EOF when there are no more values. Any other properties of the object are ignored. After an error,
+// the position in the stream is undefined and decoding cannot continue.
+func (d *Decoder) Decode() (Data, error) {
+	if err := d.begin(); err != nil {
+		return Data{}, err
+	}
+
+	return d.decodeData()
+}
+
+// DecodeMessage reads the next DataMessage from the stream. It returns io.EOF when there are no more messages.
+// As with DataMessage.UnmarshalJSON, an error message from broker is returned as an ErrorMessage error, after
+// which decoding can continue with the next message. After any other error, the position in the stream is
+// undefined and decoding cannot continue.
+func (d *Decoder) DecodeMessage() (DataMessage, error) {
+	if err := d.begin(); err != nil {
+		return DataMessage{}, err
+	}
+
+	data, ok, fields, err := d.decodeObject()
+	if err != nil {
+		return DataMessage{}, err
+	}
+
+	var msg DataMessage
+	if err = msg.decodeHeader(fields); err != nil {
+		return DataMessage{}, err
+	}
+
+	if !ok {
+		return DataMessage{}, fmt.Errorf("JSON object is missing the \"@data-type\" property - not a valid data object")
+	}
+
+	msg.Data = &data
+	return msg, nil
+}
+
+// More reports whether there is another value in the stream.
+func (d *Decoder) More() bool {
+	return d.dec.More()
+}
+
+// begin resets the limits for decoding the next top-level value, returning io.EOF if there are no more values.
+func (d *Decoder) begin() error {
+	d.st = newDecodeState(d.opts)
+	d.start = d.dec.InputOffset()
+
+	if !d.dec.More() {
+		if _, err := d.dec.Token(); err != nil {
+			return err
+		}
+		return fmt.Errorf("unexpected closing JSON delimiter")
+	}
+
+	return nil
+}
+
+// decodeObject reads a JSON object from the stream, decoding its "@data-type" and "data" properties as a Data
+// value and returning the other properties deserialised to a map. ok is false if the object has neither property.
+//
+//nolint:gocognit // the properties may be in any order
+func (d *Decoder) decodeObject() (data Data, ok bool, fields map[string]interface{}, err error) {
+	tok, err := d.token()
+	if err != nil {
+		return Data{}, false, nil, err
+	}
+	if err = d.expectDelim(tok, '{', "JSON object"); err != nil {
+		return Data{}, false, nil, err
+	}
+
+	var (
+		hasType  bool
+		hasValue bool
+		pending  interface{}
+		deferred bool
+	)
+
+	for d.dec.More() {
+		key, err := d.key()
+		if err != nil {
+			return Data{}, false, nil, err
+		}
+
+		switch key {
+		case "@data-type":
+			if tok, err = d.token(); err != nil {
+				return Data{}, false, nil, err
+			}
+
+			ts, ok := tok.(string)
+			if !ok {
+				return Data{}, false, nil,
+					fmt.Errorf("the \"@data-type\" property is not a string - not a valid data object")
+			}
+
+			if data.DataType, err = ParseType(ts); err != nil {
+				return Data{}, false, nil, err
+			}
+			hasType = true
+		case "data":
+			hasValue = true
+			if !hasType {
+				// the type isn't known yet, so fall back to deserialising the value generically
+				if pending, err = d.decodeRaw(); err != nil {
+					return Data{}, false, nil, err
+				}
+				deferred = true
+				continue
+			}
+
+			if err = d.decodeValue(&data); err != nil {
+				return Data{}, false, nil, err
+			}
+		default:
+			v, err := d.decodeRaw()
+			if err != nil {
+				return Data{}, false, nil, err
+			}
+
+			if fields == nil {
+				fields = map[string]interface{}{}
+			}
+			fields[key] = v
+		}
+	}
+
+	if _, err = d.token(); err != nil { // the closing '}'
+		return Data{}, false, nil, err
+	}
+
+	switch {
+	case !hasType && !hasValue:
+		return Data{}, false, fields, nil
+	case !hasType:
+		return Data{}, false, nil,
+			fmt.Errorf("JSON object is missing the \"@data-type\" property - not a valid data object")
+	case !hasValue:
+		return Data{}, false, nil, fmt.Errorf("JSON object is missing the \"data\" property - not a valid data object")
+	case deferred:
+		if err = data.decodeValue(pending, d.st); err != nil {
+			return Data{}, false, nil, err
+		}
+	}
+
+	return data, true, fields, nil
+}
+
+// decodeData reads a JSON object from the stream that must be a Data value.
+func (d *Decoder) decodeData() (Data, error) {
+	data, ok, _, err := d.decodeObject()
+	if err != nil {
+		return Data{}, err
+	}
+
+	if !ok {
+		return Data{}, fmt.Errorf("JSON object is missing the \"@data-type\" property - not a valid data object")
+	}
+
+	return data, nil
+}
+
+// decodeValue reads the "data" property of a JSON object from the stream, given that data.DataType has been set
+// from its "@data-type" property.
+func (d *Decoder) decodeValue(data *Data) error {
+	switch data.DataType {
+	case TypeVector, TypeSet, TypeTable:
+	default:
+		// Scalars are read as a single token, which is cheaper than deserialising them generically.
+		tok, err := d.token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := tok.(json.Delim); ok {
+			return d.decodeDelimValue(data, delim)
+		}
+		return data.decodeValue(tok, d.st)
+	}
+
+	if err := d.st.enter(); err != nil {
+		return err
+	}
+	defer d.st.leave()
+
+	tok, err := d.token()
+	if err != nil {
+		return err
+	}
+	if err = d.expectDelim(tok, '[', data.DataType.String()+" type to be serialized as JSON array"); err != nil {
+		return err
+	}
+
+	switch data.DataType {
+	case TypeVector:
+		err = d.decodeVector(data)
+	case TypeSet:
+		err = d.decodeSet(data)
+	default:
+		err = d.decodeTable(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = d.token() // the closing ']'
+	return err
+}
+
+// decodeDelimValue handles the "data" property of a JSON object that isn't a container type but starts with
+// delim: this is only valid for a None, which is serialised as an empty JSON object.
+func (d *Decoder) decodeDelimValue(data *Data, delim json.Delim) error {
+	if data.DataType != TypeNone || delim != '{' {
+		return fmt.Errorf("expected %s type to be serialized as a JSON scalar but got a %v", data.DataType.String(), delim)
+	}
+
+	if d.dec.More() {
+		return fmt.Errorf("expected None type to be serialized as empty JSON object")
+	}
+
+	_, err := d.token() // the closing '}'
+	data.DataValue = nil
+	return err
+}
+
+func (d *Decoder) decodeVector(data *Data) error {
+	datas := []Data{}
+	for i := 0; d.dec.More(); i++ {
+		if err := d.st.addElements(1); err != nil {
+			return err
+		}
+
+		elem, err := d.decodeData()
+		if err != nil {
+			return fmt.Errorf("error decoding Vector element %d: %w", i, err)
+		}
+		datas = append(datas, elem)
+	}
+	data.DataValue = datas
+	return nil
+}
+
+func (d *Decoder) decodeSet(data *Data) error {
+	datas := map[Data]struct{}{}
+	for i := 0; d.dec.More(); i++ {
+		if err := d.st.addElements(1); err != nil {
+			return err
+		}
+
+		dElem, err := d.decodeData()
+		if err != nil {
+			return fmt.Errorf("error decoding Set element %d: %w", i, err)
+		}
+
+		if err = checkComparable(dElem); err != nil {
+			return fmt.Errorf("error decoding Set element %d: %w", i, err)
+		}
+
+		if _, ok := datas[dElem]; ok {
+			return fmt.Errorf("duplicate Set element %d: %#v", i, dElem)
+		}
+
+		datas[dElem] = struct{}{}
+	}
+	data.DataValue = datas
+	return nil
+}
+
+//nolint:gocognit // it just needs to be long due to the verbosity of error checking
+func (d *Decoder) decodeTable(data *Data) error {
+	datas := map[Data]Data{}
+	for i := 0; d.dec.More(); i++ {
+		if err := d.st.addElements(1); err != nil {
+			return err
+		}
+
+		tok, err := d.token()
+		if err != nil {
+			return err
+		}
+		if err = d.expectDelim(tok, '{', "Table type elements to be serialized as JSON objects"); err != nil {
+			return err
+		}
+
+		var dKey, dValue Data
+		var hasKey, hasValue bool
+		for d.dec.More() {
+			key, err := d.key()
+			if err != nil {
+				return err
+			}
+
+			switch key {
+			case "key":
+				if dKey, err = d.decodeData(); err != nil {
+					return fmt.Errorf("error decoding Table key element %d: %w", i, err)
+				}
+				hasKey = true
+			case "value":
+				if dValue, err = d.decodeData(); err != nil {
+					return fmt.Errorf("error decoding Table value element %d: %w", i, err)
+				}
+				hasValue = true
+			default:
+				return fmt.Errorf("expected Table type elements to have only \"key\" and \"value\" properties "+
+					"but got %q", key)
+			}
+		}
+
+		if _, err = d.token(); err != nil { // the closing '}'
+			return err
+		}
+
+		if !hasKey {
+			return fmt.Errorf("expected Table type elements to have a property named \"key\"")
+		}
+		if !hasValue {
+			return fmt.Errorf("expected Table type elements to have a property named \"value\"")
+		}
+
+		if err = checkComparable(dKey); err != nil {
+			return fmt.Errorf("error decoding Table key element %d: %w", i, err)
+		}
+
+		if _, ok := datas[dKey]; ok {
+			return fmt.Errorf("duplicate Table key %d: %#v", i, dKey)
+		}
+
+		datas[dKey] = dValue
+	}
+	data.DataValue = datas
+	return nil
+}
+
+// key reads the name of the next property of a JSON object from the stream.
+func (d *Decoder) key() (string, error) {
+	tok, err := d.token()
+	if err != nil {
+		return "", err
+	}
+
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a JSON object property name but got %v", tok)
+	}
+	return key, nil
+}
+
+// expectDelim checks that tok is the JSON delimiter delim, describing what was expected in the error otherwise.
+func (d *Decoder) expectDelim(tok json.Token, delim json.Delim, expected string) error {
+	if got, ok := tok.(json.Delim); !ok || got != delim {
+		return fmt.Errorf("expected %s but got type %T value %v", expected, tok, tok)
+	}
+	return nil
+}
+
+// token reads the next JSON token from the stream, enforcing the MaxBytes limit.
+func (d *Decoder) token() (json.Token, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return tok, d.checkSize()
+}
+
+// decodeRaw deserialises the next JSON value from the stream generically, as json.Unmarshal into an interface{}
+// would. It is read token by token, so that the limits are enforced as it is read, rather than once it has been
+// buffered: MaxBytes as for any other value, and MaxElements and MaxDepth loosely, since the value's Data types aren't
+// known (they are checked exactly once the value is decoded as Data). Each JSON array counts towards MaxElements as a
+// container, and arrays and objects count towards MaxDepth, allowing for the three JSON levels (the array, the
+// table entry object and the Data object) of each level of nested tables.
+func (d *Decoder) decodeRaw() (interface{}, error) {
+	st := newDecodeState(d.opts)
+	if st.maxDepth > 0 {
+		st.maxDepth *= 3
+	}
+
+	return d.decodeRawValue(st)
+}
+
+func (d *Decoder) decodeRawValue(st *decodeState) (interface{}, error) {
+	tok, err := d.token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+
+	if err = st.enter(); err != nil {
+		return nil, err
+	}
+	defer st.leave()
+
+	var v interface{}
+	switch delim {
+	case '[':
+		arr := []interface{}{}
+		for d.dec.More() {
+			if err = st.addElements(1); err != nil {
+				return nil, err
+			}
+
+			elem, err := d.decodeRawValue(st)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, elem)
+		}
+		v = arr
+	case '{':
+		obj := map[string]interface{}{}
+		for d.dec.More() {
+			key, err := d.key()
+			if err != nil {
+				return nil, err
+			}
+
+			if obj[key], err = d.decodeRawValue(st); err != nil {
+				return nil, err
+			}
+		}
+		v = obj
+	default:
+		return nil, fmt.Errorf("unexpected closing JSON delimiter")
+	}
+
+	if _, err = d.token(); err != nil { // the closing ']' or '}'
+		return nil, err
+	}
+	return v, nil
+}
+
+// checkSize checks the number of bytes read for the current top-level value against the MaxBytes limit.
+func (d *Decoder) checkSize() error {
+	return d.opts.checkSize(int(d.dec.InputOffset() - d.start))
+}
+
+// unexpectedEOF converts io.EOF part way through a value into io.ErrUnexpectedEOF, so that it isn't mistaken
+// for the end of the stream.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
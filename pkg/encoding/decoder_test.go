@@ -0,0 +1,229 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decoderFixture is three indented, multi-line messages (the second an error from broker) with CRLF line
+// endings, one of which shares a line with the end of the previous message.
+var decoderFixture = strings.ReplaceAll(`{
+  "type": "data-message",
+  "topic": "/topic/a",
+  "@data-type": "vector",
+  "data": [
+    {"@data-type": "count", "data": 1},
+    {"@data-type": "count", "data": 1},
+    {
+      "@data-type": "vector",
+      "data": [
+        {"@data-type": "string", "data": "ping"},
+        {"@data-type": "vector", "data": [{"@data-type": "string", "data": "line1\nline2"}]}
+      ]
+    }
+  ]
+}
+{
+  "type": "error",
+  "code": "deserialization_failed",
+  "context": "input #1 contained malformed JSON"
+} {
+  "type": "data-message",
+  "topic": "/topic/b",
+  "@data-type": "count",
+  "data": 42
+}
+
+`, "\n", "\r\n")
+
+func TestDecoder_DecodeMessage_multiLine(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(decoderFixture))
+
+	msg, err := dec.DecodeMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topic, evt, err := msg.GetEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if topic != "/topic/a" || evt.Name != "ping" || len(evt.Arguments) != 1 {
+		t.Fatalf("unexpected event %s on topic %s", evt, topic)
+	}
+
+	if got := evt.Arguments[0].DataValue; got != "line1\nline2" {
+		t.Errorf("unexpected argument %q", got)
+	}
+
+	_, err = dec.DecodeMessage()
+
+	var brokerErr ErrorMessage
+	if !errors.As(err, &brokerErr) || brokerErr.Code != "deserialization_failed" {
+		t.Fatalf("expected a broker error message but got %v", err)
+	}
+
+	if !dec.More() {
+		t.Fatal("expected another message")
+	}
+
+	msg, err = dec.DecodeMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Topic != "/topic/b" || *msg.Data != Count(42) {
+		t.Errorf("unexpected message %#v", msg)
+	}
+
+	if _, err = dec.DecodeMessage(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF but got %v", err)
+	}
+}
+
+func TestDecoder_Decode(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Data
+	}{
+		{name: "scalar", input: `{"@data-type": "count", "data": 42}`, want: Count(42)},
+		{name: "none", input: `{"@data-type": "none", "data": {}}`, want: None()},
+		{
+			name:  "empty vector",
+			input: `{"@data-type": "vector", "data": []}`,
+			want:  Data{DataType: TypeVector, DataValue: []Data{}},
+		},
+		{
+			name: "nested vector",
+			input: `{"@data-type": "vector", "data": [` +
+				`{"@data-type": "vector", "data": [{"data": "a", "@data-type": "string"}]}]}`,
+			want: Vector(Vector(String("a"))),
+		},
+		{
+			name:  "data before type",
+			input: `{"data": [{"@data-type": "integer", "data": -1}], "@data-type": "vector", "extra": true}`,
+			want:  Vector(Integer(-1)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDecoder(strings.NewReader(tt.input)).Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecoder_Decode_setAndTable(t *testing.T) {
+	input := `{"@data-type": "set", "data": [{"@data-type": "count", "data": 1}, {"@data-type": "count", "data": 2}]}
+{"@data-type": "table", "data": [
+	{"key": {"@data-type": "string", "data": "a"}, "value": {"@data-type": "count", "data": 1}},
+	{"value": {"@data-type": "count", "data": 2}, "key": {"@data-type": "string", "data": "b"}}
+]}`
+
+	dec := NewDecoder(strings.NewReader(input))
+
+	set, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[Data]struct{}{Count(1): {}, Count(2): {}}; !reflect.DeepEqual(set.DataValue, want) {
+		t.Errorf("unexpected set %v", set)
+	}
+
+	table, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[Data]Data{String("a"): Count(1), String("b"): Count(2)}; !reflect.DeepEqual(table.DataValue, want) {
+		t.Errorf("unexpected table %v", table)
+	}
+
+	if _, err = dec.Decode(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF but got %v", err)
+	}
+}
+
+func TestDecoder_Decode_largeVector(t *testing.T) {
+	const n = 100000
+
+	got, err := NewDecoder(strings.NewReader(countVectorJSON(n))).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vec, ok := got.DataValue.([]Data)
+	if !ok || len(vec) != n {
+		t.Fatalf("expected a vector of %d elements but got %T", n, got.DataValue)
+	}
+
+	if vec[n-1] != Count(1) {
+		t.Errorf("unexpected last element %v", vec[n-1])
+	}
+}
+
+func TestDecoder_Decode_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		opts    DecoderOptions
+		wantErr string
+	}{
+		{name: "not an object", input: `[]`, wantErr: "expected JSON object"},
+		{name: "missing type", input: `{"data": 1}`, wantErr: `missing the "@data-type" property`},
+		{name: "missing data", input: `{"@data-type": "count"}`, wantErr: `missing the "data" property`},
+		{name: "bad element", input: `{"@data-type": "vector", "data": [{"@data-type": "count", "data": "1"}]}`,
+			wantErr: "error decoding Vector element 0"},
+		{name: "non-empty none", input: `{"@data-type": "none", "data": {"a": 1}}`,
+			wantErr: "expected None type to be serialized as empty JSON object"},
+		{name: "scalar as array", input: `{"@data-type": "count", "data": [1]}`,
+			wantErr: "expected count type to be serialized as a JSON scalar"},
+		{name: "not an array", input: `{"@data-type": "set", "data": {}}`,
+			wantErr: "expected set type to be serialized as JSON array"},
+		{name: "duplicate set element", wantErr: "duplicate Set element 1",
+			input: `{"@data-type": "set", "data": [{"@data-type": "count", "data": 1}, {"@data-type": "count", "data": 1}]}`},
+		{name: "composite set element", wantErr: "a vector is not comparable",
+			input: `{"@data-type": "set", "data": [{"@data-type": "vector", "data": []}]}`},
+		{name: "composite table key before type", wantErr: "a vector is not comparable",
+			input: `{"data": [{"key": {"@data-type": "vector", "data": []}, "value": {"@data-type": "count", "data": 1}}],` +
+				` "@data-type": "table"}`},
+		{name: "bad table entry", wantErr: `only "key" and "value" properties`,
+			input: `{"@data-type": "table", "data": [{"key": {"@data-type": "count", "data": 1}, "other": 1}]}`},
+		{name: "missing table value", wantErr: `a property named "value"`,
+			input: `{"@data-type": "table", "data": [{"key": {"@data-type": "count", "data": 1}}]}`},
+		{name: "truncated", input: `{"@data-type": "vector", "data": [`, wantErr: "unexpected"},
+		{name: "max depth", input: nestedVectorJSON(3), opts: DecoderOptions{MaxDepth: 2},
+			wantErr: ErrMaxDepthExceeded.Error()},
+		{name: "max elements", input: countVectorJSON(3), opts: DecoderOptions{MaxElements: 2},
+			wantErr: ErrMaxElementsExceeded.Error()},
+		{name: "max bytes", input: countVectorJSON(100), opts: DecoderOptions{MaxBytes: 100},
+			wantErr: ErrMaxBytesExceeded.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := NewDecoder(strings.NewReader(tt.input))
+			dec.SetOptions(tt.opts)
+
+			_, err := dec.Decode()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// ErrUnregisteredEnumValue is returned by EnumRegistry.EnumValueChecked for names that have not been registered.
+var ErrUnregisteredEnumValue = errors.New("enum value is not registered")
+
+// ErrMalformedEnumValue is returned for names that are not (optionally module-qualified) zeek identifiers.
+var ErrMalformedEnumValue = errors.New("enum value is not a valid zeek identifier")
+
+// enumValuePattern matches zeek identifiers with any number of module qualifiers, e.g. "Conn::OrigInactivity".
+var enumValuePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(::[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// EnumRegistry is a set of known zeek enum values, used to catch typos in enum names when publishing rather than
+// having zeek silently ignore the event. Names must be registered exactly as zeek spells them, including any
+// module qualification. An EnumRegistry is safe for concurrent use; the zero value is an empty registry.
+type EnumRegistry struct {
+	mu    sync.RWMutex
+	names map[string]struct{}
+}
+
+// NewEnumRegistry returns an EnumRegistry containing names, or an error if any of them is malformed.
+func NewEnumRegistry(names ...string) (*EnumRegistry, error) {
+	r := &EnumRegistry{}
+	if err := r.Register(names...); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Register adds names to the registry. If any of them is malformed, an error is returned and none are added.
+func (r *EnumRegistry) Register(names ...string) error {
+	for _, name := range names {
+		if !enumValuePattern.MatchString(name) {
+			return fmt.Errorf("%w: %q", ErrMalformedEnumValue, name)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names == nil {
+		r.names = make(map[string]struct{}, len(names))
+	}
+
+	for _, name := range names {
+		r.names[name] = struct{}{}
+	}
+
+	return nil
+}
+
+// IsRegistered returns true if name has been registered.
+func (r *EnumRegistry) IsRegistered(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.names[name]
+	return ok
+}
+
+// EnumValueChecked is like EnumValue, but returns an error if name has not been registered.
+func (r *EnumRegistry) EnumValueChecked(name string) (Data, error) {
+	if !r.IsRegistered(name) {
+		if !enumValuePattern.MatchString(name) {
+			return Data{}, fmt.Errorf("%w: %q", ErrMalformedEnumValue, name)
+		}
+		return Data{}, fmt.Errorf("%w: %q", ErrUnregisteredEnumValue, name)
+	}
+
+	return EnumValue(name), nil
+}
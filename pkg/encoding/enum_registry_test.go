@@ -0,0 +1,64 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEnumRegistry_EnumValueChecked(t *testing.T) {
+	r, err := NewEnumRegistry("Conn::OrigInactivity", "Notice::ACTION_LOG", "White")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		wantErr error
+	}{
+		{name: "Conn::OrigInactivity"},
+		{name: "White"},
+		{name: "Notice::ACTION_LOG"},
+		{name: "Conn::OrigInactivty", wantErr: ErrUnregisteredEnumValue},
+		{name: "OrigInactivity", wantErr: ErrUnregisteredEnumValue},
+		{name: "Conn:OrigInactivity", wantErr: ErrMalformedEnumValue},
+		{name: "", wantErr: ErrMalformedEnumValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.EnumValueChecked(tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("EnumValueChecked() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && got != EnumValue(tt.name) {
+				t.Errorf("EnumValueChecked() = %#v, want %#v", got, EnumValue(tt.name))
+			}
+		})
+	}
+}
+
+func TestEnumRegistry_Register(t *testing.T) {
+	var r EnumRegistry
+
+	if r.IsRegistered("Red") {
+		t.Error("zero value registry should be empty")
+	}
+
+	if err := r.Register("Red", "Not::Valid::"); !errors.Is(err, ErrMalformedEnumValue) {
+		t.Fatalf("expected ErrMalformedEnumValue but got %v", err)
+	}
+
+	if r.IsRegistered("Red") {
+		t.Error("no names should be registered when any are malformed")
+	}
+
+	if err := r.Register("Red", "A::B::C"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.IsRegistered("Red") || !r.IsRegistered("A::B::C") {
+		t.Error("expected names to be registered")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Equal reports whether d and other represent the same zeek value, regardless of how they are represented in Go.
+// In particular, sets and tables are compared without regard to order and whether they are map-backed (i.e. were
+// decoded) or slice-backed (i.e. were built with the Set and Table helpers), and timestamps are compared with
+// time.Time.Equal. Vectors are compared element by element. As in zeek, a NaN real is not equal to anything.
+func (d Data) Equal(other Data) bool {
+	if d.DataType != other.DataType {
+		return false
+	}
+
+	switch d.DataType {
+	case TypeTimestamp:
+		a, aOk := d.DataValue.(time.Time)
+		b, bOk := other.DataValue.(time.Time)
+		return aOk && bOk && a.Equal(b)
+	case TypeVector:
+		a, aErr := d.vectorElements()
+		b, bErr := other.vectorElements()
+		if aErr != nil || bErr != nil || len(a) != len(b) {
+			return false
+		}
+
+		for i := range a {
+			if !a[i].Equal(b[i]) {
+				return false
+			}
+		}
+		return true
+	case TypeSet:
+		a, _, aErr := d.setMembers()
+		b, _, bErr := other.setMembers()
+		if aErr != nil || bErr != nil || len(a) != len(b) {
+			return false
+		}
+
+		for _, elem := range a {
+			if !containsEqual(b, elem) {
+				return false
+			}
+		}
+		return true
+	case TypeTable:
+		a, aErr := d.tableMembers()
+		b, bErr := other.tableMembers()
+		if aErr != nil || bErr != nil || len(a) != len(b) {
+			return false
+		}
+
+		for _, entry := range a {
+			found := false
+			for _, otherEntry := range b {
+				if entry["key"].Equal(otherEntry["key"]) {
+					found = entry["value"].Equal(otherEntry["value"])
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(d.DataValue, other.DataValue)
+	}
+}
+
+// containsEqual reports whether any of elems is Equal to elem.
+func containsEqual(elems []Data, elem Data) bool {
+	for _, e := range elems {
+		if e.Equal(elem) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableMembers returns the key/value entries of a table, whether it is map-backed or slice-backed.
+func (d Data) tableMembers() ([]map[string]Data, error) {
+	switch table := d.DataValue.(type) {
+	case []map[string]Data:
+		return table, nil
+	case map[Data]Data:
+		return tableEntries(table), nil
+	default:
+		return nil, fmt.Errorf("table value has invalid type %T", d.DataValue)
+	}
+}
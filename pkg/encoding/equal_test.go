@@ -0,0 +1,59 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestData_Equal(t *testing.T) {
+	var decodedSet, decodedTable Data
+	if err := decodedSet.UnmarshalJSON([]byte(`{"@data-type": "set", "data": [
+		{"@data-type": "string", "data": "b"},
+		{"@data-type": "string", "data": "a"}
+	]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := decodedTable.UnmarshalJSON([]byte(`{"@data-type": "table", "data": [
+		{"key": {"@data-type": "string", "data": "a"}, "value": {"@data-type": "count", "data": 1}}
+	]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	builtSet := Data{DataType: TypeSet, DataValue: []Data{String("a"), String("b")}}
+
+	tests := []struct {
+		name string
+		a, b Data
+		want bool
+	}{
+		{name: "scalars", a: Count(1), b: Count(1), want: true},
+		{name: "different values", a: Count(1), b: Count(2), want: false},
+		{name: "different types", a: Count(1), b: Integer(1), want: false},
+		{name: "addresses", a: Address(net.ParseIP("10.0.0.1")), b: Address(net.ParseIP("10.0.0.1").To16()), want: true},
+		{name: "timestamps", a: Timestamp(now), b: Timestamp(now.UTC().Round(0)), want: true},
+		{name: "NaN", a: Real(math.NaN()), b: Real(math.NaN()), want: false},
+		{name: "none", a: None(), b: None(), want: true},
+		{name: "vectors", a: Vector(Count(1), String("a")), b: Vector(Count(1), String("a")), want: true},
+		{name: "vector order", a: Vector(Count(1), Count(2)), b: Vector(Count(2), Count(1)), want: false},
+		{name: "decoded and built set", a: decodedSet, b: builtSet, want: true},
+		{name: "different sets", a: decodedSet, b: Data{DataType: TypeSet, DataValue: []Data{String("a")}}, want: false},
+		{name: "decoded and built table", a: decodedTable, b: Table(map[Data]Data{String("a"): Count(1)}), want: true},
+		{name: "different table values", a: decodedTable, b: Table(map[Data]Data{String("a"): Count(2)}), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Equal(tt.b); got != tt.want {
+				t.Errorf("%v.Equal(%v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if got := tt.b.Equal(tt.a); got != tt.want {
+				t.Errorf("%v.Equal(%v) = %v, want %v", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
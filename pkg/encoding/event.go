@@ -45,6 +45,17 @@ func NewEvent(name string, arguments ...Data) Event {
 	}
 }
 
+// Arg returns the event's argument at index i, or an error rather than panicking if the event doesn't have that many
+// arguments (e.g. if it was published with a different signature).
+func (e Event) Arg(i int) (Data, error) {
+	if i < 0 || i >= len(e.Arguments) {
+		return Data{}, fmt.Errorf("argument index %d out of range for event %s with %d arguments", i, e.Name,
+			len(e.Arguments))
+	}
+
+	return e.Arguments[i], nil
+}
+
 // Encode encodes an Event into an encoding.DataMessage given the provided topic.
 func (e Event) Encode(topic string) DataMessage {
 	var data Data
@@ -73,11 +84,7 @@ func (e Event) Encode(topic string) DataMessage {
 		)
 	}
 
-	return DataMessage{
-		ConstType: "data-message",
-		Topic:     topic,
-		Data:      &data,
-	}
+	return NewDataMessage(topic, data)
 }
 
 // SetTimestamp adds or replaces the event metadata timestamp (using the current time,
@@ -91,23 +98,42 @@ func (e *Event) SetTimestamp(timestamp *time.Time) {
 	e.SetMetadata(EventMetaDataTypeTimestamp, Timestamp(*timestamp), true)
 }
 
+// Timestamp returns the event's network timestamp from its metadata, and whether it has one. ok is false if there is
+// no timestamp metadata entry or if its value isn't a timestamp.
+func (e Event) Timestamp() (timestamp time.Time, ok bool) {
+	for _, m := range e.Metadata {
+		if m.ID != EventMetaDataTypeTimestamp {
+			continue
+		}
+
+		timestamp, ok = m.Value.DataValue.(time.Time)
+		return timestamp, ok && m.Value.DataType == TypeTimestamp
+	}
+
+	return time.Time{}, false
+}
+
 // SetMetadata adds or replaces the event metadata. If replace is true then
-// value will be assigned to all existing entries with a matching id.
+// value will be assigned to all existing entries with a matching id (or added,
+// if there are none).
 func (e *Event) SetMetadata(id uint8, value Data, replace bool) {
 	em := EventMetaEntry{
 		ID:    uint64(id),
 		Value: value,
 	}
 
-	if !replace {
-		e.Metadata = append(e.Metadata, em)
-		return
+	replaced := false
+	if replace {
+		for i, m := range e.Metadata {
+			if m.ID == uint64(id) {
+				e.Metadata[i] = em
+				replaced = true
+			}
+		}
 	}
 
-	for i, m := range e.Metadata {
-		if m.ID == uint64(id) {
-			e.Metadata[i] = em
-		}
+	if !replaced {
+		e.Metadata = append(e.Metadata, em)
 	}
 }
 
@@ -129,13 +155,12 @@ func (e Event) String() string {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("event %s(", e.Name))
 	for i, arg := range e.Arguments {
-		sb.WriteString(arg.String())
-		if i == len(e.Arguments)-1 {
-			sb.WriteString(")")
-		} else {
+		if i > 0 {
 			sb.WriteString(", ")
 		}
+		sb.WriteString(arg.String())
 	}
+	sb.WriteString(")")
 	if len(e.Metadata) > 0 {
 		sb.WriteString("[")
 		for i, m := range e.Metadata {
@@ -0,0 +1,54 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvent_Arg(t *testing.T) {
+	evt := NewEvent("test_event", Count(1), String("x"))
+
+	got, err := evt.Arg(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := String("x"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Arg(1) = %#v, want %#v", got, want)
+	}
+
+	for _, i := range []int{-1, 2} {
+		if _, err = evt.Arg(i); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("Arg(%d): expected an out of range error but got %v", i, err)
+		}
+	}
+}
+
+func TestEvent_Timestamp(t *testing.T) {
+	evt := NewEvent("test_event")
+	if _, ok := evt.Timestamp(); ok {
+		t.Error("expected no timestamp without metadata")
+	}
+
+	ts := time.Date(2023, 5, 1, 12, 0, 0, 500, time.UTC)
+	evt.SetTimestamp(&ts)
+	got, ok := evt.Timestamp()
+	if !ok || !got.Equal(ts) {
+		t.Errorf("Timestamp() = %v, %v, want %v, true", got, ok, ts)
+	}
+
+	// setting it again replaces rather than adds the entry
+	later := ts.Add(time.Second)
+	evt.SetTimestamp(&later)
+	if got, ok = evt.Timestamp(); !ok || !got.Equal(later) || len(evt.Metadata) != 1 {
+		t.Errorf("Timestamp() = %v, %v with %d entries, want %v, true with 1", got, ok, len(evt.Metadata), later)
+	}
+
+	evt.SetMetadata(EventMetaDataTypeTimestamp, Count(1), true)
+	if _, ok = evt.Timestamp(); ok {
+		t.Error("expected no timestamp for a metadata value of the wrong type")
+	}
+}
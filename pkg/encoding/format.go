@@ -0,0 +1,123 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// String implements the Stringer interface for encoding.Data and produces a compact, type-annotated string
+// representation, e.g.: vector[count(1), string("foo"), table{string("k"): string("v")}]. Set elements and
+// table entries are sorted by their string representation, so the output is deterministic.
+func (d Data) String() string {
+	var sb strings.Builder
+	d.format(&sb, "", 0)
+	return sb.String()
+}
+
+// IndentString is like String, but renders the elements of containers on separate lines, each indented by
+// a copy of indent per level of nesting.
+func (d Data) IndentString(indent string) string {
+	var sb strings.Builder
+	d.format(&sb, indent, 0)
+	return sb.String()
+}
+
+func (d Data) format(sb *strings.Builder, indent string, depth int) {
+	var open, closing string
+	var elems []string
+
+	switch d.DataType { //nolint:exhaustive // non-containers are handled by formatScalar
+	case TypeVector:
+		vec, err := d.vectorElements()
+		if err != nil {
+			fmt.Fprintf(sb, "vector(%v)", d.DataValue)
+			return
+		}
+		open, closing = "vector[", "]"
+		for _, elem := range vec {
+			elems = append(elems, elem.formatNested(indent, depth+1))
+		}
+	case TypeSet:
+		switch set := d.DataValue.(type) {
+		case []Data:
+			for _, elem := range set {
+				elems = append(elems, elem.formatNested(indent, depth+1))
+			}
+		case map[Data]struct{}:
+			for elem := range set {
+				elems = append(elems, elem.formatNested(indent, depth+1))
+			}
+		default:
+			fmt.Fprintf(sb, "set(%v)", d.DataValue)
+			return
+		}
+		open, closing = "set{", "}"
+		sort.Strings(elems)
+	case TypeTable:
+		switch table := d.DataValue.(type) {
+		case []map[string]Data:
+			for _, entry := range table {
+				elems = append(elems, entry["key"].formatNested(indent, depth+1)+": "+
+					entry["value"].formatNested(indent, depth+1))
+			}
+		case map[Data]Data:
+			for k, v := range table {
+				elems = append(elems, k.formatNested(indent, depth+1)+": "+v.formatNested(indent, depth+1))
+			}
+		default:
+			fmt.Fprintf(sb, "table(%v)", d.DataValue)
+			return
+		}
+		open, closing = "table{", "}"
+		sort.Strings(elems)
+	default:
+		sb.WriteString(d.formatScalar())
+		return
+	}
+
+	sb.WriteString(open)
+	if indent == "" || len(elems) == 0 {
+		sb.WriteString(strings.Join(elems, ", "))
+	} else {
+		for _, elem := range elems {
+			sb.WriteString("\n")
+			sb.WriteString(strings.Repeat(indent, depth+1))
+			sb.WriteString(elem)
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n")
+		sb.WriteString(strings.Repeat(indent, depth))
+	}
+	sb.WriteString(closing)
+}
+
+func (d Data) formatNested(indent string, depth int) string {
+	var sb strings.Builder
+	d.format(&sb, indent, depth)
+	return sb.String()
+}
+
+func (d Data) formatScalar() string {
+	switch v := d.DataValue.(type) {
+	case string:
+		if d.DataType == TypeString {
+			return fmt.Sprintf("string(%q)", v)
+		}
+	case time.Duration:
+		return fmt.Sprintf("%s(%s)", d.DataType.String(), formatTimespan(v))
+	case time.Time:
+		return fmt.Sprintf("%s(%s)", d.DataType.String(), formatTimestamp(v))
+	case Service:
+		return fmt.Sprintf("%s(%d/%s)", d.DataType.String(), v.Port, v.Protocol.String())
+	case nil:
+		if d.DataType == TypeNone {
+			return d.DataType.String()
+		}
+	}
+
+	return fmt.Sprintf("%s(%v)", d.DataType.String(), d.DataValue)
+}
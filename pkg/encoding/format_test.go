@@ -0,0 +1,95 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestData_String_format(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  Data
+		want string
+	}{
+		{name: "boolean", arg: Boolean(true), want: `boolean(true)`},
+		{name: "count", arg: Count(42), want: `count(42)`},
+		{name: "integer", arg: Integer(-42), want: `integer(-42)`},
+		{name: "real", arg: Real(3.14159), want: `real(3.14159)`},
+		{name: "timespan", arg: Timespan(210 * time.Second), want: `timespan(3.5min)`},
+		{name: "timestamp", arg: Timestamp(time.Date(2023, time.May, 2, 4, 31, 49, 0, time.UTC)),
+			want: `timestamp(2023-05-02T04:31:49.000)`},
+		{name: "string", arg: String("hi \"there\""), want: `string("hi \"there\"")`},
+		{name: "enum-value", arg: EnumValue("White"), want: `enum-value(White)`},
+		{name: "address", arg: Address(net.ParseIP("1.2.3.4")), want: `address(1.2.3.4)`},
+		{name: "subnet", arg: Subnet(net.IPNet{IP: net.ParseIP("1.2.3.0"), Mask: net.CIDRMask(24, 32)}),
+			want: `subnet(1.2.3.0/24)`},
+		{name: "port", arg: Port(Service{Port: 443, Protocol: ProtocolTCP}), want: `port(443/tcp)`},
+		{name: "none", arg: None(), want: `none`},
+		{name: "empty vector", arg: Vector(), want: `vector[]`},
+		{name: "nested", arg: Vector(
+			Count(1),
+			String("foo"),
+			Table(map[Data]Data{String("k"): String("v"), String("a"): Vector(Count(2))}),
+			Set(map[Data]struct{}{Count(3): {}, Count(1): {}}),
+		), want: `vector[count(1), string("foo"), table{string("a"): vector[count(2)], string("k"): string("v")}, ` +
+			`set{count(1), count(3)}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.arg.String(); got != tt.want {
+				t.Errorf("String() = %s, want %s", got, tt.want)
+			}
+
+			if got := fmt.Sprint(tt.arg); got != tt.want {
+				t.Errorf("fmt.Sprint() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestData_IndentString(t *testing.T) {
+	d := Vector(
+		Count(1),
+		Table(map[Data]Data{String("k"): Vector(String("v"))}),
+		Set(map[Data]struct{}{}),
+	)
+
+	want := `vector[
+  count(1),
+  table{
+    string("k"): vector[
+      string("v"),
+    ],
+  },
+  set{},
+]`
+
+	if got := d.IndentString("  "); got != want {
+		t.Errorf("IndentString() = \n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEvent_String(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  Event
+		want string
+	}{
+		{name: "arguments", arg: NewEvent("ping", String("my-message"), Count(1)),
+			want: `event ping(string("my-message"), count(1))`},
+		{name: "no arguments", arg: NewEvent("ping"), want: `event ping()`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.arg.String(); got != tt.want {
+				t.Errorf("String() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
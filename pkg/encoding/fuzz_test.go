@@ -0,0 +1,71 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"strings"
+	"testing"
+)
+
+// fuzzDataSeeds are the seed corpus of Data values for the fuzz targets, taken from the fixtures of the other tests.
+func fuzzDataSeeds() []string {
+	return []string{
+		benchmarkEventJSON,
+		serviceSetFixture,
+		ipSetFixture,
+		mixedSetFixture,
+		nestedVectorJSON(3),
+		countVectorJSON(3),
+		`{"@data-type":"none","data":{}}`,
+		`{"@data-type":"boolean","data":true}`,
+		`{"@data-type":"integer","data":-1}`,
+		`{"@data-type":"real","data":1e308}`,
+		`{"@data-type":"timespan","data":"1.5ms"}`,
+		`{"@data-type":"timestamp","data":"2023-05-02T04:31:49.123456789"}`,
+		`{"@data-type":"subnet","data":"10.1.2.3/8"}`,
+		`{"@data-type":"port","data":"0/?"}`,
+		`{"@data-type":"enum-value","data":"Conn::SF"}`,
+		`{"data":{},"@data-type":"none"}`,
+		`{"@data-type":"set","data":[{"@data-type":"vector","data":[{"@data-type":"address","data":"10.0.0.1"}]}]}`,
+		`{"@data-type":"table","data":[{"key":{"@data-type":"address","data":"::1"},` +
+			`"value":{"@data-type":"subnet","data":"::/0"}}]}`,
+	}
+}
+
+// FuzzDataUnmarshal checks that decoding arbitrary input as Data never panics, and neither does re-encoding what
+// was decoded.
+func FuzzDataUnmarshal(f *testing.F) {
+	for _, seed := range fuzzDataSeeds() {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var d Data
+		if err := d.UnmarshalJSON(b); err != nil {
+			return
+		}
+
+		_, _ = d.MarshalJSON()
+		_ = d.String()
+	})
+}
+
+// FuzzDataMessageUnmarshal checks that decoding arbitrary input as a DataMessage never panics, and neither does
+// extracting an event from what was decoded.
+func FuzzDataMessageUnmarshal(f *testing.F) {
+	f.Add([]byte(decoderFixture))
+	f.Add([]byte(`{"type":"error","code":"deserialization_failed","context":"input #1 contained malformed JSON"}`))
+	for _, seed := range fuzzDataSeeds() {
+		f.Add([]byte(`{"type":"data-message","topic":"/topic/test",` + strings.TrimPrefix(seed, "{")))
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var msg DataMessage
+		if err := msg.UnmarshalJSON(b); err != nil {
+			return
+		}
+
+		_, _, _ = msg.GetEvent()
+		_, _ = msg.MarshalJSON()
+	})
+}
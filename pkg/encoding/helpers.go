@@ -3,7 +3,9 @@
 package encoding
 
 import (
+	"fmt"
 	"net"
+	"net/netip"
 	"time"
 )
 
@@ -31,7 +33,8 @@ func Integer(value int64) Data {
 	}
 }
 
-// Real creates an encoding.Data of real type given the provided float64 value.
+// Real creates an encoding.Data of real type given the provided float64 value. Infinite and NaN values can
+// be represented but not marshalled (see ErrNonFiniteReal).
 func Real(value float64) Data {
 	return Data{
 		DataType:  TypeReal,
@@ -47,7 +50,8 @@ func Timespan(value time.Duration) Data {
 	}
 }
 
-// Timespan creates an encoding.Data of timestamp type given the provided time.Time value.
+// Timestamp creates an encoding.Data of timestamp type given the provided time.Time value. Times in any location
+// may be used, but are encoded (and therefore decoded) as UTC.
 func Timestamp(value time.Time) Data {
 	return Data{
 		DataType:  TypeTimestamp,
@@ -63,7 +67,8 @@ func String(value string) Data {
 	}
 }
 
-// EnumValue creates an encoding.Data of enum-value type given the provided string value.
+// EnumValue creates an encoding.Data of enum-value type given the provided string value, which is not validated
+// (see EnumRegistry.EnumValueChecked).
 func EnumValue(value string) Data {
 	return Data{
 		DataType:  TypeEnumValue,
@@ -71,22 +76,69 @@ func EnumValue(value string) Data {
 	}
 }
 
-// Address creates an encoding.Data of address type given the provided net.IP value.
+// EnumValueOf creates an encoding.Data of enum-value type from a Go enum type (or any other fmt.Stringer).
+// The String method must return the name of the zeek enum value, including any module qualification
+// (e.g., "Conn::OrigInactivity"), since it is sent as-is.
+func EnumValueOf[T fmt.Stringer](v T) Data {
+	return EnumValue(v.String())
+}
+
+// Address creates an encoding.Data of address type given the provided net.IP value, which is
+// stored as a netip.Addr (IPv4 addresses in their 16-byte form are stored as plain IPv4).
 func Address(value net.IP) Data {
+	return NetIPAddress(addrFromIP(value))
+}
+
+// NetIPAddress creates an encoding.Data of address type given the provided netip.Addr value.
+func NetIPAddress(value netip.Addr) Data {
 	return Data{
 		DataType:  TypeAddress,
-		DataValue: value.String(),
+		DataValue: value,
 	}
 }
 
-// Subnet creates an encoding.Data of subnet type given the provided net.IPNet value.
+// addrFromIP converts a net.IP to a netip.Addr, returning the zero (invalid) netip.Addr for malformed input.
+func addrFromIP(ip net.IP) netip.Addr {
+	if ip4 := ip.To4(); ip4 != nil {
+		return netip.AddrFrom4([4]byte(ip4))
+	}
+
+	addr, _ := netip.AddrFromSlice(ip)
+	return addr
+}
+
+// Subnet creates an encoding.Data of subnet type given the provided net.IPNet value, which is stored as a
+// netip.Prefix. Non-canonical (non-contiguous) masks produce an invalid prefix. As in the net package, an
+// IPv4 address with a 16-byte mask is treated as IPv4, so e.g. ::ffff:1.2.3.4/128 is stored as 1.2.3.4/32.
 func Subnet(value net.IPNet) Data {
+	return NetIPSubnet(prefixFromIPNet(value))
+}
+
+// NetIPSubnet creates an encoding.Data of subnet type given the provided netip.Prefix value. Any host bits
+// are kept (e.g., 10.1.2.3/8 is encoded as such, rather than as 10.0.0.0/8): use value.Masked() to drop them.
+func NetIPSubnet(value netip.Prefix) Data {
 	return Data{
 		DataType:  TypeSubnet,
-		DataValue: value.String(),
+		DataValue: value,
 	}
 }
 
+// prefixFromIPNet converts a net.IPNet to a netip.Prefix, returning the zero (invalid) netip.Prefix for
+// malformed input.
+func prefixFromIPNet(network net.IPNet) netip.Prefix {
+	ones, bits := network.Mask.Size()
+	if ones == 0 && bits == 0 {
+		return netip.Prefix{}
+	}
+
+	addr := addrFromIP(network.IP)
+	if addr.Is4() && bits == net.IPv6len*8 {
+		ones -= (net.IPv6len - net.IPv4len) * 8
+	}
+
+	return netip.PrefixFrom(addr, ones)
+}
+
 // Port creates an encoding.Data of port type given the provided encoding.Service value.
 func Port(value Service) Data {
 	return Data{
@@ -95,6 +147,12 @@ func Port(value Service) Data {
 	}
 }
 
+// PortOf creates an encoding.Data of port type given a port number and protocol, e.g. PortOf(0, ProtocolUnknown)
+// for the "0/?" that zeek uses when the port is unknown.
+func PortOf(port uint16, proto Protocol) Data {
+	return Port(Service{Port: port, Protocol: proto})
+}
+
 // Vector creates an encoding.Data of vector type given the provided encoding.Data values.
 func Vector(elements ...Data) Data {
 	return Data{
@@ -105,20 +163,33 @@ func Vector(elements ...Data) Data {
 
 // Set creates an encoding.Data of set type given the provided map of Data to struct{} value.
 func Set(value map[Data]struct{}) Data {
+	return Data{
+		DataType:  TypeSet,
+		DataValue: setElements(value),
+	}
+}
+
+// setElements flattens a map-backed set into the slice of elements used for its JSON encoding.
+func setElements(value map[Data]struct{}) []Data {
 	valueList := make([]Data, len(value))
 	i := 0
 	for k := range value {
 		valueList[i] = k
 		i++
 	}
-	return Data{
-		DataType:  TypeSet,
-		DataValue: valueList,
-	}
+	return valueList
 }
 
 // Table creates an encoding.Data of table type given the provided map of Data to Data value.
 func Table(value map[Data]Data) Data {
+	return Data{
+		DataType:  TypeTable,
+		DataValue: tableEntries(value),
+	}
+}
+
+// tableEntries flattens a map-backed table into the slice of key/value entries used for its JSON encoding.
+func tableEntries(value map[Data]Data) []map[string]Data {
 	kvList := make([]map[string]Data, len(value))
 	i := 0
 	for k, v := range value {
@@ -128,10 +199,7 @@ func Table(value map[Data]Data) Data {
 		}
 		i++
 	}
-	return Data{
-		DataType:  TypeTable,
-		DataValue: kvList,
-	}
+	return kvList
 }
 
 // None creates an encoding.Data of none type.
@@ -3,8 +3,10 @@
 package encoding
 
 import (
+	"bytes"
 	"math"
 	"net"
+	"net/netip"
 	"reflect"
 	"testing"
 	"time"
@@ -142,6 +144,37 @@ func TestData_EnumValue(t *testing.T) {
 	}
 }
 
+type testColor int
+
+const (
+	testColorRed testColor = iota
+	testColorWhite
+)
+
+func (c testColor) String() string {
+	switch c {
+	case testColorRed:
+		return "Red"
+	case testColorWhite:
+		return "White"
+	default:
+		return "Unknown"
+	}
+}
+
+func TestData_EnumValueOf(t *testing.T) {
+	wantData := Data{
+		DataType:  "enum-value",
+		DataValue: "White",
+	}
+
+	gotData := EnumValueOf(testColorWhite)
+
+	if !reflect.DeepEqual(wantData, gotData) {
+		t.Errorf("output value incorrect, wanted: \n\t%#v\ngot: \n\t%#v", wantData, gotData)
+	}
+}
+
 func TestData_Subnet(t *testing.T) {
 	_, network, err := net.ParseCIDR("1.2.3.0/24")
 	if err != nil {
@@ -150,7 +183,7 @@ func TestData_Subnet(t *testing.T) {
 
 	wantData := Data{
 		DataType:  "subnet",
-		DataValue: "1.2.3.0/24",
+		DataValue: netip.MustParsePrefix("1.2.3.0/24"),
 	}
 
 	gotData := Subnet(*network)
@@ -160,12 +193,77 @@ func TestData_Subnet(t *testing.T) {
 	}
 }
 
+func TestData_Subnet_buildDecodeEqual(t *testing.T) {
+	tests := []struct {
+		name    string
+		network net.IPNet
+		json    string
+	}{
+		{name: "IPv4", network: net.IPNet{IP: net.ParseIP("10.1.0.0"), Mask: net.CIDRMask(16, 32)},
+			json: `{"@data-type":"subnet","data":"10.1.0.0/16"}`},
+		{name: "IPv4 16-byte mask", network: net.IPNet{IP: net.ParseIP("10.1.0.0"), Mask: net.CIDRMask(112, 128)},
+			json: `{"@data-type":"subnet","data":"10.1.0.0/16"}`},
+		{name: "IPv6", network: net.IPNet{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(32, 128)},
+			json: `{"@data-type":"subnet","data":"2001:db8::/32"}`},
+		{name: "host bits preserved", network: net.IPNet{IP: net.ParseIP("10.1.2.3"), Mask: net.CIDRMask(16, 32)},
+			json: `{"@data-type":"subnet","data":"10.1.2.3/16"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			built := Subnet(tt.network)
+
+			var decoded Data
+			if err := decoded.UnmarshalJSON([]byte(tt.json)); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(built, decoded) {
+				t.Errorf("built and decoded values differ: \n\t%#v\n\t%#v", built, decoded)
+			}
+
+			if err := built.ValidateEncodable(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestData_Subnet_singleHost(t *testing.T) {
+	for _, cidr := range []string{"1.2.3.4/32", "::1/128", "2001:db8::ff/128"} {
+		t.Run(cidr, func(t *testing.T) {
+			want := []byte(`{"@data-type":"subnet","data":"` + cidr + `"}` + "\n")
+
+			var decoded Data
+			if err := decoded.UnmarshalJSON(want); err != nil {
+				t.Fatal(err)
+			}
+
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, d := range map[string]Data{"decoded": decoded, "built": Subnet(*network)} {
+				got, err := d.MarshalJSON()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s subnet encoded as %s, want %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
 func TestData_Addr(t *testing.T) {
 	addr := net.ParseIP("1.2.3.4")
 
 	wantData := Data{
 		DataType:  "address",
-		DataValue: "1.2.3.4",
+		DataValue: netip.MustParseAddr("1.2.3.4"),
 	}
 
 	gotData := Address(addr)
@@ -173,6 +271,25 @@ func TestData_Addr(t *testing.T) {
 	if !reflect.DeepEqual(wantData, gotData) {
 		t.Errorf("output value incorrect, wanted: \n\t%#v\ngot: \n\t%#v", wantData, gotData)
 	}
+
+	var decodedData Data
+	if err := decodedData.UnmarshalJSON([]byte(`{"@data-type":"address","data":"1.2.3.4"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(gotData, decodedData) {
+		t.Errorf("decoded value differs, wanted: \n\t%#v\ngot: \n\t%#v", gotData, decodedData)
+	}
+
+	buf, err := gotData.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"@data-type":"address","data":"1.2.3.4"}` + "\n"
+	if string(buf) != want {
+		t.Errorf("expected %s got %s", want, buf)
+	}
 }
 
 func TestData_Port(t *testing.T) {
@@ -334,3 +451,33 @@ func TestData_None(t *testing.T) {
 		t.Errorf("output value incorrect, wanted: \n\t%#v\ngot: \n\t%#v", wantData, gotData)
 	}
 }
+
+func TestData_None_roundTrip(t *testing.T) {
+	roundTrip := func(d Data) Data {
+		buf, err := d.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got Data
+		if err = got.UnmarshalJSON(buf); err != nil {
+			t.Fatal(err)
+		}
+
+		return got
+	}
+
+	if got := roundTrip(None()); !reflect.DeepEqual(None(), got) {
+		t.Errorf("output value incorrect, wanted: \n\t%#v\ngot: \n\t%#v", None(), got)
+	}
+
+	vec, ok := roundTrip(Vector(String("foo"), None())).DataValue.([]Data)
+	if !ok || len(vec) != 2 || !reflect.DeepEqual(None(), vec[1]) {
+		t.Errorf("vector element incorrect, wanted: \n\t%#v\ngot: \n\t%#v", None(), vec)
+	}
+
+	table, ok := roundTrip(Table(map[Data]Data{String("foo"): None()})).DataValue.(map[Data]Data)
+	if !ok || !reflect.DeepEqual(None(), table[String("foo")]) {
+		t.Errorf("table value incorrect, wanted: \n\t%#v\ngot: \n\t%#v", None(), table)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// lazyVector is the DataValue of a vector decoded by UnmarshalLazyJSON: its elements are retained as raw JSON
+// and only decoded when accessed via VectorAt, with the options they were validated with.
+type lazyVector struct {
+	elems []json.RawMessage
+	opts  DecoderOptions
+}
+
+// MarshalJSON encodes the elements as they were decoded, without decoding them.
+func (v lazyVector) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.elems)
+}
+
+// UnmarshalLazyJSON is like UnmarshalJSON, except that if the top-level value is a vector, its elements are
+// not decoded up front. They must instead be accessed via VectorLen and VectorAt, which decodes each element
+// on demand, and the DataValue of such a vector is not a []Data. This avoids allocating the full tree for
+// very large vectors where only a few elements are inspected. Nested values are decoded eagerly. The default
+// DecoderOptions apply.
+func (d *Data) UnmarshalLazyJSON(b []byte) error {
+	return d.UnmarshalLazyJSONWithOptions(b, DecoderOptions{})
+}
+
+// UnmarshalLazyJSONWithOptions is like UnmarshalLazyJSON, but with limits given by opts. The limits apply to the
+// whole value as for UnmarshalJSONWithOptions, so each element of a top-level vector is decoded once here, to check
+// it against them (and that it is valid), and then discarded: an invalid element is reported here rather than by
+// VectorAt, and at most one element's tree is held in memory at a time.
+func (d *Data) UnmarshalLazyJSONWithOptions(b []byte, opts DecoderOptions) error {
+	if err := opts.checkSize(len(b)); err != nil {
+		return err
+	}
+
+	var envelope struct {
+		DataType Type            `json:"@data-type"`
+		Data     json.RawMessage `json:"data"`
+	}
+
+	if err := json.Unmarshal(b, &envelope); err != nil {
+		return err
+	}
+
+	if envelope.DataType != TypeVector {
+		return d.UnmarshalJSONWithOptions(b, opts)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(envelope.Data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return fmt.Errorf("expected Vector type to be serialized as JSON array")
+	}
+
+	st := newDecodeState(opts)
+	if err := st.enter(); err != nil {
+		return err
+	}
+
+	elems := []json.RawMessage{}
+	for i := 0; dec.More(); i++ {
+		if err := st.addElements(1); err != nil {
+			return err
+		}
+
+		var elem json.RawMessage
+		if err := dec.Decode(&elem); err != nil {
+			return fmt.Errorf("error decoding Vector element %d: %w", i, err)
+		}
+		if _, err := decodeElement(elem, opts, st); err != nil {
+			return fmt.Errorf("error decoding Vector element %d: %w", i, err)
+		}
+		elems = append(elems, elem)
+	}
+
+	d.DataType = TypeVector
+	d.DataValue = lazyVector{elems: elems, opts: opts}
+
+	return nil
+}
+
+// decodeElement decodes b, an element of a container, with st tracking the limits of the enclosing value.
+func decodeElement(b []byte, opts DecoderOptions, st *decodeState) (Data, error) {
+	dec := NewDecoder(bytes.NewReader(b))
+	dec.SetOptions(opts)
+	if err := dec.begin(); err != nil {
+		return Data{}, unexpectedEOF(err)
+	}
+	dec.st = st
+
+	return dec.decodeData()
+}
+
+// VectorLen returns the number of elements of a vector (including one decoded by UnmarshalLazyJSON),
+// or 0 if d is not a vector.
+func (d Data) VectorLen() int {
+	if d.DataType != TypeVector {
+		return 0
+	}
+
+	switch v := d.DataValue.(type) {
+	case []Data:
+		return len(v)
+	case lazyVector:
+		return len(v.elems)
+	default:
+		return 0
+	}
+}
+
+// VectorAt returns element i of a vector, decoding it first if the vector was decoded by UnmarshalLazyJSON.
+// Lazily decoded elements are not cached, so repeated access decodes the element each time.
+func (d Data) VectorAt(i int) (Data, error) {
+	if d.DataType != TypeVector {
+		return Data{}, fmt.Errorf("expected a vector but got a %s", d.DataType.String())
+	}
+
+	n := d.VectorLen()
+	if i < 0 || i >= n {
+		return Data{}, fmt.Errorf("vector index %d out of range (length %d)", i, n)
+	}
+
+	switch v := d.DataValue.(type) {
+	case []Data:
+		return v[i], nil
+	case lazyVector:
+		// the element is within the top-level vector, as when it was checked by UnmarshalLazyJSONWithOptions
+		st := newDecodeState(v.opts)
+		st.depth = 1
+
+		elem, err := decodeElement(v.elems[i], v.opts, st)
+		if err != nil {
+			return Data{}, fmt.Errorf("error decoding Vector element %d: %w", i, err)
+		}
+		return elem, nil
+	default:
+		return Data{}, fmt.Errorf("vector value has invalid type %T", d.DataValue)
+	}
+}
+
+// vectorElements returns the elements of a vector, decoding all elements of a lazily decoded vector.
+func (d Data) vectorElements() ([]Data, error) {
+	lazy, ok := d.DataValue.(lazyVector)
+	if !ok {
+		elems, ok := d.DataValue.([]Data)
+		if !ok {
+			return nil, fmt.Errorf("vector value has invalid type %T", d.DataValue)
+		}
+		return elems, nil
+	}
+
+	elems := make([]Data, len(lazy.elems))
+	for i := range lazy.elems {
+		var err error
+		if elems[i], err = d.VectorAt(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return elems, nil
+}
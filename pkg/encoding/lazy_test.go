@@ -0,0 +1,176 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func largeVectorJSON(tb testing.TB, n int) []byte {
+	tb.Helper()
+
+	elems := make([]Data, n)
+	for i := range elems {
+		elems[i] = Vector(Count(uint64(i)), String("element"))
+	}
+
+	buf, err := Vector(elems...).MarshalJSON()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return buf
+}
+
+func TestData_UnmarshalLazyJSON(t *testing.T) {
+	buf := largeVectorJSON(t, 100)
+
+	var eager Data
+	if err := eager.UnmarshalJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var lazy Data
+	if err := lazy.UnmarshalLazyJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if lazy.VectorLen() != 100 || eager.VectorLen() != 100 {
+		t.Fatalf("unexpected vector lengths %d (lazy) and %d (eager)", lazy.VectorLen(), eager.VectorLen())
+	}
+
+	for _, i := range []int{0, 42, 99} {
+		want, err := eager.VectorAt(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := lazy.VectorAt(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("element %d incorrect, wanted: \n\t%#v\ngot: \n\t%#v", i, want, got)
+		}
+	}
+
+	for _, i := range []int{-1, 100} {
+		if _, err := lazy.VectorAt(i); err == nil {
+			t.Errorf("expected an error for out of range index %d", i)
+		}
+	}
+
+	// Re-encoding a lazy vector must produce the same output as the eager one.
+	lazyBuf, err := lazy.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eagerBuf, err := eager.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(lazyBuf, eagerBuf) {
+		t.Errorf("lazy vector encoding differs, expected %s got %s", eagerBuf, lazyBuf)
+	}
+}
+
+func TestData_UnmarshalLazyJSON_notVector(t *testing.T) {
+	var d Data
+	if err := d.UnmarshalLazyJSON([]byte(`{"@data-type":"count","data":1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(Count(1), d) {
+		t.Errorf("output value incorrect, wanted: \n\t%#v\ngot: \n\t%#v", Count(1), d)
+	}
+
+	if d.VectorLen() != 0 {
+		t.Errorf("expected zero length for a non-vector")
+	}
+
+	if _, err := d.VectorAt(0); err == nil {
+		t.Errorf("expected an error indexing a non-vector")
+	}
+}
+
+func TestData_UnmarshalLazyJSON_invalidElement(t *testing.T) {
+	var d Data
+	err := d.UnmarshalLazyJSON([]byte(`{"@data-type":"vector","data":[{"@data-type":"count","data":-1}]}`))
+	if err == nil || !strings.Contains(err.Error(), "error decoding Vector element 0") {
+		t.Errorf("expected an error decoding an invalid element but got %v", err)
+	}
+}
+
+func TestData_UnmarshalLazyJSONWithOptions_limits(t *testing.T) {
+	buf := largeVectorJSON(t, 10) // 10 vectors of 2 elements each, so 30 elements and a depth of 2
+
+	tests := []struct {
+		name    string
+		opts    DecoderOptions
+		wantErr error
+	}{
+		{name: "MaxBytes", opts: DecoderOptions{MaxBytes: len(buf) - 1}, wantErr: ErrMaxBytesExceeded},
+		{name: "MaxElements", opts: DecoderOptions{MaxElements: 29}, wantErr: ErrMaxElementsExceeded},
+		{name: "MaxDepth", opts: DecoderOptions{MaxDepth: 1}, wantErr: ErrMaxDepthExceeded},
+		{name: "within limits", opts: DecoderOptions{MaxBytes: len(buf), MaxElements: 30, MaxDepth: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Data
+			err := d.UnmarshalLazyJSONWithOptions(buf, tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v but got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if _, err = d.VectorAt(9); err != nil {
+				t.Errorf("decoding an element within the limits: %v", err)
+			}
+		})
+	}
+}
+
+func BenchmarkVectorAt_sparse(b *testing.B) {
+	buf := largeVectorJSON(b, 10000)
+	indices := []int{0, 5000, 9999}
+
+	b.Run("eager", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			var d Data
+			if err := d.UnmarshalJSON(buf); err != nil {
+				b.Fatal(err)
+			}
+			for _, i := range indices {
+				if _, err := d.VectorAt(i); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("lazy", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			var d Data
+			if err := d.UnmarshalLazyJSON(buf); err != nil {
+				b.Fatal(err)
+			}
+			for _, i := range indices {
+				if _, err := d.VectorAt(i); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
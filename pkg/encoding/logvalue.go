@@ -0,0 +1,171 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ToLogValue converts d to plain Go values without the "@data-type"/"data" envelope, as zeek renders values in its
+// JSON logs, e.g. for indexing events into a document store:
+//
+//   - booleans, counts, integers, reals and strings are returned as bool, uint64, int64, float64 and string
+//   - enum values, addresses and subnets are returned as their string form, e.g. "Conn::SF", "10.0.0.1" and
+//     "10.0.0.0/8"
+//   - ports are returned as the port number (a uint16), since zeek logs the protocol separately
+//   - timestamps are returned as (float64) seconds since the epoch, and timespans as (float64) seconds
+//   - none is returned as nil
+//   - vectors and sets are returned as []interface{}; the elements of decoded sets are sorted by their table key
+//     string (see below), whereas those of slice-backed sets keep their order
+//   - tables are returned as map[string]interface{}, keyed by the table key string of each key
+//
+// Table keys are stringified as in zeek's ASCII logs: strings and enum values as-is, booleans as "T" or "F",
+// numbers in decimal, addresses and subnets in their string form, ports as e.g. "443/tcp", timestamps as seconds
+// since the epoch and timespans as seconds, none as "-", and composite keys (vectors) as their elements' strings
+// joined by commas, e.g. "10.0.0.1,443/tcp". Reals, timestamps and timespans have up to six decimal places, with
+// trailing zeros removed (e.g. "1.5", "2.0"). Distinct keys that stringify
+// the same (e.g. the string "1" and the count 1) collide, in which case the entry whose key sorts last by
+// String wins.
+//
+// Values with a DataValue of the wrong Go type for their DataType are returned unchanged.
+func (d Data) ToLogValue() interface{} {
+	switch d.DataType { //nolint:exhaustive // the remaining types are already plain Go values
+	case TypeEnumValue, TypeAddress, TypeSubnet:
+		switch v := d.DataValue.(type) {
+		case string:
+			return v
+		case netip.Addr:
+			return v.String()
+		case netip.Prefix:
+			return v.String()
+		}
+	case TypePort:
+		if s, ok := d.DataValue.(Service); ok {
+			return s.Port
+		}
+	case TypeTimestamp:
+		if t, ok := d.DataValue.(time.Time); ok {
+			return unixSeconds(t)
+		}
+	case TypeTimespan:
+		if dur, ok := d.DataValue.(time.Duration); ok {
+			return dur.Seconds()
+		}
+	case TypeVector:
+		elems, err := d.vectorElements()
+		if err != nil {
+			return d.DataValue
+		}
+		return logValues(elems)
+	case TypeSet:
+		elems, decoded, err := d.setMembers()
+		if err != nil {
+			return d.DataValue
+		}
+		if decoded {
+			sort.Slice(elems, func(i, j int) bool { return elems[i].logKeyString() < elems[j].logKeyString() })
+		}
+		return logValues(elems)
+	case TypeTable:
+		entries, err := d.tableMembers()
+		if err != nil {
+			return d.DataValue
+		}
+
+		// Entries are added in order of their keys' String, so that the winner of any collision is deterministic.
+		entries = append([]map[string]Data(nil), entries...)
+		sort.Slice(entries, func(i, j int) bool { return entries[i]["key"].String() < entries[j]["key"].String() })
+
+		m := make(map[string]interface{}, len(entries))
+		for _, entry := range entries {
+			m[entry["key"].logKeyString()] = entry["value"].ToLogValue()
+		}
+		return m
+	}
+
+	return d.DataValue
+}
+
+// logValues converts each of elems with ToLogValue.
+func logValues(elems []Data) []interface{} {
+	values := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		values[i] = elem.ToLogValue()
+	}
+	return values
+}
+
+// logKeyString renders d as a table key string for ToLogValue, as documented there.
+func (d Data) logKeyString() string {
+	switch v := d.DataValue.(type) {
+	case string:
+		return v
+	case bool:
+		if v {
+			return "T"
+		}
+		return "F"
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return formatLogDouble(v)
+	case netip.Addr:
+		return v.String()
+	case netip.Prefix:
+		return v.String()
+	case Service:
+		return fmt.Sprintf("%d/%s", v.Port, v.Protocol.String())
+	case time.Time:
+		return formatLogDouble(unixSeconds(v))
+	case time.Duration:
+		return formatLogDouble(v.Seconds())
+	case nil:
+		return "-"
+	}
+
+	if elems, err := d.vectorElements(); d.DataType == TypeVector && err == nil {
+		keys := make([]string, len(elems))
+		for i, elem := range elems {
+			keys[i] = elem.logKeyString()
+		}
+		return strings.Join(keys, ",")
+	}
+
+	return fmt.Sprintf("%v", d.DataValue)
+}
+
+// formatLogDouble renders a double as zeek does in its logs: with up to six decimal places and trailing zeros
+// removed, but always with a decimal point (e.g. "0.25", "2.0"). Times and intervals, which zeek represents as a
+// double number of seconds, are rendered the same way.
+func formatLogDouble(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+
+	s := strings.TrimRight(strconv.FormatFloat(f, 'f', 6, 64), "0")
+	if strings.HasSuffix(s, ".") {
+		s += "0"
+	}
+	if s == "-0.0" {
+		s = "0.0"
+	}
+	return s
+}
+
+// unixSeconds returns t as (fractional) seconds since the epoch.
+func unixSeconds(t time.Time) float64 {
+	return float64(t.Unix()) + float64(t.Nanosecond())/float64(time.Second)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestData_ToLogValue(t *testing.T) {
+	ts := time.Date(2023, time.January, 2, 3, 4, 5, 678901000, time.UTC)
+
+	tests := []struct {
+		name string
+		arg  Data
+		want interface{}
+	}{
+		{name: "boolean", arg: Boolean(true), want: true},
+		{name: "count", arg: Count(42), want: uint64(42)},
+		{name: "integer", arg: Integer(-42), want: int64(-42)},
+		{name: "real", arg: Real(0.25), want: 0.25},
+		{name: "string", arg: String("foo"), want: "foo"},
+		{name: "enum-value", arg: EnumValue("Conn::SF"), want: "Conn::SF"},
+		{name: "address", arg: Address(net.ParseIP("2001:db8::1")), want: "2001:db8::1"},
+		{name: "subnet", arg: Subnet(net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(8, 32)}),
+			want: "10.0.0.0/8"},
+		{name: "port", arg: PortOf(443, ProtocolTCP), want: uint16(443)},
+		{name: "timestamp", arg: Timestamp(ts), want: 1672628645.678901},
+		{name: "timespan", arg: Timespan(1500 * time.Millisecond), want: 1.5},
+		{name: "none", arg: None(), want: nil},
+		{name: "vector", arg: Vector(Count(1), String("a")), want: []interface{}{uint64(1), "a"}},
+		{name: "built set keeps order", arg: Data{DataType: TypeSet, DataValue: []Data{String("b"), String("a")}},
+			want: []interface{}{"b", "a"}},
+		{name: "decoded set is sorted", arg: Data{DataType: TypeSet, DataValue: map[Data]struct{}{
+			String("b"): {}, String("a"): {},
+		}}, want: []interface{}{"a", "b"}},
+		{name: "table", arg: Table(map[Data]Data{
+			String("a"):                      Vector(Boolean(false)),
+			Count(7):                         String("seven"),
+			Boolean(true):                    None(),
+			Address(net.ParseIP("10.0.0.1")): PortOf(22, ProtocolTCP),
+			PortOf(53, ProtocolUDP):          Real(1),
+			Timestamp(ts):                    Count(1),
+			Timespan(time.Second):            Count(2),
+			EnumValue("Notice::ACTION_LOG"):  Count(3),
+			Integer(-1):                      Count(4),
+			Real(2.5):                        Count(5),
+		}), want: map[string]interface{}{
+			"a":                  []interface{}{false},
+			"7":                  "seven",
+			"T":                  nil,
+			"10.0.0.1":           uint16(22),
+			"53/udp":             1.0,
+			"1672628645.678901":  uint64(1),
+			"1.0":                uint64(2),
+			"Notice::ACTION_LOG": uint64(3),
+			"-1":                 uint64(4),
+			"2.5":                uint64(5),
+		}},
+		{name: "composite table key", arg: Data{DataType: TypeTable, DataValue: []map[string]Data{
+			{"key": Vector(Address(net.ParseIP("10.0.0.1")), PortOf(443, ProtocolTCP)), "value": String("https")},
+		}}, want: map[string]interface{}{"10.0.0.1,443/tcp": "https"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.arg.ToLogValue(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ToLogValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestData_ToLogValue_json(t *testing.T) {
+	var d Data
+	if err := d.UnmarshalJSON([]byte(benchmarkEventJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := d.Get(2, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := json.Marshal(rec.ToLogValue())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `["CHhAvVGS1DHFjwGM9",["192.168.1.10",49152,"2001:db8::1",443],1672628645.678901,1.5,"Conn::SF",` +
+		`1234,56789,0.25,true,"10.0.0.0/8",null,["http","ssl"],{"a":1,"b":2}]`
+	if string(got) != want {
+		t.Errorf("unexpected JSON:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+// OrderedTable builds a table whose entries are encoded in insertion order, as opposed to the random order
+// produced by Table for a map[Data]Data. Since it is backed by a slice, keys need not be comparable (e.g.,
+// composite keys encoded as vectors). Other than ordering, Encode produces output identical to Table.
+// The zero value is an empty table ready to use.
+type OrderedTable struct {
+	entries []orderedTableEntry
+}
+
+type orderedTableEntry struct {
+	key   Data
+	value Data
+}
+
+// Put adds an entry to the table, or replaces the value of an existing entry with an equal key (see Data.Equal), in
+// which case the entry keeps its original position.
+func (t *OrderedTable) Put(key, value Data) {
+	if i := t.index(key); i >= 0 {
+		t.entries[i].value = value
+		return
+	}
+
+	t.entries = append(t.entries, orderedTableEntry{key: key, value: value})
+}
+
+// Get returns the value of the entry with a key equal to key, if one exists.
+func (t *OrderedTable) Get(key Data) (Data, bool) {
+	if i := t.index(key); i >= 0 {
+		return t.entries[i].value, true
+	}
+
+	return Data{}, false
+}
+
+// Len returns the number of entries in the table.
+func (t *OrderedTable) Len() int {
+	return len(t.entries)
+}
+
+// Encode creates an encoding.Data of table type with the entries in insertion order.
+func (t *OrderedTable) Encode() Data {
+	kvList := make([]map[string]Data, len(t.entries))
+	for i, entry := range t.entries {
+		kvList[i] = map[string]Data{
+			"key":   entry.key,
+			"value": entry.value,
+		}
+	}
+
+	return Data{
+		DataType:  TypeTable,
+		DataValue: kvList,
+	}
+}
+
+// index returns the position of the entry whose key is equal to key (see Data.Equal), or -1 if there is none.
+func (t *OrderedTable) index(key Data) int {
+	for i, entry := range t.entries {
+		if entry.key.Equal(key) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOrderedTable(t *testing.T) {
+	var table OrderedTable
+	table.Put(Count(11), String("eleven"))
+	table.Put(Count(5), String("five"))
+	table.Put(Vector(Address(net.ParseIP("1.2.3.4")), Count(80)), String("composite"))
+	table.Put(Count(11), String("ELEVEN"))
+
+	if table.Len() != 3 {
+		t.Fatalf("expected 3 entries but got %d", table.Len())
+	}
+
+	got, ok := table.Get(Count(11))
+	if !ok || !reflect.DeepEqual(String("ELEVEN"), got) {
+		t.Errorf("Get() = %#v, %v", got, ok)
+	}
+
+	got, ok = table.Get(Vector(Address(net.ParseIP("1.2.3.4")), Count(80)))
+	if !ok || !reflect.DeepEqual(String("composite"), got) {
+		t.Errorf("Get() = %#v, %v", got, ok)
+	}
+
+	if _, ok = table.Get(Count(1)); ok {
+		t.Errorf("Get() found a missing key")
+	}
+
+	want := []byte(`{"@data-type":"table","data":[` +
+		`{"key":{"@data-type":"count","data":11},"value":{"@data-type":"string","data":"ELEVEN"}},` +
+		`{"key":{"@data-type":"count","data":5},"value":{"@data-type":"string","data":"five"}},` +
+		`{"key":{"@data-type":"vector","data":[{"@data-type":"address","data":"1.2.3.4"},` +
+		`{"@data-type":"count","data":80}]},"value":{"@data-type":"string","data":"composite"}}]}` + "\n")
+
+	buf, err := table.Encode().MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(want, buf) {
+		t.Errorf("expected %s got %s", want, buf)
+	}
+}
+
+func TestOrderedTable_matchesTable(t *testing.T) {
+	var ordered OrderedTable
+	ordered.Put(String("foo"), String("bar"))
+
+	want := Table(map[Data]Data{String("foo"): String("bar")})
+
+	if got := ordered.Encode(); !reflect.DeepEqual(want, got) {
+		t.Errorf("output value incorrect, wanted: \n\t%#v\ngot: \n\t%#v", want, got)
+	}
+}
+
+func TestOrderedTable_equalKeys(t *testing.T) {
+	// the same instant in different locations (and with or without a monotonic reading), and the same set backed by a
+	// slice (as built) or a map (as decoded)
+	now := time.Now()
+	members := []Data{Count(1), Count(2)}
+
+	var table OrderedTable
+	table.Put(Timestamp(now), String("local"))
+	table.Put(Timestamp(now.UTC().Round(0)), String("utc"))
+	table.Put(Data{DataType: TypeSet, DataValue: members}, String("slice"))
+	table.Put(Data{DataType: TypeSet, DataValue: map[Data]struct{}{Count(2): {}, Count(1): {}}}, String("map"))
+
+	if table.Len() != 2 {
+		t.Fatalf("expected 2 entries but got %d", table.Len())
+	}
+
+	if got, ok := table.Get(Timestamp(now.In(time.FixedZone("x", 3600)))); !ok || !got.Equal(String("utc")) {
+		t.Errorf("Get() = %#v, %v", got, ok)
+	}
+
+	if got, ok := table.Get(Data{DataType: TypeSet, DataValue: members}); !ok || !got.Equal(String("map")) {
+		t.Errorf("Get() = %#v, %v", got, ok)
+	}
+}
@@ -4,6 +4,7 @@ package encoding
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -21,6 +22,25 @@ Unknown = "?"
 */
 type Protocol string
 
+// rawProtocolPattern matches the protocols other than those of the Protocol enum that a port may carry, e.g.
+// "gre" or the numeric form "47".
+var rawProtocolPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ParseAnyProtocol is like ParseProtocol, but also accepts protocols other than those of the Protocol enum (e.g.
+// "gre", or a protocol number such as "47"), which are returned as-is so that they round-trip unchanged. Only
+// names that can't be encoded as the protocol of a port (e.g. "" or "a/b") are rejected.
+func ParseAnyProtocol(name string) (Protocol, error) {
+	if x, err := ParseProtocol(name); err == nil {
+		return x, nil
+	}
+
+	if !rawProtocolPattern.MatchString(name) {
+		return Protocol(""), fmt.Errorf("%q is %w", name, ErrInvalidProtocol)
+	}
+
+	return Protocol(name), nil
+}
+
 type Service struct {
 	Port     uint16
 	Protocol Protocol
@@ -37,7 +57,7 @@ func ParseService(stringValue string) (Service, error) {
 	if err != nil {
 		return Service{}, err
 	}
-	l4, err := ParseProtocol(parts[1])
+	l4, err := ParseAnyProtocol(parts[1])
 	if err != nil {
 		return Service{}, err
 	}
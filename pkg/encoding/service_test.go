@@ -0,0 +1,101 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseService_rawProtocol(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    Service
+		wantErr bool
+	}{
+		{arg: "443/tcp", want: Service{Port: 443, Protocol: ProtocolTCP}},
+		{arg: "25/gre", want: Service{Port: 25, Protocol: "gre"}},
+		{arg: "0/47", want: Service{Port: 0, Protocol: "47"}},
+		{arg: "9/ipv6-icmp", want: Service{Port: 9, Protocol: "ipv6-icmp"}},
+		{arg: "25/", wantErr: true},
+		{arg: "25/g re", wantErr: true},
+		{arg: "25/gre/x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := ParseService(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseService() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestData_rawProtocolRoundTrip(t *testing.T) {
+	for _, port := range []string{"25/gre", "0/47"} {
+		t.Run(port, func(t *testing.T) {
+			want := `{"@data-type":"port","data":"` + port + `"}`
+
+			var d Data
+			if err := d.UnmarshalJSON([]byte(want)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := d.ValidateEncodable(); err != nil {
+				t.Error(err)
+			}
+
+			got, err := d.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != want {
+				t.Errorf("expected %s got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestParseAnyProtocol(t *testing.T) {
+	if p, err := ParseAnyProtocol("?"); err != nil || p != ProtocolUnknown {
+		t.Errorf("ParseAnyProtocol(\"?\") = %v, %v", p, err)
+	}
+
+	if _, err := ParseAnyProtocol(""); !errors.Is(err, ErrInvalidProtocol) {
+		t.Errorf("expected ErrInvalidProtocol but got %v", err)
+	}
+}
+
+func TestData_unknownPortRoundTrip(t *testing.T) {
+	d := PortOf(0, ProtocolUnknown)
+	if d != Port(Service{Port: 0, Protocol: ProtocolUnknown}) {
+		t.Fatalf("unexpected value %#v", d)
+	}
+
+	buf, err := d.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"@data-type":"port","data":"0/?"}`
+	if string(buf) != want {
+		t.Errorf("expected %s got %s", want, buf)
+	}
+
+	var decoded Data
+	if err = decoded.UnmarshalJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded != d {
+		t.Errorf("decoded %#v, want %#v", decoded, d)
+	}
+
+	if err = decoded.ValidateEncodable(); err != nil {
+		t.Error(err)
+	}
+}
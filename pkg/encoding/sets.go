@@ -0,0 +1,125 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"sort"
+)
+
+// AsServiceSet returns the elements of a set of ports (e.g. a zeek set[port]) as a slice of Service. An error is
+// returned if d is not a set or if any element is not a port.
+//
+// Slice-backed sets (e.g. built with the Set helper) are returned in the order they are encoded in. Decoded
+// sets don't retain the order they were received in, so their elements are returned sorted by port number
+// and then protocol.
+func (d Data) AsServiceSet() ([]Service, error) {
+	elems, decoded, err := d.setMembers()
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]Service, len(elems))
+	for i, elem := range elems {
+		s, ok := elem.DataValue.(Service)
+		if elem.DataType != TypePort || !ok {
+			return nil, fmt.Errorf("set is not homogeneous: expected a port element but got a %s (%T)",
+				elem.DataType.String(), elem.DataValue)
+		}
+		services[i] = s
+	}
+
+	if decoded {
+		sort.Slice(services, func(i, j int) bool {
+			if services[i].Port != services[j].Port {
+				return services[i].Port < services[j].Port
+			}
+			return services[i].Protocol < services[j].Protocol
+		})
+	}
+
+	return services, nil
+}
+
+// AsIPSet returns the elements of a set of addresses (e.g. a zeek set[addr]) as a slice of net.IP. An error is
+// returned if d is not a set or if any element is not an address.
+//
+// Slice-backed sets (e.g. built with the Set helper) are returned in the order they are encoded in. Decoded
+// sets don't retain the order they were received in, so their elements are returned sorted by address.
+func (d Data) AsIPSet() ([]net.IP, error) {
+	elems, decoded, err := d.setMembers()
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]netip.Addr, len(elems))
+	for i, elem := range elems {
+		addr, ok := elem.DataValue.(netip.Addr)
+		if elem.DataType != TypeAddress || !ok {
+			return nil, fmt.Errorf("set is not homogeneous: expected an address element but got a %s (%T)",
+				elem.DataType.String(), elem.DataValue)
+		}
+		addrs[i] = addr
+	}
+
+	if decoded {
+		sort.Slice(addrs, func(i, j int) bool {
+			return addrs[i].Less(addrs[j])
+		})
+	}
+
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.AsSlice()
+	}
+
+	return ips, nil
+}
+
+// setMembers returns the elements of a set, and whether it is map-backed (i.e. was decoded) and so unordered.
+func (d Data) setMembers() ([]Data, bool, error) {
+	if d.DataType != TypeSet {
+		return nil, false, fmt.Errorf("expected a set but got a %s", d.DataType.String())
+	}
+
+	switch set := d.DataValue.(type) {
+	case []Data:
+		return set, false, nil
+	case map[Data]struct{}:
+		return setElements(set), true, nil
+	default:
+		return nil, false, fmt.Errorf("set value has invalid type %T", d.DataValue)
+	}
+}
+
+// SetContains reports whether elem is a member of the set d, comparing elements with Equal, so the result doesn't
+// depend on whether the set is map-backed (i.e. was decoded) or slice-backed (i.e. was built with the Set helper).
+// An error is returned if d is not a set.
+func (d Data) SetContains(elem Data) (bool, error) {
+	elems, decoded, err := d.setMembers()
+	if err != nil {
+		return false, err
+	}
+
+	if decoded && isMapKeyEqual(elem) {
+		_, ok := d.DataValue.(map[Data]struct{})[elem]
+		return ok, nil
+	}
+
+	return containsEqual(elems, elem), nil
+}
+
+// isMapKeyEqual reports whether looking elem up in a map-backed set or table is equivalent to comparing it with
+// Equal, i.e. its value is comparable and compared by ==. Containers and timestamps aren't, so must be compared
+// with Equal.
+func isMapKeyEqual(elem Data) bool {
+	switch elem.DataType {
+	case TypeVector, TypeSet, TypeTable, TypeTimestamp:
+		return false
+	default:
+		return elem.DataValue == nil || reflect.TypeOf(elem.DataValue).Comparable()
+	}
+}
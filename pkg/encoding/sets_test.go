@@ -0,0 +1,169 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	serviceSetFixture = `{"@data-type": "set", "data": [
+		{"@data-type": "port", "data": "443/tcp"},
+		{"@data-type": "port", "data": "53/udp"},
+		{"@data-type": "port", "data": "53/tcp"}
+	]}`
+	ipSetFixture = `{"@data-type": "set", "data": [
+		{"@data-type": "address", "data": "2001:db8::1"},
+		{"@data-type": "address", "data": "10.0.0.2"},
+		{"@data-type": "address", "data": "10.0.0.1"}
+	]}`
+	mixedSetFixture = `{"@data-type": "set", "data": [
+		{"@data-type": "port", "data": "443/tcp"},
+		{"@data-type": "address", "data": "10.0.0.1"}
+	]}`
+)
+
+func TestData_AsServiceSet(t *testing.T) {
+	var d Data
+	if err := d.UnmarshalJSON([]byte(serviceSetFixture)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := d.AsServiceSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Service{
+		{Port: 53, Protocol: ProtocolTCP},
+		{Port: 53, Protocol: ProtocolUDP},
+		{Port: 443, Protocol: ProtocolTCP},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AsServiceSet() = %v, want %v", got, want)
+	}
+}
+
+func TestData_AsServiceSet_wireOrder(t *testing.T) {
+	want := []Service{
+		{Port: 443, Protocol: ProtocolTCP},
+		{Port: 22, Protocol: ProtocolTCP},
+	}
+
+	d := Data{DataType: TypeSet, DataValue: []Data{Port(want[0]), Port(want[1])}}
+
+	got, err := d.AsServiceSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AsServiceSet() = %v, want %v", got, want)
+	}
+}
+
+func TestData_AsIPSet(t *testing.T) {
+	var d Data
+	if err := d.UnmarshalJSON([]byte(ipSetFixture)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := d.AsIPSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), net.ParseIP("2001:db8::1")}
+	if len(got) != len(want) {
+		t.Fatalf("AsIPSet() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("AsIPSet()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestData_AsXSet_errors(t *testing.T) {
+	var mixed Data
+	if err := mixed.UnmarshalJSON([]byte(mixedSetFixture)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		fn      func() error
+		wantErr string
+	}{
+		{name: "mixed ports", fn: func() error {
+			_, err := mixed.AsServiceSet()
+			return err
+		}, wantErr: "not homogeneous"},
+		{name: "mixed addresses", fn: func() error {
+			_, err := mixed.AsIPSet()
+			return err
+		}, wantErr: "not homogeneous"},
+		{name: "not a set", fn: func() error {
+			_, err := Vector(Port(Service{Port: 80, Protocol: ProtocolTCP})).AsServiceSet()
+			return err
+		}, wantErr: "expected a set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.fn()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestData_SetContains(t *testing.T) {
+	var strSet, ipSet Data
+	if err := strSet.UnmarshalJSON([]byte(`{"@data-type": "set", "data": [
+		{"@data-type": "string", "data": "example.com"},
+		{"@data-type": "string", "data": "example.org"}
+	]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipSet.UnmarshalJSON([]byte(ipSetFixture)); err != nil {
+		t.Fatal(err)
+	}
+	builtIPSet := Data{DataType: TypeSet, DataValue: []Data{Address(net.ParseIP("10.0.0.1"))}}
+
+	tests := []struct {
+		name string
+		set  Data
+		elem Data
+		want bool
+	}{
+		{name: "string present", set: strSet, elem: String("example.org"), want: true},
+		{name: "string absent", set: strSet, elem: String("example.net"), want: false},
+		{name: "string of another type", set: strSet, elem: EnumValue("example.org"), want: false},
+		{name: "address present", set: ipSet, elem: Address(net.ParseIP("2001:db8::1")), want: true},
+		{name: "address in 16-byte form", set: ipSet, elem: Address(net.ParseIP("10.0.0.2").To16()), want: true},
+		{name: "address absent", set: ipSet, elem: Address(net.ParseIP("10.0.0.3")), want: false},
+		{name: "built set", set: builtIPSet, elem: Address(net.ParseIP("10.0.0.1")), want: true},
+		{name: "vector element", set: strSet, elem: Vector(String("example.org")), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.set.SetContains(tt.elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("SetContains(%v) = %v, want %v", tt.elem, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Vector(String("a")).SetContains(String("a")); err == nil {
+		t.Error("expected an error for a vector")
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The separators and placeholders of zeek's ascii log writer (with its default settings).
+const (
+	tsvSeparator    = "\t"
+	tsvSetSeparator = ","
+	tsvEmptyField   = "(empty)"
+	tsvUnsetField   = "-"
+)
+
+// TSV renders the arguments of an event as a line (without a trailing newline) of a zeek-style tab-separated log,
+// matching the output of zeek's ascii log writer with its default settings. fields names the column for each
+// argument, in order (as in the "#fields" header of the log), and is used in errors.
+//
+// Values are rendered as follows:
+//   - none is rendered as "-" (unset)
+//   - booleans are rendered as "T" or "F"
+//   - reals, timestamps (as seconds since the epoch) and timespans (as seconds) are rendered with up to six decimal
+//     places, with trailing zeros removed
+//   - ports are rendered as the port number, since zeek logs the protocol separately
+//   - strings are rendered with non-printable bytes, and any separator in the string, escaped as \xNN (and a
+//     backslash escaped as \\). The empty string is rendered as "(empty)", and a string that would otherwise be
+//     mistaken for "-" or "(empty)" has its first character escaped.
+//   - sets and vectors are rendered as their elements joined by commas, or "(empty)" if they have none. The
+//     elements of decoded sets are sorted, whereas those of slice-backed sets keep their order.
+//
+// As in zeek, tables and containers nested in sets or vectors can't be logged, and an error is returned for them.
+// A record is encoded by broker as a vector, so an argument that is a record is rendered like a vector rather than
+// being flattened into a column per field as zeek would; use a column per field of the record instead.
+func (e Event) TSV(fields []string) (string, error) {
+	if len(fields) != len(e.Arguments) {
+		return "", fmt.Errorf("event %s has %d arguments but %d fields were given", e.Name, len(e.Arguments),
+			len(fields))
+	}
+
+	columns := make([]string, len(e.Arguments))
+	for i, arg := range e.Arguments {
+		var err error
+		if columns[i], err = arg.formatTSV(); err != nil {
+			return "", fmt.Errorf("field %s: %w", fields[i], err)
+		}
+	}
+
+	return strings.Join(columns, tsvSeparator), nil
+}
+
+// formatTSV renders d as a column of a zeek-style tab-separated log.
+func (d Data) formatTSV() (string, error) {
+	var elems []Data
+	switch d.DataType { //nolint:exhaustive // other types are scalars
+	case TypeTable:
+		return "", fmt.Errorf("a table cannot be logged")
+	case TypeVector:
+		var err error
+		if elems, err = d.vectorElements(); err != nil {
+			return "", err
+		}
+	case TypeSet:
+		var decoded bool
+		var err error
+		if elems, decoded, err = d.setMembers(); err != nil {
+			return "", err
+		}
+		if decoded {
+			sort.Slice(elems, func(i, j int) bool { return elems[i].String() < elems[j].String() })
+		}
+	default:
+		return d.formatTSVScalar(false)
+	}
+
+	if len(elems) == 0 {
+		return tsvEmptyField, nil
+	}
+
+	strs := make([]string, len(elems))
+	for i, elem := range elems {
+		var err error
+		if strs[i], err = elem.formatTSVScalar(true); err != nil {
+			return "", fmt.Errorf("%s element %d: %w", d.DataType.String(), i, err)
+		}
+	}
+
+	return strings.Join(strs, tsvSetSeparator), nil
+}
+
+// formatTSVScalar renders a non-container value for formatTSV, inSet being whether it is an element of a set or
+// vector (where the set separator must also be escaped).
+func (d Data) formatTSVScalar(inSet bool) (string, error) {
+	switch v := d.DataValue.(type) {
+	case nil:
+		if d.DataType == TypeNone {
+			return tsvUnsetField, nil
+		}
+	case bool:
+		if v {
+			return "T", nil
+		}
+		return "F", nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return formatLogDouble(v), nil
+	case time.Time:
+		return formatLogDouble(unixSeconds(v)), nil
+	case time.Duration:
+		return formatLogDouble(v.Seconds()), nil
+	case netip.Addr:
+		return v.String(), nil
+	case netip.Prefix:
+		return v.String(), nil
+	case Service:
+		return strconv.Itoa(int(v.Port)), nil
+	case string:
+		if d.DataType == TypeString {
+			return escapeTSVString(v, inSet), nil
+		}
+		return v, nil
+	}
+
+	switch d.DataType { //nolint:exhaustive // only containers are expected here
+	case TypeVector, TypeSet, TypeTable:
+		return "", fmt.Errorf("a %s cannot be logged inside a set or vector", d.DataType.String())
+	default:
+		return "", fmt.Errorf("%s value has invalid type %T", d.DataType.String(), d.DataValue)
+	}
+}
+
+// escapeTSVString escapes a string for a zeek-style tab-separated log, as documented for Event.TSV.
+func escapeTSVString(s string, inSet bool) string {
+	if s == "" {
+		return tsvEmptyField
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			sb.WriteString(`\\`)
+		case c < 0x20 || c >= 0x7f || (inSet && c == tsvSetSeparator[0]) ||
+			(i == 0 && (s == tsvUnsetField || s == tsvEmptyField)):
+			fmt.Fprintf(&sb, `\x%02x`, c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvent_TSV(t *testing.T) {
+	ts := time.Date(2023, time.January, 2, 3, 4, 5, 678901000, time.UTC)
+
+	evt := NewEvent("log_line",
+		Timestamp(ts),
+		String("CHhAvVGS1DHFjwGM9"),
+		Address(net.ParseIP("192.168.1.10")),
+		PortOf(443, ProtocolTCP),
+		EnumValue("Conn::SF"),
+		Timespan(1500*time.Millisecond),
+		Real(2),
+		Boolean(false),
+		Integer(-1),
+		Count(7),
+		None(),
+		Data{DataType: TypeSet, DataValue: map[Data]struct{}{String("ssl"): {}, String("http"): {}}},
+		Vector(),
+	)
+	fields := []string{"ts", "uid", "id.resp_h", "id.resp_p", "conn_state", "duration", "ratio", "local", "delta",
+		"count", "unset", "service", "history"}
+
+	got, err := evt.TSV(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{"1672628645.678901", "CHhAvVGS1DHFjwGM9", "192.168.1.10", "443", "Conn::SF", "1.5",
+		"2.0", "F", "-1", "7", "-", "http,ssl", "(empty)"}, "\t")
+	if got != want {
+		t.Errorf("TSV() = %q, want %q", got, want)
+	}
+}
+
+func TestEvent_TSV_strings(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  Data
+		want string
+	}{
+		{name: "plain", arg: String("foo bar"), want: "foo bar"},
+		{name: "empty", arg: String(""), want: "(empty)"},
+		{name: "unset lookalike", arg: String("-"), want: `\x2d`},
+		{name: "empty lookalike", arg: String("(empty)"), want: `\x28empty)`},
+		{name: "dash in string", arg: String("a-b"), want: "a-b"},
+		{name: "tab", arg: String("a\tb"), want: `a\x09b`},
+		{name: "newline", arg: String("a\nb"), want: `a\x0ab`},
+		{name: "backslash", arg: String(`a\b`), want: `a\\b`},
+		{name: "non-ASCII", arg: String("é"), want: `\xc3\xa9`},
+		{name: "comma", arg: String("a,b"), want: "a,b"},
+		{name: "comma in set", arg: Vector(String("a,b"), String("c")), want: `a\x2cb,c`},
+		{name: "empty string in set", arg: Vector(String("")), want: "(empty)"},
+		{name: "empty set", arg: Set(nil), want: "(empty)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewEvent("e", tt.arg).TSV([]string{"f"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("TSV() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvent_TSV_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		evt     Event
+		fields  []string
+		wantErr string
+	}{
+		{name: "field count", evt: NewEvent("e", Count(1)), fields: nil, wantErr: "has 1 arguments but 0 fields"},
+		{name: "table", evt: NewEvent("e", Table(map[Data]Data{Count(1): Count(2)})), fields: []string{"t"},
+			wantErr: "field t: a table cannot be logged"},
+		{name: "nested vector", evt: NewEvent("e", Vector(Vector(Count(1)))), fields: []string{"v"},
+			wantErr: "field v: vector element 0: a vector cannot be logged inside a set or vector"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.evt.TSV(tt.fields)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
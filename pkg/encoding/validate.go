@@ -0,0 +1,173 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"reflect"
+	"time"
+)
+
+// ValidateEncodable walks the Data tree and checks that every node can be encoded for broker: each value has
+// the Go type expected for its DataType, reals are finite, addresses/subnets/ports are well-formed, values
+// are non-nil (other than for None) and set elements/table keys are comparable. All problems found are returned
+// joined together (see errors.Join), each prefixed with the path of the offending node.
+func (d Data) ValidateEncodable() error {
+	var errs []error
+	d.validate("data", &errs)
+	return errors.Join(errs...)
+}
+
+//nolint:funlen,gocognit // a flat switch over all of the types is easier to follow than splitting it up
+func (d Data) validate(path string, errs *[]error) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, fmt.Errorf("%s (%s): %s", path, d.DataType.String(), fmt.Sprintf(format, args...)))
+	}
+
+	if !d.DataType.IsValid() {
+		fail("%s", ErrInvalidType.Error())
+		return
+	}
+
+	if d.DataType == TypeNone {
+		if d.DataValue != nil {
+			fail("expected a nil value but got a %T", d.DataValue)
+		}
+		return
+	}
+
+	if d.DataValue == nil || isNilPointer(d.DataValue) {
+		fail("value is nil")
+		return
+	}
+
+	switch d.DataType {
+	case TypeBoolean:
+		if _, ok := d.DataValue.(bool); !ok {
+			fail("expected a bool but got a %T", d.DataValue)
+		}
+	case TypeCount:
+		if _, ok := d.DataValue.(uint64); !ok {
+			fail("expected a uint64 but got a %T", d.DataValue)
+		}
+	case TypeInteger:
+		if _, ok := d.DataValue.(int64); !ok {
+			fail("expected an int64 but got a %T", d.DataValue)
+		}
+	case TypeReal:
+		f, ok := d.DataValue.(float64)
+		if !ok {
+			fail("expected a float64 but got a %T", d.DataValue)
+		} else if math.IsInf(f, 0) || math.IsNaN(f) {
+			fail("value %v is not finite", f)
+		}
+	case TypeTimespan:
+		if _, ok := d.DataValue.(time.Duration); !ok {
+			fail("expected a time.Duration but got a %T", d.DataValue)
+		}
+	case TypeTimestamp:
+		if _, ok := d.DataValue.(time.Time); !ok {
+			fail("expected a time.Time but got a %T", d.DataValue)
+		}
+	case TypeString, TypeEnumValue:
+		if _, ok := d.DataValue.(string); !ok {
+			fail("expected a string but got a %T", d.DataValue)
+		}
+	case TypeAddress:
+		addr, ok := d.DataValue.(netip.Addr)
+		if !ok {
+			fail("expected a netip.Addr but got a %T", d.DataValue)
+		} else if !addr.IsValid() {
+			fail("address is not valid")
+		}
+	case TypeSubnet:
+		prefix, ok := d.DataValue.(netip.Prefix)
+		if !ok {
+			fail("expected a netip.Prefix but got a %T", d.DataValue)
+		} else if !prefix.IsValid() {
+			fail("subnet is not valid")
+		}
+	case TypePort:
+		s, ok := d.DataValue.(Service)
+		if !ok {
+			fail("expected an encoding.Service but got a %T", d.DataValue)
+		} else if _, err := ParseAnyProtocol(string(s.Protocol)); err != nil {
+			fail("%q is not a valid protocol", s.Protocol)
+		}
+	case TypeVector:
+		switch d.DataValue.(type) {
+		case []Data, lazyVector:
+		default:
+			fail("expected a []encoding.Data but got a %T", d.DataValue)
+			return
+		}
+
+		elems, err := d.vectorElements()
+		if err != nil {
+			fail("%s", err.Error())
+			return
+		}
+		for i, elem := range elems {
+			elem.validate(fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case TypeSet:
+		switch set := d.DataValue.(type) {
+		case []Data:
+			for i, elem := range set {
+				elem.validateKey(fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		case map[Data]struct{}:
+			for elem := range set {
+				elem.validateKey(fmt.Sprintf("%s[%s]", path, elem.String()), errs)
+			}
+		default:
+			fail("expected a []encoding.Data or map[encoding.Data]struct{} but got a %T", d.DataValue)
+		}
+	case TypeTable:
+		switch table := d.DataValue.(type) {
+		case []map[string]Data:
+			for i, entry := range table {
+				k, kOk := entry["key"]
+				v, vOk := entry["value"]
+				if !kOk || !vOk || len(entry) != 2 {
+					fail("entry %d must have exactly a \"key\" and a \"value\"", i)
+					continue
+				}
+				k.validateKey(fmt.Sprintf("%s[%d].key", path, i), errs)
+				v.validate(fmt.Sprintf("%s[%d].value", path, i), errs)
+			}
+		case map[Data]Data:
+			for k, v := range table {
+				k.validateKey(fmt.Sprintf("%s[%s].key", path, k.String()), errs)
+				v.validate(fmt.Sprintf("%s[%s].value", path, k.String()), errs)
+			}
+		default:
+			fail("expected a []map[string]encoding.Data or map[encoding.Data]encoding.Data but got a %T",
+				d.DataValue)
+		}
+	case TypeNone:
+		// Handled above.
+	}
+}
+
+// validateKey validates a set element or table key, which in addition to being encodable must be
+// comparable so that it can be decoded into a map-backed set or table.
+func (d Data) validateKey(path string, errs *[]error) {
+	if d.DataValue != nil && !reflect.TypeOf(d.DataValue).Comparable() {
+		*errs = append(*errs, fmt.Errorf("%s (%s): a %T is not comparable and cannot be used as a set element or table key",
+			path, d.DataType.String(), d.DataValue))
+		return
+	}
+
+	d.validate(path, errs)
+}
+
+// isNilPointer returns true for typed nil pointers. Nil slices and maps are not included since they
+// are valid (empty) vectors, sets and tables.
+func isNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
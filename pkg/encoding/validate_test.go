@@ -0,0 +1,99 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestData_ValidateEncodable(t *testing.T) {
+	var nilService *Service
+
+	tests := []struct {
+		name    string
+		arg     Data
+		wantErr string
+	}{
+		{name: "valid", arg: Vector(
+			Boolean(true),
+			Count(1),
+			Integer(-1),
+			Real(math.Pi),
+			Timespan(time.Second),
+			Timestamp(time.Now()),
+			String("foo"),
+			EnumValue("Conn::LOG"),
+			Address(net.ParseIP("1.2.3.4")),
+			Subnet(net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(8, 32)}),
+			Port(Service{Port: 80, Protocol: ProtocolTCP}),
+			Set(map[Data]struct{}{String("foo"): {}}),
+			Table(map[Data]Data{Count(1): Vector(String("bar"))}),
+			Vector(),
+			None(),
+		)},
+		{name: "invalid type", arg: Data{DataType: "blob", DataValue: "foo"},
+			wantErr: "data (blob): not a valid Type"},
+		{name: "wrong Go type", arg: Vector(Data{DataType: TypeCount, DataValue: 1}),
+			wantErr: "data[0] (count): expected a uint64 but got a int"},
+		{name: "nil value", arg: Data{DataType: TypeString},
+			wantErr: "data (string): value is nil"},
+		{name: "nil pointer", arg: Data{DataType: TypePort, DataValue: nilService},
+			wantErr: "data (port): value is nil"},
+		{name: "non-nil none", arg: Data{DataType: TypeNone, DataValue: map[string]interface{}{}},
+			wantErr: "data (none): expected a nil value"},
+		{name: "infinite real", arg: Real(math.Inf(1)),
+			wantErr: "data (real): value +Inf is not finite"},
+		{name: "NaN real", arg: Vector(Vector(Real(math.NaN()))),
+			wantErr: "data[0][0] (real): value NaN is not finite"},
+		{name: "invalid address", arg: Address(net.IP{1, 2, 3}),
+			wantErr: "data (address): address is not valid"},
+		{name: "string address", arg: Data{DataType: TypeAddress, DataValue: "1.2.3.4"},
+			wantErr: "data (address): expected a netip.Addr but got a string"},
+		{name: "invalid subnet", arg: Subnet(net.IPNet{IP: net.ParseIP("1.2.3.4"), Mask: net.IPMask{255, 0, 255, 0}}),
+			wantErr: "data (subnet): subnet is not valid"},
+		{name: "string subnet", arg: Data{DataType: TypeSubnet, DataValue: "1.2.3.0/24"},
+			wantErr: "data (subnet): expected a netip.Prefix but got a string"},
+		{name: "invalid port", arg: Port(Service{Port: 80, Protocol: "tc/p"}),
+			wantErr: "data (port): \"tc/p\" is not a valid protocol"},
+		{name: "uncomparable set element", arg: Data{DataType: TypeSet, DataValue: []Data{Vector(Count(1))}},
+			wantErr: "data[0] (vector): a []encoding.Data is not comparable"},
+		{name: "uncomparable table key",
+			arg:     Data{DataType: TypeTable, DataValue: []map[string]Data{{"key": Vector(), "value": Count(1)}}},
+			wantErr: "data[0].key (vector): a []encoding.Data is not comparable"},
+		{name: "malformed table entry",
+			arg:     Data{DataType: TypeTable, DataValue: []map[string]Data{{"key": Count(1)}}},
+			wantErr: "data (table): entry 0 must have exactly a \"key\" and a \"value\""},
+		{name: "invalid table value", arg: Table(map[Data]Data{Count(1): Real(math.Inf(-1))}),
+			wantErr: "data[0].value (real): value -Inf is not finite"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.arg.ValidateEncodable()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateEncodable() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateEncodable() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestData_ValidateEncodable_allErrors(t *testing.T) {
+	err := Vector(Real(math.NaN()), Count(1), Data{DataType: TypeString}).ValidateEncodable()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if n := len(strings.Split(err.Error(), "\n")); n != 2 {
+		t.Errorf("expected 2 errors but got %d: %v", n, err)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// VectorOf creates an encoding.Data of vector type given the provided encoding.Data values, checking that every
+// element is of type t, as zeek vectors are homogeneously typed (e.g. a vector of count). Only the top-level type
+// of each element is checked, so e.g. a vector of vectors is accepted whatever the types of the inner elements.
+func VectorOf(t Type, elements ...Data) (Data, error) {
+	if !t.IsValid() {
+		return Data{}, fmt.Errorf("invalid vector element type %q", t.String())
+	}
+
+	v := Vector(elements...)
+	if _, err := v.homogeneousVectorElements(t); err != nil {
+		return Data{}, err
+	}
+
+	return v, nil
+}
+
+// IsHomogeneousVector reports whether d is a vector whose elements all have the same DataType, as zeek requires.
+// As with VectorOf, only the top-level type of each element is compared. An empty vector is homogeneous.
+func (d Data) IsHomogeneousVector() bool {
+	if d.DataType != TypeVector {
+		return false
+	}
+
+	elems, err := d.vectorElements()
+	if err != nil {
+		return false
+	}
+
+	for _, elem := range elems {
+		if elem.DataType != elems[0].DataType {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CountVector creates an encoding.Data of vector type with an element of count type for each of the provided
+// uint64 values.
+func CountVector(values []uint64) Data {
+	elements := make([]Data, len(values))
+	for i, v := range values {
+		elements[i] = Count(v)
+	}
+	return Vector(elements...)
+}
+
+// StringVector creates an encoding.Data of vector type with an element of string type for each of the provided
+// string values.
+func StringVector(values []string) Data {
+	elements := make([]Data, len(values))
+	for i, v := range values {
+		elements[i] = String(v)
+	}
+	return Vector(elements...)
+}
+
+// AddressVector creates an encoding.Data of vector type with an element of address type for each of the provided
+// net.IP values (see Address).
+func AddressVector(values []net.IP) Data {
+	elements := make([]Data, len(values))
+	for i, v := range values {
+		elements[i] = Address(v)
+	}
+	return Vector(elements...)
+}
+
+// AsCountVector returns the elements of a vector of counts (e.g. a zeek vector of count) as a slice of uint64.
+// An error is returned if d is not a vector or if any element is not a count.
+func (d Data) AsCountVector() ([]uint64, error) {
+	elems, err := d.homogeneousVectorElements(TypeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]uint64, len(elems))
+	for i, elem := range elems {
+		v, ok := elem.DataValue.(uint64)
+		if !ok {
+			return nil, fmt.Errorf("vector element %d has invalid type %T", i, elem.DataValue)
+		}
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+// AsStringVector returns the elements of a vector of strings (e.g. a zeek vector of string) as a slice of string.
+// An error is returned if d is not a vector or if any element is not a string.
+func (d Data) AsStringVector() ([]string, error) {
+	elems, err := d.homogeneousVectorElements(TypeString)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, len(elems))
+	for i, elem := range elems {
+		v, ok := elem.DataValue.(string)
+		if !ok {
+			return nil, fmt.Errorf("vector element %d has invalid type %T", i, elem.DataValue)
+		}
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+// AsAddressVector returns the elements of a vector of addresses (e.g. a zeek vector of addr) as a slice of net.IP.
+// An error is returned if d is not a vector or if any element is not an address. IPv4 addresses are returned in
+// their 4-byte form and IPv6 addresses in their 16-byte form.
+func (d Data) AsAddressVector() ([]net.IP, error) {
+	elems, err := d.homogeneousVectorElements(TypeAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]net.IP, len(elems))
+	for i, elem := range elems {
+		v, ok := elem.DataValue.(netip.Addr)
+		if !ok || !v.IsValid() {
+			return nil, fmt.Errorf("vector element %d is not a valid address (%T)", i, elem.DataValue)
+		}
+		values[i] = v.AsSlice()
+	}
+
+	return values, nil
+}
+
+// homogeneousVectorElements returns the elements of a vector, checking that they are all of type t.
+func (d Data) homogeneousVectorElements(t Type) ([]Data, error) {
+	if d.DataType != TypeVector {
+		return nil, fmt.Errorf("expected a vector but got a %s", d.DataType.String())
+	}
+
+	elems, err := d.vectorElements()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, elem := range elems {
+		if elem.DataType != t {
+			return nil, fmt.Errorf("vector is not homogeneous: expected a %s element but got a %s at index %d",
+				t.String(), elem.DataType.String(), i)
+		}
+	}
+
+	return elems, nil
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package encoding
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVectorOf(t *testing.T) {
+	got, err := VectorOf(TypeCount, Count(1), Count(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := Vector(Count(1), Count(2)); !reflect.DeepEqual(got, want) {
+		t.Errorf("VectorOf() = %#v, want %#v", got, want)
+	}
+
+	// only the top-level type of nested containers is compared
+	if _, err = VectorOf(TypeVector, Vector(Count(1)), Vector(String("x"))); err != nil {
+		t.Errorf("unexpected error for a vector of vectors: %v", err)
+	}
+
+	if _, err = VectorOf(TypeString); err != nil {
+		t.Errorf("unexpected error for an empty vector: %v", err)
+	}
+
+	_, err = VectorOf(TypeCount, Count(1), String("x"))
+	if err == nil || !strings.Contains(err.Error(), "got a string at index 1") {
+		t.Errorf("expected a homogeneity error but got %v", err)
+	}
+
+	if _, err = VectorOf(Type("bogus")); err == nil {
+		t.Error("expected an error for an invalid type")
+	}
+}
+
+func TestData_IsHomogeneousVector(t *testing.T) {
+	lazy := Data{}
+	if err := lazy.UnmarshalLazyJSON([]byte(`{"@data-type": "vector", "data": [
+		{"@data-type": "count", "data": 1},
+		{"@data-type": "string", "data": "x"}
+	]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		d    Data
+		want bool
+	}{
+		{name: "homogeneous", d: Vector(String("a"), String("b")), want: true},
+		{name: "empty", d: Vector(), want: true},
+		{name: "nested", d: Vector(Vector(Count(1)), Vector(String("x"))), want: true},
+		{name: "mixed", d: Vector(Count(1), String("x")), want: false},
+		{name: "lazy mixed", d: lazy, want: false},
+		{name: "not a vector", d: Count(1), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.d.IsHomogeneousVector(); got != tt.want {
+				t.Errorf("IsHomogeneousVector() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBulkVectors(t *testing.T) {
+	counts := []uint64{1, 2, 3}
+	gotCounts, err := CountVector(counts).AsCountVector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotCounts, counts) {
+		t.Errorf("AsCountVector() = %v, want %v", gotCounts, counts)
+	}
+
+	strs := []string{"a", "b"}
+	gotStrs, err := StringVector(strs).AsStringVector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotStrs, strs) {
+		t.Errorf("AsStringVector() = %v, want %v", gotStrs, strs)
+	}
+
+	ips := []net.IP{net.ParseIP("10.0.0.1").To4(), net.ParseIP("2001:db8::1")}
+	gotIPs, err := AddressVector(ips).AsAddressVector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotIPs, ips) {
+		t.Errorf("AsAddressVector() = %v, want %v", gotIPs, ips)
+	}
+
+	if want := Vector(Count(1), Count(2), Count(3)); !reflect.DeepEqual(CountVector(counts), want) {
+		t.Errorf("CountVector() = %#v, want %#v", CountVector(counts), want)
+	}
+}
+
+func TestBulkVectors_errors(t *testing.T) {
+	if _, err := Vector(Count(1), String("x")).AsCountVector(); err == nil ||
+		!strings.Contains(err.Error(), "not homogeneous") {
+		t.Errorf("expected a homogeneity error but got %v", err)
+	}
+
+	if _, err := Count(1).AsStringVector(); err == nil || !strings.Contains(err.Error(), "expected a vector") {
+		t.Errorf("expected a type error but got %v", err)
+	}
+
+	if _, err := Vector(NetIPAddress(netip.Addr{})).AsAddressVector(); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
+
+func TestData_MarshalJSON_emptyVector(t *testing.T) {
+	for _, d := range []Data{Vector(), CountVector(nil)} {
+		b, err := d.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := string(bytes.TrimSpace(b)), `{"@data-type":"vector","data":[]}`; got != want {
+			t.Errorf("MarshalJSON() = %s, want %s", got, want)
+		}
+	}
+}
@@ -5,39 +5,217 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"net"
-	"os"
+	"sync"
+	"time"
+
+	"github.com/corelight/go-zeek-broker-ws/pkg/client"
 )
 
 var ErrNoCACertsLoadedFromPEM = errors.New("no CA certs were loaded from the PEM file")
 
-func MakeSecureDialer(caFile, clientCertFile, clientCertKey string) func(ctx context.Context, network, addr string) (net.Conn, error) {
-	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
-		caCert, err := os.ReadFile(caFile)
-		if err != nil {
+// ErrIncompleteClientCert is returned when only one of the client certificate and its key is given.
+var ErrIncompleteClientCert = errors.New("the client certificate and key must both be given, or neither")
+
+// Dialer makes TLS connections to broker, verifying its certificate against a CA and presenting a client
+// certificate, as configured by NewDialer or NewDialerFromPEM. Its DialContext method is a client.TLSDialFunc.
+// A Dialer may be used for any number of concurrent dials, but its fields mustn't be changed while a dial is in
+// progress.
+type Dialer struct {
+	// Config is the TLS configuration of each connection, which has ServerName set to the host dialed if Config has
+	// none. It mustn't be modified once it has been used to dial, but may be replaced with a modified clone. With
+	// WithReloadInterval, it is replaced when the files change, so use CurrentConfig while the Dialer is in use.
+	Config *tls.Config
+
+	// Timeout bounds each dial, including the TLS handshake, as WithDialTimeout; zero means that only the context
+	// given to DialContext bounds it.
+	Timeout time.Duration
+
+	mu       sync.Mutex // guards Config when reloading
+	reloader *reloader
+}
+
+// NewDialer returns a Dialer that verifies the broker's certificate against the CA in caFile and presents the client
+// certificate and key. For one-way TLS, where broker doesn't verify clients, clientCertFile and clientCertKey are both
+// empty, and no client certificate is presented (ErrIncompleteClientCert is returned if only one is empty). The files
+// are read and parsed here, returning an error if any can't be read or is invalid (see NewDialerFromPEM), and the
+// result is reused by every dial, so later changes to the files have no effect unless WithReloadInterval is given.
+// The TLS configuration can be customised with opts, e.g. WithTLSConfig.
+func NewDialer(caFile, clientCertFile, clientCertKey string, opts ...Option) (*Dialer, error) {
+	if (clientCertFile == "") != (clientCertKey == "") {
+		return nil, ErrIncompleteClientCert
+	}
+
+	o := makeOptions(opts)
+	files := certFiles{ca: caFile, cert: clientCertFile, key: clientCertKey}
+
+	var versions []fileVersion
+	if o.reloadInterval > 0 {
+		// The files are checked before they are read, so that a change while they are read is seen by the next check.
+		var err error
+		if versions, err = files.stat(); err != nil {
 			return nil, err
 		}
+	}
+
+	config, err := files.load(o)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dialer{Config: config, Timeout: o.dialTimeout}
+	if o.reloadInterval > 0 {
+		d.reloader = &reloader{files: files, opts: o, versions: versions, checked: time.Now()}
+	}
 
-		certPool := x509.NewCertPool()
-		if ok := certPool.AppendCertsFromPEM(caCert); !ok {
-			return nil, ErrNoCACertsLoadedFromPEM
+	return d, nil
+}
+
+// NewDialerFromPEM is NewDialer, but given the PEM-encoded CA, client certificate and key themselves (e.g. from
+// environment variables or a secrets manager) rather than the files containing them. To read them from an io.Reader,
+// use io.ReadAll. The material is parsed once, here, returning ErrNoCACertsLoadedFromPEM if caPEM contains no
+// certificates, or the error from tls.X509KeyPair if the certificate or key is invalid. As for NewDialer, certPEM and
+// keyPEM are both empty for one-way TLS.
+func NewDialerFromPEM(caPEM, certPEM, keyPEM []byte, opts ...Option) (*Dialer, error) {
+	o := makeOptions(opts)
+
+	config, err := makeTLSConfig(caPEM, certPEM, keyPEM, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Dialer{Config: config, Timeout: o.dialTimeout}, nil
+}
+
+// MakeSecureDialer returns a dial function for client.NewClient that verifies the broker's certificate against
+// the CA in caFile and presents the client certificate and key: the DialContext method of the Dialer returned by
+// NewDialer, which documents the arguments and errors.
+func MakeSecureDialer(caFile, clientCertFile, clientCertKey string, opts ...Option) (client.TLSDialFunc, error) {
+	d, err := NewDialer(caFile, clientCertFile, clientCertKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.DialContext, nil
+}
+
+// MakeSecureDialerFromPEM is MakeSecureDialer, but given the PEM-encoded CA, client certificate and key themselves,
+// as NewDialerFromPEM.
+func MakeSecureDialerFromPEM(caPEM, certPEM, keyPEM []byte, opts ...Option) (client.TLSDialFunc, error) {
+	d, err := NewDialerFromPEM(caPEM, certPEM, keyPEM, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.DialContext, nil
+}
+
+// makeTLSConfig parses the PEM-encoded CA, client certificate and key into a tls.Config based on that set by
+// WithTLSConfig (if any), with the ServerName set by WithServerName (if not, Dialer.DialContext sets it).
+func makeTLSConfig(caPEM, certPEM, keyPEM []byte, o options) (*tls.Config, error) {
+	certPool := x509.NewCertPool()
+	if o.systemCertPool {
+		var err error
+		if certPool, err = x509.SystemCertPool(); err != nil {
+			return nil, fmt.Errorf("loading the system cert pool: %w", err)
 		}
+	}
+	if ok := certPool.AppendCertsFromPEM(caPEM); !ok {
+		return nil, ErrNoCACertsLoadedFromPEM
+	}
 
-		clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientCertKey)
+	var certs []tls.Certificate
+	switch {
+	case len(certPEM) == 0 && len(keyPEM) == 0:
+		// one-way TLS, without a client certificate
+	case len(certPEM) == 0, len(keyPEM) == 0:
+		return nil, ErrIncompleteClientCert
+	default:
+		if o.keyPassphrase != nil {
+			var err error
+			if keyPEM, err = decryptKeyPEM(keyPEM, o.keyPassphrase); err != nil {
+				return nil, fmt.Errorf("decrypting the client key: %w", err)
+			}
+		}
+
+		clientCert, err := tls.X509KeyPair(certPEM, keyPEM)
 		if err != nil {
 			return nil, err
 		}
+		certs = []tls.Certificate{clientCert}
+	}
+
+	config := &tls.Config{}
+	if o.tlsConfig != nil {
+		config = o.tlsConfig.Clone()
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	config.RootCAs = certPool
+	config.Certificates = certs
+	config.ServerName = o.serverName
 
-		config := tls.Config{
-			MinVersion:   tls.VersionTLS12,
-			RootCAs:      certPool,
-			Certificates: []tls.Certificate{clientCert},
+	var pins verifyPeerCertificateFunc
+	if len(o.pinnedFingerprints) > 0 {
+		var err error
+		if pins, err = pinVerifier(o.pinnedFingerprints); err != nil {
+			return nil, err
 		}
+	}
+	config.VerifyPeerCertificate = chainVerifiers(config.VerifyPeerCertificate, pins, o.verifyPeerCertificate)
+
+	return config, nil
+}
+
+// DialContext connects to addr and performs the TLS handshake, verifying the broker's certificate against the
+// Config's ServerName, or if it has none, addr's host. The connection is made with client.DialContext, so that it
+// goes through any proxy set by client.WithProxy. Handshake failures with a common cause (such as an expired
+// certificate, or broker having TLS disabled) are returned as a *HandshakeError.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
 
-		dialer := tls.Dialer{
-			Config: &config,
+	config := d.CurrentConfig()
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
 		}
 
-		return dialer.DialContext(ctx, network, addr)
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	rawConn, err := client.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := tls.Client(rawConn, config)
+	if err = conn.HandshakeContext(ctx); err != nil {
+		_ = rawConn.Close()
+		return nil, annotateHandshakeError(err)
 	}
+
+	return conn, nil
+}
+
+// CurrentConfig returns the Config that the next dial will use. With WithReloadInterval, it first reloads the
+// certificates if it is time to check the files and they have changed.
+func (d *Dialer) CurrentConfig() *tls.Config {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.reloader != nil {
+		if config, ok := d.reloader.reload(); ok {
+			d.Config = config
+		}
+	}
+
+	return d.Config
 }
@@ -0,0 +1,526 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package securetls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/corelight/go-zeek-broker-ws/pkg/client"
+)
+
+// testPKI is a CA and a certificate issued by it (used for both the server and client), written to PEM files.
+type testPKI struct {
+	caFile, certFile, keyFile string
+	cert                      tls.Certificate
+}
+
+func makeTestPKI(t *testing.T, notAfter time.Time) testPKI {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              time.Now().Add(48 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"broker.example"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	pki := testPKI{
+		caFile:   filepath.Join(dir, "ca.pem"),
+		certFile: filepath.Join(dir, "cert.pem"),
+		keyFile:  filepath.Join(dir, "key.pem"),
+	}
+
+	for file, block := range map[string]*pem.Block{
+		pki.caFile:   {Type: "CERTIFICATE", Bytes: caDER},
+		pki.certFile: {Type: "CERTIFICATE", Bytes: der},
+		pki.keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err = os.WriteFile(file, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if pki.cert, err = tls.LoadX509KeyPair(pki.certFile, pki.keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	return pki
+}
+
+func TestMakeSecureDialer_certExpired(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(-24*time.Hour))
+
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{pki.cert}, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dial, err := MakeSecureDialer(pki.caFile, pki.certFile, pki.keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "https://"))
+
+	var handshakeErr *HandshakeError
+	if !errors.As(err, &handshakeErr) {
+		t.Fatalf("expected a HandshakeError but got %v", err)
+	}
+
+	if handshakeErr.Hint != hintCertExpired {
+		t.Errorf("unexpected hint %q", handshakeErr.Hint)
+	}
+
+	var invalidErr x509.CertificateInvalidError
+	if !errors.As(err, &invalidErr) {
+		t.Errorf("underlying error is not available: %v", err)
+	}
+}
+
+func TestMakeSecureDialer_tlsDisabled(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	dial, err := MakeSecureDialer(pki.caFile, pki.certFile, pki.keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "http://"))
+
+	var handshakeErr *HandshakeError
+	if !errors.As(err, &handshakeErr) {
+		t.Fatalf("expected a HandshakeError but got %v", err)
+	}
+
+	if handshakeErr.Hint != hintTLSDisabled {
+		t.Errorf("unexpected hint %q", handshakeErr.Hint)
+	}
+}
+
+func TestMakeSecureDialer_ok(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{pki.cert}, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dial, err := MakeSecureDialer(pki.caFile, pki.certFile, pki.keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "https://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.Close()
+}
+
+func TestMakeSecureDialerFromPEM(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{pki.cert}, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	pems := make([][]byte, 3)
+	for i, file := range []string{pki.caFile, pki.certFile, pki.keyFile} {
+		var err error
+		if pems[i], err = os.ReadFile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dial, err := MakeSecureDialerFromPEM(pems[0], pems[1], pems[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "https://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	// bad PEM is rejected up front
+	if _, err = MakeSecureDialerFromPEM([]byte("not PEM"), pems[1], pems[2]); !errors.Is(err, ErrNoCACertsLoadedFromPEM) {
+		t.Errorf("expected ErrNoCACertsLoadedFromPEM but got %v", err)
+	}
+	if _, err = MakeSecureDialerFromPEM(pems[0], pems[1], pems[1]); err == nil {
+		t.Error("expected an error for an invalid key")
+	}
+	if _, err = MakeSecureDialerFromPEM(pems[0], pems[1], nil); !errors.Is(err, ErrIncompleteClientCert) {
+		t.Errorf("expected ErrIncompleteClientCert but got %v", err)
+	}
+}
+
+func TestMakeSecureDialer_readsFilesOnce(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{pki.cert}, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dial, err := MakeSecureDialer(pki.caFile, pki.certFile, pki.keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the files were read by MakeSecureDialer, so dialing (and re-dialing) doesn't need them
+	for _, file := range []string{pki.caFile, pki.certFile, pki.keyFile} {
+		if err = os.Remove(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		conn, err := dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "https://"))
+		if err != nil {
+			t.Fatalf("dial %d: %v", i, err)
+		}
+		_ = conn.Close()
+	}
+}
+
+func TestMakeSecureDialer_invalid(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+
+	tests := []struct {
+		name                      string
+		caFile, certFile, keyFile string
+		want                      func(error) bool
+	}{
+		{
+			name: "missing file", caFile: pki.caFile + ".missing", certFile: pki.certFile, keyFile: pki.keyFile,
+			want: func(err error) bool { return errors.Is(err, os.ErrNotExist) },
+		},
+		{
+			name: "no CA", caFile: pki.keyFile, certFile: pki.certFile, keyFile: pki.keyFile,
+			want: func(err error) bool { return errors.Is(err, ErrNoCACertsLoadedFromPEM) },
+		},
+		{
+			name: "invalid key", caFile: pki.caFile, certFile: pki.certFile, keyFile: pki.caFile,
+			want: func(err error) bool { return err != nil },
+		},
+		{
+			name: "certificate without key", caFile: pki.caFile, certFile: pki.certFile,
+			want: func(err error) bool { return errors.Is(err, ErrIncompleteClientCert) },
+		},
+		{
+			name: "key without certificate", caFile: pki.caFile, keyFile: pki.keyFile,
+			want: func(err error) bool { return errors.Is(err, ErrIncompleteClientCert) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dial, err := MakeSecureDialer(tt.caFile, tt.certFile, tt.keyFile)
+			if dial != nil || !tt.want(err) {
+				t.Errorf("MakeSecureDialer() = %v, %v", dial != nil, err)
+			}
+		})
+	}
+}
+
+func TestMakeSecureDialer_WithTLSConfig(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+
+	tests := []struct {
+		name          string
+		serverMax     uint16
+		wantVersion   uint16
+		wantHandshake bool
+	}{
+		{name: "TLS 1.3", serverMax: tls.VersionTLS13, wantVersion: tls.VersionTLS13, wantHandshake: true},
+		{name: "TLS 1.2 refused", serverMax: tls.VersionTLS12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+			srv.TLS = &tls.Config{
+				Certificates: []tls.Certificate{pki.cert},
+				MinVersion:   tls.VersionTLS12,
+				MaxVersion:   tt.serverMax,
+			}
+			srv.StartTLS()
+			defer srv.Close()
+
+			// the managed fields are overwritten
+			config := &tls.Config{MinVersion: tls.VersionTLS13, ServerName: "example.com"}
+			dial, err := MakeSecureDialer(pki.caFile, pki.certFile, pki.keyFile, WithTLSConfig(config))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "https://"))
+			if !tt.wantHandshake {
+				if err == nil {
+					_ = conn.Close()
+					t.Fatal("expected the handshake to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if version := conn.(*tls.Conn).ConnectionState().Version; version != tt.wantVersion {
+				t.Errorf("negotiated %s, want %s", tls.VersionName(version), tls.VersionName(tt.wantVersion))
+			}
+			if config.RootCAs != nil || config.Certificates != nil {
+				t.Error("the given config was modified")
+			}
+		})
+	}
+}
+
+func TestMakeSecureDialer_oneWay(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+
+	peerCerts := make(chan int, 1)
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pki.cert},
+		MinVersion:   tls.VersionTLS12,
+		ClientAuth:   tls.RequestClientCert,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			peerCerts <- len(state.PeerCertificates)
+			return nil
+		},
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dial, err := MakeSecureDialer(pki.caFile, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "https://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// make a request, so that the server has finished the handshake
+	if _, err = conn.Write([]byte("GET / HTTP/1.0\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := <-peerCerts; n != 0 {
+		t.Errorf("presented %d client certificates, want none", n)
+	}
+}
+
+func TestMakeSecureDialer_WithServerName(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+
+	serverNames := make(chan string, 1)
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pki.cert},
+		MinVersion:   tls.VersionTLS12,
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverNames <- hello.ServerName
+			return nil, nil
+		},
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		serverName string
+		wantErr    bool
+	}{
+		{serverName: "broker.example"},
+		{serverName: "other.example", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.serverName, func(t *testing.T) {
+			dial, err := MakeSecureDialer(pki.caFile, pki.certFile, pki.keyFile, WithServerName(tt.serverName))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the certificate is also valid for 127.0.0.1, which is dialed, but is verified against the server name
+			conn, err := dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "https://"))
+			if got := <-serverNames; got != tt.serverName {
+				t.Errorf("sent SNI %q, want %q", got, tt.serverName)
+			}
+
+			var hostnameErr x509.HostnameError
+			switch {
+			case tt.wantErr && !errors.As(err, &hostnameErr):
+				t.Errorf("expected a HostnameError but got %v", err)
+			case !tt.wantErr && err != nil:
+				t.Error(err)
+			}
+			if conn != nil {
+				_ = conn.Close()
+			}
+		})
+	}
+}
+
+func TestMakeSecureDialer_WithSystemCertPool(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{pki.cert}, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// the given CA is still trusted when added to the system's
+	dial, err := MakeSecureDialer(pki.caFile, pki.certFile, pki.keyFile, WithSystemCertPool())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "https://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+}
+
+func TestMakeSecureDialer_WithDialTimeout(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+
+	// a server that accepts the connection, but never completes the handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		<-done
+		_ = conn.Close()
+	}()
+
+	dial, err := MakeSecureDialer(pki.caFile, pki.certFile, pki.keyFile, WithDialTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = dial(context.Background(), "tcp", ln.Addr().String())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the dial to time out but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("dial took %s to time out", elapsed)
+	}
+}
+
+func TestNewDialer(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{pki.cert}, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	d, err := NewDialer(pki.caFile, pki.certFile, pki.keyFile, WithDialTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Config.RootCAs == nil || len(d.Config.Certificates) != 1 || d.Config.ServerName != "" {
+		t.Errorf("unexpected TLS configuration %+v", d.Config)
+	}
+	if d.Timeout != time.Minute {
+		t.Errorf("Timeout = %s, want %s", d.Timeout, time.Minute)
+	}
+
+	var dial client.TLSDialFunc = d.DialContext
+	conn, err := dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "https://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	// the configuration can be changed between dials, e.g. to a server name that the certificate isn't valid for
+	config := d.Config.Clone()
+	config.ServerName = "other.example"
+	d.Config = config
+
+	var hostnameErr x509.HostnameError
+	_, err = d.DialContext(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "https://"))
+	if !errors.As(err, &hostnameErr) {
+		t.Errorf("expected a HostnameError but got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package securetls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"strings"
+	"syscall"
+)
+
+// HandshakeError is returned by the dialer when the TLS connection to broker cannot be established for a
+// common reason, annotating the underlying error (available via errors.Unwrap/errors.As) with guidance.
+type HandshakeError struct {
+	Err  error
+	Hint string
+}
+
+// Error implements the Error interface for HandshakeError.
+func (e *HandshakeError) Error() string {
+	return e.Err.Error() + " (" + e.Hint + ")"
+}
+
+// Unwrap returns the underlying error.
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	hintCertExpired = "the broker's certificate has expired or is not yet valid: check its validity period " +
+		"and the clock of both hosts"
+	hintUnknownCA = "the broker's certificate is not signed by the CA loaded from the CA file: check that it is " +
+		"the CA that issued the certificate configured with Broker::ssl_certificate"
+	hintTLSDisabled = "the broker did not respond with TLS, so it probably has TLS disabled " +
+		"(redef Broker::disable_ssl = T): connect with secure set to false"
+	hintHandshakeRefused = "the broker refused the TLS handshake: if broker is not configured with certificates, " +
+		"use weirdtls.BrokerDefaultTLSDialer, otherwise check that it trusts the client certificate"
+)
+
+// annotateHandshakeError wraps err in a HandshakeError if the cause is recognised, otherwise it is returned as-is.
+func annotateHandshakeError(err error) error {
+	if hint := handshakeHint(err); hint != "" {
+		return &HandshakeError{Err: err, Hint: hint}
+	}
+
+	return err
+}
+
+func handshakeHint(err error) string {
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired {
+		return hintCertExpired
+	}
+
+	var authorityErr x509.UnknownAuthorityError
+	if errors.As(err, &authorityErr) {
+		return hintUnknownCA
+	}
+
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &recordErr) {
+		return hintTLSDisabled
+	}
+
+	// The alert sent by broker when there is no cipher suite in common, or it rejects the client certificate.
+	if strings.Contains(err.Error(), "tls: handshake failure") || strings.Contains(err.Error(), "tls: bad certificate") {
+		return hintHandshakeRefused
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) {
+		return hintHandshakeRefused
+	}
+
+	return ""
+}
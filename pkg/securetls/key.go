@@ -0,0 +1,87 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package securetls
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+
+	"github.com/youmark/pkcs8"
+)
+
+// ErrIncorrectKeyPassphrase is returned when the client key can't be decrypted with the passphrase set by
+// WithKeyPassphrase.
+var ErrIncorrectKeyPassphrase = errors.New("incorrect passphrase for the client key")
+
+// errPKCS8IncorrectPassword is the message of the error returned by the pkcs8 package for a wrong passphrase, which
+// it doesn't export.
+const errPKCS8IncorrectPassword = "pkcs8: incorrect password"
+
+// decryptKeyPEM returns keyPEM with its private key decrypted with passphrase, in a form that tls.X509KeyPair accepts.
+// The key may be encrypted as PKCS #8 (an "ENCRYPTED PRIVATE KEY" block, with PBES2, as decrypted by the pkcs8
+// package), or with OpenSSL's legacy PEM encryption (a "Proc-Type: 4,ENCRYPTED" header). A key that isn't encrypted is
+// returned as it is.
+func decryptKeyPEM(keyPEM, passphrase []byte) ([]byte, error) {
+	rest := keyPEM
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			return keyPEM, nil // no key, which tls.X509KeyPair reports
+		}
+
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			if len(passphrase) == 0 {
+				// the pkcs8 package would parse the key as if it weren't encrypted
+				return nil, ErrIncorrectKeyPassphrase
+			}
+
+			key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, passphrase)
+			if err != nil && err.Error() == errPKCS8IncorrectPassword {
+				return nil, ErrIncorrectKeyPassphrase
+			} else if err != nil {
+				return nil, err
+			}
+
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			if err != nil {
+				return nil, err
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+
+		case strings.HasSuffix(block.Type, "PRIVATE KEY") && x509.IsEncryptedPEMBlock(block): //nolint:staticcheck
+			// The legacy encryption is insecure by modern standards, but is still what e.g. "openssl genrsa -aes256"
+			// produces.
+			der, err := x509.DecryptPEMBlock(block, passphrase) //nolint:staticcheck // see above
+			if err == nil && !isPrivateKey(block.Type, der) {
+				// the padding was valid by chance
+				err = x509.IncorrectPasswordError
+			}
+			if errors.Is(err, x509.IncorrectPasswordError) {
+				return nil, ErrIncorrectKeyPassphrase
+			} else if err != nil {
+				return nil, err
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			return keyPEM, nil
+		}
+	}
+}
+
+// isPrivateKey returns whether der parses as a private key of the given PEM type.
+func isPrivateKey(pemType string, der []byte) bool {
+	var err error
+	switch pemType {
+	case "RSA PRIVATE KEY":
+		_, err = x509.ParsePKCS1PrivateKey(der)
+	case "EC PRIVATE KEY":
+		_, err = x509.ParseECPrivateKey(der)
+	default:
+		_, err = x509.ParsePKCS8PrivateKey(der)
+	}
+	return err == nil
+}
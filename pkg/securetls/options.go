@@ -0,0 +1,134 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package securetls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+)
+
+// Option configures optional behaviour of the Dialer returned by NewDialer or NewDialerFromPEM (and so of the dial
+// function returned by MakeSecureDialer or MakeSecureDialerFromPEM). Each option documents its default, which applies
+// when it isn't given.
+type Option func(*options)
+
+type options struct {
+	tlsConfig      *tls.Config
+	serverName     string
+	systemCertPool bool
+	keyPassphrase  []byte
+	dialTimeout    time.Duration
+
+	pinnedFingerprints    []string
+	verifyPeerCertificate verifyPeerCertificateFunc
+
+	reloadInterval     time.Duration
+	reloadErrorHandler func(err error)
+}
+
+func makeOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithTLSConfig uses a copy of config as the basis of the TLS configuration, e.g. to require TLS 1.3 (MinVersion),
+// or restrict the cipher suites (CipherSuites) or curves (CurvePreferences) to those mandated for compliance. The
+// fields that the dialer manages are overwritten: RootCAs (the CA), Certificates (the client certificate) and
+// ServerName (that set by WithServerName, or the host dialed). All others are used as given, except that a zero
+// MinVersion is TLS 1.2, as it is by default. The default is a configuration with only the managed fields and
+// MinVersion set.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+// WithServerName sets the name sent to broker for SNI, and which its certificate is verified against, e.g. to the
+// name in its certificate when connecting by IP address or through a load balancer. The default is the host dialed.
+func WithServerName(name string) Option {
+	return func(o *options) {
+		o.serverName = name
+	}
+}
+
+// WithSystemCertPool trusts the system's CAs (see x509.SystemCertPool) as well as the CA given to the dialer, e.g.
+// when broker sits behind a TLS terminator with a publicly trusted certificate, or presents a private intermediate
+// chained to a public root. This widens trust considerably: any of the system's CAs can then issue a certificate for
+// broker's name that the dialer accepts, so it is only as strong as the WebPKI's control of that name. By default,
+// only the given CA is trusted.
+func WithSystemCertPool() Option {
+	return func(o *options) {
+		o.systemCertPool = true
+	}
+}
+
+// WithKeyPassphrase decrypts the client key with passphrase, for keys that are stored encrypted: as PKCS #8 (an
+// "ENCRYPTED PRIVATE KEY", with PBES2, PBKDF2 or scrypt, and AES or 3DES, as "openssl pkcs8 -topk8" produces), or with
+// OpenSSL's legacy PEM encryption (a "Proc-Type: 4,ENCRYPTED" header). ErrIncorrectKeyPassphrase is returned if
+// passphrase is wrong (or empty, for a PKCS #8 key). A key that isn't encrypted is used as it is. By default, the key
+// must not be encrypted.
+func WithKeyPassphrase(passphrase []byte) Option {
+	return func(o *options) {
+		o.keyPassphrase = passphrase
+	}
+}
+
+// WithDialTimeout bounds each dial, including the TCP connection and the TLS handshake, to timeout, even if the context
+// it is given has no deadline (or a later one), so that e.g. a broker that accepts the connection but never completes
+// the handshake can't hang the dial. A dial that times out returns an error wrapping context.DeadlineExceeded. By
+// default, the dial is only bounded by its context, which client.NewClient bounds with its dialer's HandshakeTimeout
+// (45 seconds by default).
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithPinnedFingerprints only accepts a broker whose certificate has one of the given SHA-256 fingerprints (of the
+// DER-encoded certificate, in hex, optionally separated by colons, as "openssl x509 -fingerprint -sha256" prints),
+// which defends against a compromised CA. The certificate must still be valid and verify against the CA, and a
+// mismatch fails the dial with an error wrapping ErrCertificateNotPinned. Remember to pin a renewed certificate
+// before it is deployed. An invalid fingerprint is an error when the dialer is made. By default, any certificate
+// issued by the CA is accepted.
+func WithPinnedFingerprints(fingerprints ...string) Option {
+	return func(o *options) {
+		o.pinnedFingerprints = append(o.pinnedFingerprints, fingerprints...)
+	}
+}
+
+// WithVerifyPeerCertificate calls verify, as tls.Config's VerifyPeerCertificate, to check the broker's certificate
+// after it has been verified against the CA (and any pinned fingerprints), failing the dial with its error if it
+// returns one. It is called after any VerifyPeerCertificate of the config set by WithTLSConfig. By default, there are
+// no further checks.
+func WithVerifyPeerCertificate(verify func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) Option {
+	return func(o *options) {
+		o.verifyPeerCertificate = verify
+	}
+}
+
+// WithReloadInterval reloads the certificates when their files change, so that they can be rotated (e.g. by
+// cert-manager) without restarting. When dialing, at most once per interval, the files are checked for a change to
+// their modification time or size, and if any has changed, they are all read and parsed again, and the new
+// configuration replaces the old one for that and later dials (connections already made are unaffected). If the new
+// files can't be loaded (e.g. the certificate has been updated but not yet its key), the old configuration continues
+// to be used, the error is passed to the handler set by WithReloadErrorHandler, and the files are loaded again at
+// the next check. It only applies to NewDialer and MakeSecureDialer, which are given files. By default, the files are
+// only read when the dialer is made.
+func WithReloadInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.reloadInterval = interval
+	}
+}
+
+// WithReloadErrorHandler calls handler with the error each time the certificates can't be reloaded, see
+// WithReloadInterval. It is called synchronously by the dial that found the change, which continues with the
+// previous configuration. By default, these errors aren't reported.
+func WithReloadErrorHandler(handler func(err error)) Option {
+	return func(o *options) {
+		o.reloadErrorHandler = handler
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package securetls
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrCertificateNotPinned is wrapped by the error returned by the dialer when the broker's certificate doesn't match
+// any of the fingerprints set by WithPinnedFingerprints.
+var ErrCertificateNotPinned = errors.New("broker's certificate is not pinned")
+
+// verifyPeerCertificateFunc is the type of tls.Config's VerifyPeerCertificate.
+type verifyPeerCertificateFunc func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+
+// parseFingerprint parses a hex-encoded SHA-256 fingerprint, which may be separated by colons or spaces (e.g. as
+// "openssl x509 -fingerprint -sha256" prints it).
+func parseFingerprint(s string) ([sha256.Size]byte, error) {
+	var fingerprint [sha256.Size]byte
+
+	b, err := hex.DecodeString(strings.NewReplacer(":", "", " ", "").Replace(s))
+	if err != nil || len(b) != sha256.Size {
+		return fingerprint, fmt.Errorf("invalid SHA-256 fingerprint %q", s)
+	}
+	copy(fingerprint[:], b)
+
+	return fingerprint, nil
+}
+
+// pinVerifier returns a verifyPeerCertificateFunc that checks the broker's (leaf) certificate has one of fingerprints.
+func pinVerifier(fingerprints []string) (verifyPeerCertificateFunc, error) {
+	pins := make(map[[sha256.Size]byte]bool, len(fingerprints))
+	for _, s := range fingerprints {
+		fingerprint, err := parseFingerprint(s)
+		if err != nil {
+			return nil, err
+		}
+		pins[fingerprint] = true
+	}
+
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return ErrCertificateNotPinned
+		}
+
+		fingerprint := sha256.Sum256(rawCerts[0])
+		if !pins[fingerprint] {
+			return fmt.Errorf("%w: its SHA-256 fingerprint is %X", ErrCertificateNotPinned, fingerprint)
+		}
+
+		return nil
+	}, nil
+}
+
+// chainVerifiers returns a verifyPeerCertificateFunc that calls each of the non-nil verifiers in turn, until one
+// fails, or nil if there are none.
+func chainVerifiers(verifiers ...verifyPeerCertificateFunc) verifyPeerCertificateFunc {
+	var chain []verifyPeerCertificateFunc
+	for _, v := range verifiers {
+		if v != nil {
+			chain = append(chain, v)
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		for _, v := range chain {
+			if err := v(rawCerts, verifiedChains); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
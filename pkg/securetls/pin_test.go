@@ -0,0 +1,95 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package securetls
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMakeSecureDialer_WithPinnedFingerprints(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+	other := makeTestPKI(t, time.Now().Add(24*time.Hour))
+
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{pki.cert}, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// formatted as "openssl x509 -fingerprint -sha256" prints them
+	fingerprint := func(cert tls.Certificate) string {
+		sum := sha256.Sum256(cert.Certificate[0])
+		hexPairs := make([]string, len(sum))
+		for i, b := range sum {
+			hexPairs[i] = fmt.Sprintf("%02X", b)
+		}
+		return strings.Join(hexPairs, ":")
+	}
+
+	tests := []struct {
+		name    string
+		pins    []string
+		wantErr error
+	}{
+		{name: "match", pins: []string{fingerprint(other.cert), fingerprint(pki.cert)}},
+		{name: "mismatch", pins: []string{fingerprint(other.cert)}, wantErr: ErrCertificateNotPinned},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dial, err := MakeSecureDialer(pki.caFile, pki.certFile, pki.keyFile, WithPinnedFingerprints(tt.pins...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "https://"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v but got %v", tt.wantErr, err)
+			}
+			if conn != nil {
+				_ = conn.Close()
+			}
+		})
+	}
+
+	if _, err := MakeSecureDialer(pki.caFile, pki.certFile, pki.keyFile, WithPinnedFingerprints("AB:CD")); err == nil {
+		t.Error("expected an error for an invalid fingerprint")
+	}
+}
+
+func TestMakeSecureDialer_WithVerifyPeerCertificate(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{pki.cert}, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	errRejected := errors.New("rejected")
+	var verifiedChains int
+	verify := func(_ [][]byte, chains [][]*x509.Certificate) error {
+		verifiedChains = len(chains)
+		return errRejected
+	}
+
+	dial, err := MakeSecureDialer(pki.caFile, pki.certFile, pki.keyFile, WithVerifyPeerCertificate(verify))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "https://")); !errors.Is(err, errRejected) {
+		t.Errorf("expected the callback's error but got %v", err)
+	}
+	if verifiedChains == 0 {
+		t.Error("the callback wasn't given the chains verified against the CA")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package securetls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"time"
+)
+
+// certFiles are the files that a Dialer made by NewDialer loads its certificates from. The client certificate and
+// key are empty for one-way TLS.
+type certFiles struct {
+	ca, cert, key string
+}
+
+// paths returns the files that are set.
+func (f certFiles) paths() []string {
+	if f.cert == "" {
+		return []string{f.ca}
+	}
+	return []string{f.ca, f.cert, f.key}
+}
+
+// fileVersion identifies the contents of a file, by its modification time and size.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// stat returns the versions of the files that are set.
+func (f certFiles) stat() ([]fileVersion, error) {
+	paths := f.paths()
+	versions := make([]fileVersion, len(paths))
+	for i, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		versions[i] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	return versions, nil
+}
+
+// load reads the files and parses them into a tls.Config, as o specifies.
+func (f certFiles) load(o options) (*tls.Config, error) {
+	caCert, err := os.ReadFile(f.ca)
+	if err != nil {
+		return nil, err
+	}
+
+	var clientCert, clientKey []byte
+	if f.cert != "" {
+		if clientCert, err = os.ReadFile(f.cert); err != nil {
+			return nil, err
+		}
+
+		if clientKey, err = os.ReadFile(f.key); err != nil {
+			return nil, err
+		}
+	}
+
+	return makeTLSConfig(caCert, clientCert, clientKey, o)
+}
+
+// reloader reloads a Dialer's certificates from its files when they change, see WithReloadInterval.
+type reloader struct {
+	files    certFiles
+	opts     options
+	versions []fileVersion // of the files as last loaded
+	checked  time.Time
+}
+
+// reload returns a new tls.Config if it is time to check the files, and they have changed since they were last
+// loaded. If the new files can't be loaded, the error is passed to the handler set by WithReloadErrorHandler, and the
+// files are loaded again at the next check.
+func (r *reloader) reload() (*tls.Config, bool) {
+	now := time.Now()
+	if now.Sub(r.checked) < r.opts.reloadInterval {
+		return nil, false
+	}
+	r.checked = now
+
+	versions, err := r.files.stat()
+	if err == nil && versionsEqual(versions, r.versions) {
+		return nil, false
+	}
+
+	var config *tls.Config
+	if err == nil {
+		config, err = r.files.load(r.opts)
+	}
+	if err != nil {
+		if r.opts.reloadErrorHandler != nil {
+			r.opts.reloadErrorHandler(fmt.Errorf("reloading certificates: %w", err))
+		}
+		return nil, false
+	}
+
+	r.versions = versions
+	return config, true
+}
+
+func versionsEqual(a, b []fileVersion) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package securetls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDialer_WithReloadInterval(t *testing.T) {
+	pki := makeTestPKI(t, time.Now().Add(24*time.Hour))
+	rotated := makeTestPKI(t, time.Now().Add(24*time.Hour)) // issued by a different CA
+
+	startServer := func(cert tls.Certificate) string {
+		srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+		srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+		return strings.TrimPrefix(srv.URL, "https://")
+	}
+	oldAddr, newAddr := startServer(pki.cert), startServer(rotated.cert)
+
+	var reloadErrs []error
+	d, err := NewDialer(pki.caFile, pki.certFile, pki.keyFile, WithReloadInterval(time.Nanosecond),
+		WithReloadErrorHandler(func(err error) { reloadErrs = append(reloadErrs, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dial := func(addr string) error {
+		conn, err := d.DialContext(context.Background(), "tcp", addr)
+		if err == nil {
+			_ = conn.Close()
+		}
+		return err
+	}
+
+	if err = dial(oldAddr); err != nil {
+		t.Fatal(err)
+	}
+
+	// copy the rotated files over the originals, making sure that their modification times change
+	copyFile := func(from, to string) {
+		b, err := os.ReadFile(from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(to, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		future := time.Now().Add(time.Hour)
+		if err = os.Chtimes(to, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// an invalid rotation (the new CA, but a key that isn't) leaves the old configuration in use
+	copyFile(rotated.caFile, pki.caFile)
+	copyFile(rotated.caFile, pki.keyFile)
+	if err = dial(oldAddr); err != nil {
+		t.Errorf("dial with the old configuration failed: %v", err)
+	}
+	if len(reloadErrs) != 1 {
+		t.Errorf("expected a reload error but got %v", reloadErrs)
+	}
+
+	// once the rotation is complete, the new configuration is used, which doesn't trust the old CA
+	copyFile(rotated.certFile, pki.certFile)
+	copyFile(rotated.keyFile, pki.keyFile)
+	if err = dial(newAddr); err != nil {
+		t.Errorf("dial with the new configuration failed: %v", err)
+	}
+
+	var authorityErr x509.UnknownAuthorityError
+	if err = dial(oldAddr); !errors.As(err, &authorityErr) {
+		t.Errorf("expected the old CA to be untrusted but got %v", err)
+	}
+}
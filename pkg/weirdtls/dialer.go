@@ -2,21 +2,175 @@ package weirdtls
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"sync"
+	"time"
 
+	"github.com/corelight/go-zeek-broker-ws/pkg/client"
 	"github.com/libp2p/go-openssl"
 )
 
+// DefaultCipherList is the OpenSSL cipher list used by BrokerDefaultTLSDialer. Broker's default mode (without
+// certificates, and so without verification) only negotiates anonymous ECDH cipher suites: AECDH-AES256-SHA, on the
+// P-384 curve. OpenSSL 1.1 and later only allow anonymous suites at security level 0, hence the @SECLEVEL=0, with the
+// plain name as a fallback for older versions of OpenSSL that don't understand it.
+const DefaultCipherList = "AECDH-AES256-SHA@SECLEVEL=0:AECDH-AES256-SHA:P-384"
+
+// DefaultSecurityLevel is the OpenSSL security level used by BrokerDefaultTLSDialer, the only one that allows the
+// anonymous cipher suites that broker negotiates by default, see BrokerTLSDialerWithSecurityLevel.
+const DefaultSecurityLevel = 0
+
+// MaxSecurityLevel is the highest OpenSSL security level.
+const MaxSecurityLevel = 5
+
+// ErrInvalidSecurityLevel is returned by BrokerTLSDialerWithSecurityLevel for a level outside 0 to MaxSecurityLevel.
+var ErrInvalidSecurityLevel = errors.New("invalid OpenSSL security level")
+
+// BrokerDefaultTLSDialer is a dial function for client.NewClient that speaks the anonymous TLS used by broker when
+// it is not configured with certificates (its default). Handshake failures with a common cause (such as broker
+// having TLS disabled) are returned as a *HandshakeError. Each dial is bounded by DefaultDialTimeout, and is aborted
+// (including during the handshake) once ctx is done, returning an error wrapping ctx.Err(). The OpenSSL context is
+// made by the first dial, and shared by all later ones, as for BrokerTLSDialerWithCiphers.
 func BrokerDefaultTLSDialer(ctx context.Context, network, addr string) (net.Conn, error) {
+	defaultDialerOnce.Do(func() {
+		defaultDialer, errDefaultDialer = BrokerTLSDialerWithCiphers(DefaultCipherList)
+	})
+	if errDefaultDialer != nil {
+		return nil, errDefaultDialer
+	}
+
+	return defaultDialer(ctx, network, addr)
+}
+
+var (
+	defaultDialerOnce sync.Once
+	defaultDialer     client.TLSDialFunc
+	errDefaultDialer  error
+)
+
+// BrokerTLSDialerWithCiphers is BrokerDefaultTLSDialer, but negotiating the ciphers in cipherList (an OpenSSL cipher
+// list, see DefaultCipherList) instead, e.g. for a build of broker that negotiates a different anonymous cipher. It
+// returns an error if OpenSSL can't use any of the ciphers in cipherList. The dial function can be customised with
+// opts, e.g. WithDialTimeout.
+//
+// The OpenSSL context (SSL_CTX) is made here, and shared by every connection that the dial function makes, which
+// avoids setting it up again for each reconnect. This is safe since it isn't modified once made, and it lives as long
+// as the dial function or any of its connections. WithCtxPerDial makes a context for each dial instead.
+func BrokerTLSDialerWithCiphers(cipherList string, opts ...Option) (client.TLSDialFunc, error) {
+	sslCtx, err := newSSLCtx(cipherList)
+	if err != nil {
+		return nil, err
+	}
+
+	o := makeOptions(opts)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		sslCtx := sslCtx
+		if o.ctxPerDial {
+			var err error
+			if sslCtx, err = newSSLCtx(cipherList); err != nil {
+				return nil, err
+			}
+		}
+
+		return dial(ctx, sslCtx, o, network, addr)
+	}, nil
+}
+
+// BrokerTLSDialerWithSecurityLevel is BrokerTLSDialerWithCiphers, but with OpenSSL's security level set to level
+// (0 to MaxSecurityLevel), overriding any level set in cipherList (such as DefaultCipherList's @SECLEVEL=0). It
+// returns ErrInvalidSecurityLevel for a level out of that range.
+//
+// OpenSSL only allows anonymous cipher suites at level 0, since they don't authenticate the server, so a non-zero level
+// can't be used with broker's default configuration: it is for a broker configured with a certificate, where the
+// higher level also sets minimum key sizes and rules out weak ciphers and protocol versions (see OpenSSL's
+// SSL_CTX_set_security_level). However, the certificate still isn't verified, so whatever the level, the connection is
+// only protected against eavesdropping, and not against an attacker that impersonates broker; to verify broker, use
+// the securetls package.
+func BrokerTLSDialerWithSecurityLevel(cipherList string, level int, opts ...Option) (client.TLSDialFunc, error) {
+	if level < 0 || level > MaxSecurityLevel {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidSecurityLevel, level)
+	}
+
+	// The last level set in the cipher list is the one that applies.
+	return BrokerTLSDialerWithCiphers(fmt.Sprintf("%s:@SECLEVEL=%d", cipherList, level), opts...)
+}
+
+// newSSLCtx makes an OpenSSL context that negotiates the ciphers in cipherList.
+func newSSLCtx(cipherList string) (*openssl.Ctx, error) {
 	sslCtx, err := openssl.NewCtx()
 	if err != nil {
 		return nil, err
 	}
 
-	err = sslCtx.SetCipherList("AECDH-AES256-SHA@SECLEVEL=0:AECDH-AES256-SHA:P-384")
+	if err = sslCtx.SetCipherList(cipherList); err != nil {
+		return nil, err
+	}
+
+	return sslCtx, nil
+}
+
+// dial connects to addr, and performs the TLS handshake with sslCtx, within ctx and as o specifies.
+func dial(ctx context.Context, sslCtx *openssl.Ctx, o options, network, addr string) (net.Conn, error) {
+	if o.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.dialTimeout)
+		defer cancel()
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The connection is made with client.DialContext, so that it goes through any proxy set by client.WithProxy. The
+	// handshake is then as openssl.Dial does it, without verifying the host (broker has no certificate by default).
+	rawConn, err := client.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := openssl.Client(rawConn, sslCtx)
+	if err == nil {
+		err = conn.SetTlsExtHostName(host)
+	}
+	if err == nil {
+		err = handshake(ctx, rawConn, conn)
+	}
 	if err != nil {
+		_ = rawConn.Close()
 		return nil, err
 	}
 
-	return openssl.Dial(network, addr, sslCtx, openssl.InsecureSkipHostVerification)
+	return conn, nil
+}
+
+// handshake performs conn's TLS handshake over rawConn, within ctx. OpenSSL can't be given a context, so the
+// handshake is interrupted once ctx is done by moving rawConn's deadline into the past, as the client package does
+// for reads.
+func handshake(ctx context.Context, rawConn net.Conn, conn *openssl.Conn) error {
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = rawConn.SetDeadline(time.Now())
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
+		}
+	}()
+
+	err := conn.Handshake()
+	close(stop)
+	if <-interrupted {
+		// the deadline has been moved, so the connection is unusable even if the handshake finished first
+		return fmt.Errorf("TLS handshake interrupted: %w", ctx.Err())
+	}
+	if err != nil {
+		return annotateHandshakeError(err)
+	}
+
+	return nil
 }
@@ -0,0 +1,251 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package weirdtls
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-openssl"
+)
+
+func TestBrokerDefaultTLSDialer_tlsDisabled(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := BrokerDefaultTLSDialer(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "http://"))
+
+	var handshakeErr *HandshakeError
+	if !errors.As(err, &handshakeErr) {
+		t.Fatalf("expected a HandshakeError but got %v", err)
+	}
+
+	if handshakeErr.Hint != hintTLSDisabled {
+		t.Errorf("unexpected hint %q", handshakeErr.Hint)
+	}
+}
+
+// anonymousTLSServer starts a server that speaks anonymous TLS with the ciphers in cipherList, as broker does by
+// default, writing "ok" to each connection once the handshake is done.
+func anonymousTLSServer(t *testing.T, cipherList string) string {
+	t.Helper()
+
+	sslCtx, err := openssl.NewCtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sslCtx.SetCipherList(cipherList); err != nil {
+		t.Fatal(err)
+	}
+	if err = sslCtx.SetEllipticCurve(openssl.Secp384r1); err != nil {
+		t.Fatal(err)
+	}
+	sslCtx.SetMaxProtoVersion(openssl.TLS1_2_VERSION) // TLS 1.3 has no anonymous cipher suites
+
+	ln, err := openssl.Listen("tcp", "127.0.0.1:0", sslCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("ok"))
+			_ = conn.Close()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestBrokerDefaultTLSDialer_ok(t *testing.T) {
+	addr := anonymousTLSServer(t, "AECDH-AES256-SHA@SECLEVEL=0")
+
+	conn, err := BrokerDefaultTLSDialer(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	b := make([]byte, 2)
+	if _, err = io.ReadFull(conn, b); err != nil || string(b) != "ok" {
+		t.Errorf("read %q, %v", b, err)
+	}
+}
+
+func TestBrokerTLSDialerWithCiphers(t *testing.T) {
+	const cipherList = "AECDH-AES128-SHA@SECLEVEL=0"
+	addr := anonymousTLSServer(t, cipherList)
+
+	// the default ciphers aren't accepted by the server
+	if _, err := BrokerDefaultTLSDialer(context.Background(), "tcp", addr); err == nil {
+		t.Error("expected the default ciphers to be refused")
+	}
+
+	dial, err := BrokerTLSDialerWithCiphers(cipherList)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dial(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	if _, err = BrokerTLSDialerWithCiphers("NOT-A-CIPHER"); err == nil {
+		t.Error("expected an error for an invalid cipher list")
+	}
+}
+
+// unresponsiveServer starts a server that accepts connections, but never completes the TLS handshake.
+func unresponsiveServer(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		_ = ln.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				<-done
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestBrokerTLSDialerWithCiphers_WithDialTimeout(t *testing.T) {
+	addr := unresponsiveServer(t)
+
+	dial, err := BrokerTLSDialerWithCiphers(DefaultCipherList, WithDialTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = dial(context.Background(), "tcp", addr)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the dial to time out but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("dial took %s to time out", elapsed)
+	}
+}
+
+func TestBrokerDefaultTLSDialer_cancel(t *testing.T) {
+	addr := unresponsiveServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := BrokerDefaultTLSDialer(ctx, "tcp", addr)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the dial to be cancelled but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("dial took %s to be cancelled", elapsed)
+	}
+}
+
+func TestBrokerTLSDialerWithCiphers_sharedCtx(t *testing.T) {
+	addr := anonymousTLSServer(t, "AECDH-AES256-SHA@SECLEVEL=0")
+
+	// dialCtxs dials concurrently, returning the OpenSSL context of each connection.
+	dialCtxs := func(dial func(context.Context, string, string) (net.Conn, error)) []*openssl.Ctx {
+		const n = 4
+		ctxs := make([]*openssl.Ctx, n)
+		errs := make(chan error, n)
+		for i := range ctxs {
+			go func(i int) {
+				conn, err := dial(context.Background(), "tcp", addr)
+				if err == nil {
+					ctxs[i] = conn.(*openssl.Conn).GetCtx()
+					_ = conn.Close()
+				}
+				errs <- err
+			}(i)
+		}
+		for range ctxs {
+			if err := <-errs; err != nil {
+				t.Fatal(err)
+			}
+		}
+		return ctxs
+	}
+
+	dial, err := BrokerTLSDialerWithCiphers(DefaultCipherList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctxs := dialCtxs(dial)
+	for _, ctx := range ctxs[1:] {
+		if ctx != ctxs[0] {
+			t.Error("expected the OpenSSL context to be shared between dials")
+		}
+	}
+
+	dial, err = BrokerTLSDialerWithCiphers(DefaultCipherList, WithCtxPerDial())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctxs = dialCtxs(dial)
+	if ctxs[0] == ctxs[1] {
+		t.Error("expected a new OpenSSL context for each dial with WithCtxPerDial")
+	}
+}
+
+func TestBrokerTLSDialerWithSecurityLevel(t *testing.T) {
+	addr := anonymousTLSServer(t, "AECDH-AES256-SHA@SECLEVEL=0")
+
+	dial, err := BrokerTLSDialerWithSecurityLevel(DefaultCipherList, DefaultSecurityLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := dial(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	// anonymous ciphers aren't allowed above level 0, despite the @SECLEVEL=0 in the cipher list
+	dial, err = BrokerTLSDialerWithSecurityLevel(DefaultCipherList, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dial(context.Background(), "tcp", addr); err == nil {
+		t.Error("expected the anonymous ciphers to be refused at security level 1")
+	}
+
+	for _, level := range []int{-1, MaxSecurityLevel + 1} {
+		if _, err = BrokerTLSDialerWithSecurityLevel(DefaultCipherList, level); !errors.Is(err, ErrInvalidSecurityLevel) {
+			t.Errorf("expected ErrInvalidSecurityLevel for level %d but got %v", level, err)
+		}
+	}
+}
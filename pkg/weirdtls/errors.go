@@ -0,0 +1,56 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package weirdtls
+
+import "strings"
+
+// HandshakeError is returned by BrokerDefaultTLSDialer when the TLS connection to broker cannot be established
+// for a common reason, annotating the underlying (OpenSSL) error, available via errors.Unwrap, with guidance.
+type HandshakeError struct {
+	Err  error
+	Hint string
+}
+
+// Error implements the Error interface for HandshakeError.
+func (e *HandshakeError) Error() string {
+	return e.Err.Error() + " (" + e.Hint + ")"
+}
+
+// Unwrap returns the underlying error.
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	hintTLSDisabled = "the broker did not respond with TLS, so it probably has TLS disabled " +
+		"(redef Broker::disable_ssl = T): connect with secure set to false"
+	hintHandshakeRefused = "the broker refused the anonymous TLS handshake, so it is probably configured with " +
+		"certificates: use securetls.MakeSecureDialer"
+)
+
+// handshakeHints maps fragments of OpenSSL error messages to guidance for their likely cause.
+var handshakeHints = []struct {
+	fragment string
+	hint     string
+}{
+	{fragment: "wrong version number", hint: hintTLSDisabled},
+	{fragment: "unknown protocol", hint: hintTLSDisabled},
+	{fragment: "packet length too long", hint: hintTLSDisabled},
+	{fragment: "handshake failure", hint: hintHandshakeRefused},
+	{fragment: "no shared cipher", hint: hintHandshakeRefused},
+	{fragment: "no ciphers available", hint: hintHandshakeRefused},
+	{fragment: "certificate required", hint: hintHandshakeRefused},
+}
+
+// annotateHandshakeError wraps err in a HandshakeError if the cause is recognised, otherwise it is returned as-is.
+func annotateHandshakeError(err error) error {
+	msg := strings.ToLower(err.Error())
+
+	for _, h := range handshakeHints {
+		if strings.Contains(msg, h.fragment) {
+			return &HandshakeError{Err: err, Hint: h.hint}
+		}
+	}
+
+	return err
+}
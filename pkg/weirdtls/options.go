@@ -0,0 +1,49 @@
+// Copyright (c) 2023, Corelight, Inc. All rights reserved.
+
+package weirdtls
+
+import (
+	"time"
+)
+
+// DefaultDialTimeout is the time within which BrokerDefaultTLSDialer must connect to broker and complete the TLS
+// handshake, unless the context it is given is done sooner.
+const DefaultDialTimeout = 30 * time.Second
+
+// Option configures optional behaviour of the dial function returned by BrokerTLSDialerWithCiphers. Each option
+// documents its default, which applies when it isn't given.
+type Option func(*options)
+
+type options struct {
+	dialTimeout time.Duration
+	ctxPerDial  bool
+}
+
+func makeOptions(opts []Option) options {
+	o := options{
+		dialTimeout: DefaultDialTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithDialTimeout bounds each dial, including the TCP connection and the TLS handshake, to timeout, even if the context
+// it is given has no deadline (or a later one), so that e.g. a broker that accepts the connection but never completes
+// the handshake can't hang the dial. A dial that times out returns an error wrapping context.DeadlineExceeded. A
+// timeout of zero leaves the dial bounded only by its context. The default is DefaultDialTimeout.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithCtxPerDial makes a new OpenSSL context for each dial, rather than sharing the one made by the constructor
+// between them. This costs setting up the context for each connection, and is only needed if something else
+// modifies the context of a connection that the dial function returns. By default, the context is shared.
+func WithCtxPerDial() Option {
+	return func(o *options) {
+		o.ctxPerDial = true
+	}
+}